@@ -2,6 +2,12 @@ package app
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
 )
@@ -9,75 +15,426 @@ import (
 const (
 	CodeSpaceUnconfirmedLimit sdk.CodespaceType = "unconfirmed_limit"
 	CodeTooManyUnconfirmedTx  sdk.CodeType      = 2100
+	CodeTxReplaced            sdk.CodeType      = 2101
 )
 
-var errTooManyUnconfirmedTx = sdk.NewError(CodeSpaceUnconfirmedLimit, CodeTooManyUnconfirmedTx, "Too Many Unconfirmed Transactions")
+var (
+	errTooManyUnconfirmedTx = sdk.NewError(CodeSpaceUnconfirmedLimit, CodeTooManyUnconfirmedTx, "Too Many Unconfirmed Transactions")
+	errTxReplaced           = sdk.NewError(CodeSpaceUnconfirmedLimit, CodeTxReplaced, "Transaction Replaced By Another One With Higher Gas Price")
+)
 
 const (
 	SameTxExist      = 1
-	OtherTxExist     = 2
+	OtherTxExist     = 2 // the account already has as many unconfirmed txs as its quota
 	NoTxExist        = 3
 	SweepPeriod      = 15 * 60 // 15 minutes
 	DefaultLimitTime = 60      // a minute
+	DefaultTxQuota   = 1
+
+	UnconfirmedTxQuerierRoute = "unconfirmedtx"
+	QueryUnconfirmedTxStats   = "stats"
+
+	// UnconfirmedTxSnapshotFile is written to the data directory of the node at every commit
+	UnconfirmedTxSnapshotFile = "unconfirmed_txs.json"
 )
 
+// UnconfirmedTx is a tx tracked for one of its signers, Sequence is the sequence of that signer signed in the tx
 type UnconfirmedTx struct {
-	HashID    []byte
-	Timestamp int64
+	HashID    []byte  `json:"hash_id"`
+	Timestamp int64   `json:"timestamp"`
+	GasPrice  sdk.Dec `json:"gas_price"`
+	Sequence  uint64  `json:"sequence"`
+
+	// restored is set for the txs loaded from the snapshot, which may not be in the mempool any more. They count
+	// against the quota until the recheck after the first commit shows they are not in the mempool.
+	restored bool
+}
+
+type unconfirmedTxToRemove struct {
+	addr   sdk.AccAddress
+	hashid []byte
 }
 
 type Account2UnconfirmedTx struct {
-	auMap         map[string]UnconfirmedTx
+	auMap         map[string][]UnconfirmedTx
 	limitTime     int64
-	removeList    []sdk.AccAddress
+	sweepPeriod   int64
+	quota         int
+	quotaOfAcc    map[string]int
+	exempted      map[string]struct{}
+	removeList    []unconfirmedTxToRemove
+	replaced      map[string]int64
 	lastSweepTime int64
+	snapshotFile  string
+	rejections    rejectionCounter
+
+	// the commits since the restored txs are loaded, they are dropped once a recheck is done without them
+	restoredCommits int
+	hasRestored     bool
+}
+
+// UnconfirmedTxStats is returned by the unconfirmed-tx stats query
+type UnconfirmedTxStats struct {
+	Enabled             bool  `json:"enabled"`
+	TrackedAccounts     int   `json:"tracked_accounts"`
+	TrackedTxs          int   `json:"tracked_txs"`
+	RejectionsPerMinute int64 `json:"rejections_per_minute"`
+	LastSweepTime       int64 `json:"last_sweep_time"`
+}
+
+func (stats UnconfirmedTxStats) String() string {
+	return fmt.Sprintf(`Unconfirmed Tx Stats:
+  Enabled:               %t
+  Tracked Accounts:      %d
+  Tracked Txs:           %d
+  Rejections Per Minute: %d
+  Last Sweep Time:       %d`,
+		stats.Enabled, stats.TrackedAccounts, stats.TrackedTxs, stats.RejectionsPerMinute, stats.LastSweepTime)
+}
+
+// rejectionCounter counts the rejections in the last minute with one bucket for each second
+type rejectionCounter struct {
+	counts  [60]int64
+	seconds [60]int64
+}
+
+func (c *rejectionCounter) add(now int64) {
+	i := now % 60
+	if c.seconds[i] != now {
+		c.seconds[i] = now
+		c.counts[i] = 0
+	}
+	c.counts[i]++
+}
+
+func (c *rejectionCounter) lastMinute(now int64) int64 {
+	var sum int64
+	for i, second := range c.seconds {
+		if now-second < 60 {
+			sum += c.counts[i]
+		}
+	}
+	return sum
 }
 
 func NewAccount2UnconfirmedTx(limitTime int64) *Account2UnconfirmedTx {
 	return &Account2UnconfirmedTx{
-		auMap:         make(map[string]UnconfirmedTx),
+		auMap:         make(map[string][]UnconfirmedTx),
 		limitTime:     limitTime,
-		removeList:    make([]sdk.AccAddress, 0, 5000),
+		sweepPeriod:   SweepPeriod,
+		quota:         DefaultTxQuota,
+		quotaOfAcc:    make(map[string]int),
+		exempted:      make(map[string]struct{}),
+		removeList:    make([]unconfirmedTxToRemove, 0, 5000),
+		replaced:      make(map[string]int64),
 		lastSweepTime: 0,
 	}
 }
 
+func NewAccount2UnconfirmedTxWithConfig(conf UnconfirmedTxConfig) *Account2UnconfirmedTx {
+	acc2unc := NewAccount2UnconfirmedTx(conf.LimitTime)
+	acc2unc.sweepPeriod = conf.SweepPeriod
+	acc2unc.SetQuota(conf.Quota, conf.QuotaOfAcc)
+	acc2unc.exempted = conf.Exempted
+	return acc2unc
+}
+
+// SetQuota sets how many unconfirmed txs an account can have at the same time,
+// the accounts in quotaOfAcc use their own quotas instead of the global one
+func (acc2unc *Account2UnconfirmedTx) SetQuota(quota int, quotaOfAcc map[string]int) {
+	acc2unc.quota = quota
+	acc2unc.quotaOfAcc = quotaOfAcc
+}
+
+// IsExempted returns whether addr is not limited at all
+func (acc2unc *Account2UnconfirmedTx) IsExempted(addr sdk.AccAddress) bool {
+	_, ok := acc2unc.exempted[string(addr)]
+	return ok
+}
+
+func (acc2unc *Account2UnconfirmedTx) getQuota(addr sdk.AccAddress) int {
+	if quota, ok := acc2unc.quotaOfAcc[string(addr)]; ok {
+		return quota
+	}
+	return acc2unc.quota
+}
+
 func (acc2unc *Account2UnconfirmedTx) Lookup(addr sdk.AccAddress, hashid []byte, timestamp int64) int {
-	unconfirmedTx, ok := acc2unc.auMap[string(addr)]
-	expired := timestamp-unconfirmedTx.Timestamp > acc2unc.limitTime
-	if !ok || expired {
+	if acc2unc.IsExempted(addr) {
 		return NoTxExist
 	}
-	if bytes.Equal(unconfirmedTx.HashID, hashid) {
-		return SameTxExist
+	count := 0
+	for _, unconfirmedTx := range acc2unc.auMap[string(addr)] {
+		if timestamp-unconfirmedTx.Timestamp > acc2unc.limitTime {
+			continue
+		}
+		if bytes.Equal(unconfirmedTx.HashID, hashid) {
+			return SameTxExist
+		}
+		count++
 	}
-	return OtherTxExist
+	if count >= acc2unc.getQuota(addr) {
+		return OtherTxExist
+	}
+	return NoTxExist
 }
 
 func (acc2unc *Account2UnconfirmedTx) Add(addr sdk.AccAddress, hashid []byte, timestamp int64) {
-	acc2unc.auMap[string(addr)] = UnconfirmedTx{HashID: hashid, Timestamp: timestamp}
+	acc2unc.AddTx(addr, UnconfirmedTx{HashID: hashid, Timestamp: timestamp, GasPrice: sdk.ZeroDec()})
+}
+
+// AddTx tracks a tx of addr unless addr is exempted, the expired txs of addr are dropped at the same time
+func (acc2unc *Account2UnconfirmedTx) AddTx(addr sdk.AccAddress, tx UnconfirmedTx) {
+	if acc2unc.IsExempted(addr) {
+		return
+	}
+	txs := acc2unc.auMap[string(addr)]
+	newTxs := make([]UnconfirmedTx, 0, len(txs)+1)
+	for _, unconfirmedTx := range txs {
+		expired := tx.Timestamp-unconfirmedTx.Timestamp > acc2unc.limitTime
+		if !expired && !bytes.Equal(unconfirmedTx.HashID, tx.HashID) {
+			newTxs = append(newTxs, unconfirmedTx)
+		}
+	}
+	acc2unc.auMap[string(addr)] = append(newTxs, tx)
+}
+
+// FindReplaceable returns the tx with the lowest gas price among the ones tracked for all the signers which
+// the replacement is signed for, as told by signedFor, if its gas price is strictly lower than gasPrice.
+// The returned txs are the tracked ones of each signer.
+func (acc2unc *Account2UnconfirmedTx) FindReplaceable(signers []sdk.AccAddress, gasPrice sdk.Dec, timestamp int64,
+	signedFor func(txs []UnconfirmedTx) bool) ([]UnconfirmedTx, bool) {
+	if len(signers) == 0 {
+		return nil, false
+	}
+	var res []UnconfirmedTx
+	for _, candidate := range acc2unc.auMap[string(signers[0])] {
+		if timestamp-candidate.Timestamp > acc2unc.limitTime || candidate.restored || !candidate.GasPrice.LT(gasPrice) {
+			continue
+		}
+		if res != nil && !candidate.GasPrice.LT(res[0].GasPrice) {
+			continue
+		}
+		txs := []UnconfirmedTx{candidate}
+		for _, signer := range signers[1:] {
+			tx, ok := acc2unc.getTx(signer, candidate.HashID)
+			if !ok {
+				break
+			}
+			txs = append(txs, tx)
+		}
+		if len(txs) == len(signers) && signedFor(txs) {
+			res = txs
+		}
+	}
+	return res, res != nil
 }
 
-func (acc2unc *Account2UnconfirmedTx) AddToRemoveList(addrs []sdk.AccAddress) {
-	acc2unc.removeList = append(acc2unc.removeList, addrs...)
+func (acc2unc *Account2UnconfirmedTx) getTx(addr sdk.AccAddress, hashid []byte) (UnconfirmedTx, bool) {
+	for _, unconfirmedTx := range acc2unc.auMap[string(addr)] {
+		if bytes.Equal(unconfirmedTx.HashID, hashid) {
+			return unconfirmedTx, true
+		}
+	}
+	return UnconfirmedTx{}, false
+}
+
+// Replace stops tracking the old tx for the signers and tracks the new one instead, txs are the new tx
+// of each signer. The old tx is remembered as replaced until it is rechecked or expired.
+func (acc2unc *Account2UnconfirmedTx) Replace(signers []sdk.AccAddress, oldHashID []byte, txs []UnconfirmedTx) {
+	for i, signer := range signers {
+		acc2unc.remove(string(signer), oldHashID)
+		acc2unc.AddTx(signer, txs[i])
+	}
+	acc2unc.replaced[string(oldHashID)] = txs[0].Timestamp
+}
+
+// RemoveTx stops tracking the tx for all its signers at once, it is evicted from mempool
+func (acc2unc *Account2UnconfirmedTx) RemoveTx(addrs []sdk.AccAddress, hashid []byte) {
+	for _, addr := range addrs {
+		acc2unc.remove(string(addr), hashid)
+	}
+}
+
+// TakeReplaced returns whether the tx has been replaced, and forgets it since it will be evicted from mempool
+func (acc2unc *Account2UnconfirmedTx) TakeReplaced(hashid []byte) bool {
+	_, ok := acc2unc.replaced[string(hashid)]
+	delete(acc2unc.replaced, string(hashid))
+	return ok
+}
+
+// AddToRemoveList marks the tx as confirmed for all its signers, it is removed at CommitRemove
+func (acc2unc *Account2UnconfirmedTx) AddToRemoveList(addrs []sdk.AccAddress, hashid []byte) {
+	for _, addr := range addrs {
+		acc2unc.removeList = append(acc2unc.removeList, unconfirmedTxToRemove{addr: addr, hashid: hashid})
+	}
 }
 
 func (acc2unc *Account2UnconfirmedTx) CommitRemove(timestamp int64) {
-	for _, addr := range acc2unc.removeList {
-		s := string(addr)
-		delete(acc2unc.auMap, s) // will do nothing if key not existing
-	}
-	if timestamp-acc2unc.lastSweepTime > SweepPeriod {
-		for acc, unconfirmedTx := range acc2unc.auMap {
-			expired := timestamp-unconfirmedTx.Timestamp > acc2unc.limitTime
-			if expired {
+	for _, r := range acc2unc.removeList {
+		acc2unc.remove(string(r.addr), r.hashid)
+	}
+	acc2unc.dropRestored()
+	if timestamp-acc2unc.lastSweepTime > acc2unc.sweepPeriod {
+		for acc, txs := range acc2unc.auMap {
+			newTxs := txs[:0]
+			for _, unconfirmedTx := range txs {
+				expired := timestamp-unconfirmedTx.Timestamp > acc2unc.limitTime
+				if !expired {
+					newTxs = append(newTxs, unconfirmedTx)
+				}
+			}
+			if len(newTxs) == 0 {
 				delete(acc2unc.auMap, acc)
+			} else {
+				acc2unc.auMap[acc] = newTxs
+			}
+		}
+		for hashid, replacedTime := range acc2unc.replaced {
+			if timestamp-replacedTime > acc2unc.limitTime {
+				delete(acc2unc.replaced, hashid)
 			}
 		}
 		acc2unc.lastSweepTime = timestamp
 	}
 }
 
+// dropRestored drops the restored txs which are not checked again, at the second commit after they are loaded.
+// Tendermint does not keep the mempool over restarts, so the mempool is rechecked after the first commit without
+// them, unless they are sent to the node again.
+func (acc2unc *Account2UnconfirmedTx) dropRestored() {
+	if !acc2unc.hasRestored {
+		return
+	}
+	acc2unc.restoredCommits++
+	if acc2unc.restoredCommits < 2 {
+		return
+	}
+	for acc, txs := range acc2unc.auMap {
+		newTxs := txs[:0]
+		for _, unconfirmedTx := range txs {
+			if !unconfirmedTx.restored {
+				newTxs = append(newTxs, unconfirmedTx)
+			}
+		}
+		if len(newTxs) == 0 {
+			delete(acc2unc.auMap, acc)
+		} else {
+			acc2unc.auMap[acc] = newTxs
+		}
+	}
+	acc2unc.hasRestored = false
+}
+
+func (acc2unc *Account2UnconfirmedTx) remove(acc string, hashid []byte) {
+	txs, ok := acc2unc.auMap[acc]
+	if !ok {
+		return
+	}
+	for i, unconfirmedTx := range txs {
+		if bytes.Equal(unconfirmedTx.HashID, hashid) {
+			txs = append(txs[:i], txs[i+1:]...)
+			break
+		}
+	}
+	if len(txs) == 0 {
+		delete(acc2unc.auMap, acc)
+	} else {
+		acc2unc.auMap[acc] = txs
+	}
+}
+
 func (acc2unc *Account2UnconfirmedTx) ClearRemoveList() {
 	acc2unc.removeList = acc2unc.removeList[:0]
 }
+
+// RecordRejection counts a tx rejected at now, which is the wall clock time instead of the block time
+func (acc2unc *Account2UnconfirmedTx) RecordRejection(now int64) {
+	acc2unc.rejections.add(now)
+}
+
+func (acc2unc *Account2UnconfirmedTx) GetStats(now int64) UnconfirmedTxStats {
+	stats := UnconfirmedTxStats{
+		Enabled:             true,
+		TrackedAccounts:     len(acc2unc.auMap),
+		RejectionsPerMinute: acc2unc.rejections.lastMinute(now),
+		LastSweepTime:       acc2unc.lastSweepTime,
+	}
+	for _, txs := range acc2unc.auMap {
+		stats.TrackedTxs += len(txs)
+	}
+	return stats
+}
+
+type accountUnconfirmedTxs struct {
+	Address sdk.AccAddress  `json:"address"`
+	Txs     []UnconfirmedTx `json:"txs"`
+}
+
+type unconfirmedTxSnapshot struct {
+	BlockTime     int64                   `json:"block_time"`
+	LastSweepTime int64                   `json:"last_sweep_time"`
+	Accounts      []accountUnconfirmedTxs `json:"accounts"`
+}
+
+// SetSnapshotFile makes the tracker survive restarts: its state is loaded from file now and
+// saved to it by SaveSnapshot. The block time of the snapshot is returned. The loaded txs count against the
+// quotas until they expire, they are tracked again when CheckTx sees them, or dropped after the next recheck.
+func (acc2unc *Account2UnconfirmedTx) SetSnapshotFile(file string) (int64, error) {
+	acc2unc.snapshotFile = file
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var snapshot unconfirmedTxSnapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("invalid snapshot %s: %s", file, err.Error())
+	}
+	for _, acc := range snapshot.Accounts {
+		for i := range acc.Txs {
+			if acc.Txs[i].GasPrice.IsNil() {
+				acc.Txs[i].GasPrice = sdk.ZeroDec()
+			}
+			acc.Txs[i].restored = true
+			acc2unc.hasRestored = true
+		}
+		acc2unc.auMap[string(acc.Address)] = acc.Txs
+	}
+	acc2unc.lastSweepTime = snapshot.LastSweepTime
+	return snapshot.BlockTime, nil
+}
+
+// SaveSnapshot writes the tracked txs to the snapshot file, replacing the old one atomically
+func (acc2unc *Account2UnconfirmedTx) SaveSnapshot(blockTime int64) error {
+	if len(acc2unc.snapshotFile) == 0 {
+		return nil
+	}
+
+	snapshot := unconfirmedTxSnapshot{
+		BlockTime:     blockTime,
+		LastSweepTime: acc2unc.lastSweepTime,
+		Accounts:      make([]accountUnconfirmedTxs, 0, len(acc2unc.auMap)),
+	}
+	for acc, txs := range acc2unc.auMap {
+		snapshot.Accounts = append(snapshot.Accounts, accountUnconfirmedTxs{Address: sdk.AccAddress(acc), Txs: txs})
+	}
+	sort.Slice(snapshot.Accounts, func(i, j int) bool {
+		return bytes.Compare(snapshot.Accounts[i].Address, snapshot.Accounts[j].Address) < 0
+	})
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(path.Dir(acc2unc.snapshotFile), 0750); err != nil {
+		return err
+	}
+	tmpFile := acc2unc.snapshotFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, acc2unc.snapshotFile)
+}
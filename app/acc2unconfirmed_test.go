@@ -2,6 +2,9 @@ package app
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -50,8 +53,9 @@ func TestAccount2UnconfirmedTx(t *testing.T) {
 	//deliver tx
 	result := app.Deliver(tx)
 	require.Equal(t, errors.CodeOK, result.Code)
-	acc := app.account2UnconfirmedTx.removeList[0]
-	require.True(t, bytes.Equal(acc, fromAddr))
+	toRemove := app.account2UnconfirmedTx.removeList[0]
+	require.True(t, bytes.Equal(toRemove.addr, fromAddr))
+	require.True(t, bytes.Equal(toRemove.hashid, hashID))
 
 	//build another address tx
 	tx2 := newStdTxBuilder().
@@ -77,7 +81,11 @@ func TestAccount2UnconfirmedTx(t *testing.T) {
 	//end block
 	app.EndBlock(abci.RequestEndBlock{Height: 1})
 	app.Commit()
-	require.Equal(t, len(app.account2UnconfirmedTx.auMap), 0)
+	// only the delivered tx is removed
+	require.Equal(t, len(app.account2UnconfirmedTx.auMap), 1)
+	require.Equal(t, OtherTxExist, app.account2UnconfirmedTx.Lookup(fromAddr, hashID, header.Time.Unix()))
+	require.Equal(t, SameTxExist, app.account2UnconfirmedTx.Lookup(fromAddr, hashIDAnother, header.Time.Unix()))
+	app.account2UnconfirmedTx.auMap = make(map[string][]UnconfirmedTx)
 
 	//next block
 	header = abci.Header{Height: 2}
@@ -94,3 +102,321 @@ func TestAccount2UnconfirmedTx(t *testing.T) {
 	require.Equal(t, exist, NoTxExist)
 	app.account2UnconfirmedTx.Add(fromAddr, hashID3, header.Time.Unix())
 }
+
+func TestUnconfirmedTxQuota(t *testing.T) {
+	_, _, addr := testutil.KeyPubAddr()
+	_, _, addrMM := testutil.KeyPubAddr()
+	acc2unc := NewAccount2UnconfirmedTx(100)
+	acc2unc.SetQuota(2, map[string]int{string(addrMM): 3})
+
+	hashes := [][]byte{[]byte("tx1"), []byte("tx2"), []byte("tx3"), []byte("tx4")}
+	for i := 0; i < 2; i++ {
+		require.Equal(t, NoTxExist, acc2unc.Lookup(addr, hashes[i], 1000))
+		acc2unc.Add(addr, hashes[i], 1000)
+	}
+	require.Equal(t, SameTxExist, acc2unc.Lookup(addr, hashes[1], 1000))
+	require.Equal(t, OtherTxExist, acc2unc.Lookup(addr, hashes[2], 1000))
+	for i := 0; i < 3; i++ {
+		require.Equal(t, NoTxExist, acc2unc.Lookup(addrMM, hashes[i], 1000))
+		acc2unc.Add(addrMM, hashes[i], 1000)
+	}
+	require.Equal(t, OtherTxExist, acc2unc.Lookup(addrMM, hashes[3], 1000))
+
+	// a confirmed tx frees one place of its signers
+	acc2unc.AddToRemoveList([]sdk.AccAddress{addr, addrMM}, hashes[0])
+	acc2unc.CommitRemove(1000)
+	require.Equal(t, NoTxExist, acc2unc.Lookup(addr, hashes[2], 1000))
+	require.Equal(t, NoTxExist, acc2unc.Lookup(addrMM, hashes[3], 1000))
+	acc2unc.ClearRemoveList()
+
+	// the expired txs do not count
+	require.Equal(t, NoTxExist, acc2unc.Lookup(addr, hashes[1], 1101))
+	acc2unc.Add(addr, hashes[2], 1050)
+	acc2unc.Add(addr, hashes[3], 1101)
+	require.Equal(t, 2, len(acc2unc.auMap[string(addr)]))
+	require.Equal(t, OtherTxExist, acc2unc.Lookup(addr, hashes[0], 1101))
+
+	// sweep drops the expired txs and the accounts without txs
+	acc2unc.CommitRemove(1000 + SweepPeriod + 10)
+	require.Equal(t, 0, len(acc2unc.auMap))
+}
+
+func TestUnconfirmedTxSnapshot(t *testing.T) {
+	_, _, addr := testutil.KeyPubAddr()
+	dir, err := ioutil.TempDir("", "unconfirmed")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data", UnconfirmedTxSnapshotFile)
+
+	acc2unc := NewAccount2UnconfirmedTx(100)
+	blockTime, err := acc2unc.SetSnapshotFile(file)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), blockTime)
+	acc2unc.Add(addr, []byte("tx1"), 1000)
+	acc2unc.Add(addr, []byte("tx2"), 1010)
+	require.Nil(t, acc2unc.SaveSnapshot(1020))
+
+	restarted := NewAccount2UnconfirmedTx(100)
+	blockTime, err = restarted.SetSnapshotFile(file)
+	require.Nil(t, err)
+	require.Equal(t, int64(1020), blockTime)
+	require.Equal(t, 2, len(restarted.auMap[string(addr)]))
+	require.True(t, restarted.auMap[string(addr)][0].restored)
+
+	// the restored txs count against the quota until they expire, tx2 is tracked again when it is seen
+	require.Equal(t, OtherTxExist, restarted.Lookup(addr, []byte("tx3"), blockTime))
+	require.Equal(t, SameTxExist, restarted.Lookup(addr, []byte("tx2"), blockTime))
+	require.Equal(t, OtherTxExist, restarted.Lookup(addr, []byte("tx3"), 1105))
+	require.Equal(t, NoTxExist, restarted.Lookup(addr, []byte("tx3"), 1111))
+	restarted.Add(addr, []byte("tx2"), 1030)
+	require.Equal(t, OtherTxExist, restarted.Lookup(addr, []byte("tx3"), 1030))
+
+	// tx1 is not seen by the recheck after the first commit, and counts until then
+	restarted.CommitRemove(1030)
+	require.Equal(t, 2, len(restarted.auMap[string(addr)]))
+	restarted.SetQuota(2, nil)
+	require.Equal(t, OtherTxExist, restarted.Lookup(addr, []byte("tx3"), 1035))
+	restarted.CommitRemove(1040)
+	require.Equal(t, 1, len(restarted.auMap[string(addr)]))
+	require.Equal(t, []byte("tx2"), restarted.auMap[string(addr)][0].HashID)
+	require.Equal(t, NoTxExist, restarted.Lookup(addr, []byte("tx3"), 1040))
+	require.False(t, restarted.hasRestored)
+
+	require.Nil(t, ioutil.WriteFile(file, []byte("{"), 0600))
+	_, err = NewAccount2UnconfirmedTx(100).SetSnapshotFile(file)
+	require.NotNil(t, err)
+}
+
+func TestUnconfirmedTxStats(t *testing.T) {
+	_, _, addr := testutil.KeyPubAddr()
+	_, _, addrExempted := testutil.KeyPubAddr()
+	conf := DefaultUnconfirmedTxConfig()
+	conf.Exempted[string(addrExempted)] = struct{}{}
+	acc2unc := NewAccount2UnconfirmedTxWithConfig(conf)
+
+	acc2unc.Add(addr, []byte("tx1"), 1000)
+	for _, hashid := range [][]byte{[]byte("tx1"), []byte("tx2")} {
+		require.Equal(t, NoTxExist, acc2unc.Lookup(addrExempted, hashid, 1000))
+		acc2unc.Add(addrExempted, hashid, 1000)
+	}
+	acc2unc.RecordRejection(5000)
+	acc2unc.RecordRejection(5000)
+	acc2unc.RecordRejection(5030)
+	acc2unc.CommitRemove(1010)
+
+	stats := acc2unc.GetStats(5030)
+	require.True(t, stats.Enabled)
+	require.Equal(t, 1, stats.TrackedAccounts)
+	require.Equal(t, 1, stats.TrackedTxs)
+	require.Equal(t, int64(3), stats.RejectionsPerMinute)
+	require.Equal(t, int64(1010), stats.LastSweepTime)
+	require.Equal(t, int64(1), acc2unc.GetStats(5065).RejectionsPerMinute)
+	require.Equal(t, int64(0), acc2unc.GetStats(5090).RejectionsPerMinute)
+}
+
+func TestQueryUnconfirmedTxStats(t *testing.T) {
+	app := initAppWithBaseAccounts()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1, Time: time.Now()}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	res := app.Query(abci.RequestQuery{Path: "custom/" + UnconfirmedTxQuerierRoute + "/" + QueryUnconfirmedTxStats})
+	require.Equal(t, uint32(sdk.CodeOK), res.Code, res.Log)
+	var stats UnconfirmedTxStats
+	require.Nil(t, app.cdc.UnmarshalJSON(res.Value, &stats))
+	require.True(t, stats.Enabled)
+
+	res = app.Query(abci.RequestQuery{Path: "custom/" + UnconfirmedTxQuerierRoute + "/unknown"})
+	require.NotEqual(t, uint32(sdk.CodeOK), res.Code)
+}
+
+func TestReplaceUnconfirmedTxByFee(t *testing.T) {
+	_, _, toAddr := testutil.KeyPubAddr()
+	key, _, fromAddr := testutil.KeyPubAddr()
+	coins := sdk.NewCoins(sdk.NewInt64Coin("cet", 30000000000))
+	app := initAppWithBaseAccounts(auth.BaseAccount{Address: fromAddr, Coins: coins})
+	now := time.Now()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1, Time: now, ChainID: testChainID}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2, Time: now, ChainID: testChainID}})
+
+	msg := bankx.NewMsgSend(fromAddr, toAddr, dex.NewCetCoins(100000000), 0)
+	checkTx := func(tx auth.StdTx, checkType abci.CheckTxType) (sdk.CodeType, []byte) {
+		txBytes, _ := auth.DefaultTxEncoder(app.cdc)(tx)
+		res := app.CheckTx(abci.RequestCheckTx{Tx: txBytes, Type: checkType})
+		return sdk.CodeType(res.Code), tmtypes.Tx(txBytes).Hash()
+	}
+
+	lowFeeTx := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 1200000000).AccNumSeqKey(0, 0, key).Build()
+	code, lowFeeHash := checkTx(lowFeeTx, abci.CheckTxType_New)
+	require.Equal(t, sdk.CodeOK, code)
+
+	// the gas price must be strictly higher
+	sameFeeTx := newStdTxBuilder().Msgs(msg).GasAndFee(300000, 600000000).AccNumSeqKey(0, 0, key).Build()
+	code, _ = checkTx(sameFeeTx, abci.CheckTxType_New)
+	require.Equal(t, CodeTooManyUnconfirmedTx, code)
+	// the replacement must use the sequence of the replaced tx
+	wrongSeqTx := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 2400000000).AccNumSeqKey(0, 1, key).Build()
+	code, _ = checkTx(wrongSeqTx, abci.CheckTxType_New)
+	require.Equal(t, CodeTooManyUnconfirmedTx, code)
+	// the replacement must pass the ante handler, where the fee of the replaced tx has been deducted
+	overFeeTx := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 29000000000).AccNumSeqKey(0, 0, key).Build()
+	code, _ = checkTx(overFeeTx, abci.CheckTxType_New)
+	require.Equal(t, sdk.CodeInsufficientFunds, code)
+	checkCtx := app.NewContext(true, abci.Header{Height: 1})
+	app.msgRoutesKeeper.SetParams(checkCtx, MsgRoutesParams{DisabledMsgRoutes: []DisabledMsgRoute{
+		{Route: msg.Route(), Height: 1},
+	}})
+	highFeeTx := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 2400000000).AccNumSeqKey(0, 0, key).Build()
+	code, _ = checkTx(highFeeTx, abci.CheckTxType_New)
+	require.Equal(t, CodeMsgRouteDisabled, code)
+	app.msgRoutesKeeper.SetParams(checkCtx, MsgRoutesParams{})
+	// the sequences are set back only on the branch of the check state
+	require.Equal(t, []uint64{1}, app.getSequences([]sdk.AccAddress{fromAddr}))
+
+	code, highFeeHash := checkTx(highFeeTx, abci.CheckTxType_New)
+	require.Equal(t, sdk.CodeOK, code)
+	require.Equal(t, SameTxExist, app.account2UnconfirmedTx.Lookup(fromAddr, highFeeHash, now.Unix()))
+	require.Equal(t, 1, len(app.account2UnconfirmedTx.auMap[string(fromAddr)]))
+	require.Equal(t, []uint64{1}, app.getSequences([]sdk.AccAddress{fromAddr}))
+
+	// the replaced tx is evicted by the recheck after the next block
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+	code, _ = checkTx(lowFeeTx, abci.CheckTxType_Recheck)
+	require.Equal(t, CodeTxReplaced, code)
+	code, _ = checkTx(highFeeTx, abci.CheckTxType_Recheck)
+	require.Equal(t, sdk.CodeOK, code)
+	require.False(t, app.account2UnconfirmedTx.TakeReplaced(lowFeeHash))
+}
+
+func TestReplacedTxConfirmedFirst(t *testing.T) {
+	_, _, toAddr := testutil.KeyPubAddr()
+	key, _, fromAddr := testutil.KeyPubAddr()
+	coins := sdk.NewCoins(sdk.NewInt64Coin("cet", 30000000000))
+	app := initAppWithBaseAccounts(auth.BaseAccount{Address: fromAddr, Coins: coins})
+	now := time.Now()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1, Time: now, ChainID: testChainID}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2, Time: now, ChainID: testChainID}})
+
+	msg := bankx.NewMsgSend(fromAddr, toAddr, dex.NewCetCoins(100000000), 0)
+	encode := func(tx auth.StdTx) []byte {
+		txBytes, _ := auth.DefaultTxEncoder(app.cdc)(tx)
+		return txBytes
+	}
+	lowFeeTx := encode(newStdTxBuilder().Msgs(msg).GasAndFee(600000, 1200000000).AccNumSeqKey(0, 0, key).Build())
+	highFeeTx := encode(newStdTxBuilder().Msgs(msg).GasAndFee(600000, 2400000000).AccNumSeqKey(0, 0, key).Build())
+	require.True(t, app.CheckTx(abci.RequestCheckTx{Tx: lowFeeTx, Type: abci.CheckTxType_New}).IsOK())
+	require.True(t, app.CheckTx(abci.RequestCheckTx{Tx: highFeeTx, Type: abci.CheckTxType_New}).IsOK())
+
+	// the replaced tx is still in the mempool of the proposer, which includes it in the next block
+	require.True(t, app.DeliverTx(abci.RequestDeliverTx{Tx: lowFeeTx}).IsOK())
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+
+	// the replacement fails the recheck, and the signer is not blocked by it
+	res := app.CheckTx(abci.RequestCheckTx{Tx: highFeeTx, Type: abci.CheckTxType_Recheck})
+	require.Equal(t, uint32(sdk.CodeUnauthorized), res.Code)
+	_, ok := app.account2UnconfirmedTx.getTx(fromAddr, tmtypes.Tx(highFeeTx).Hash())
+	require.False(t, ok)
+	nextTx := encode(newStdTxBuilder().Msgs(msg).GasAndFee(600000, 1200000000).AccNumSeqKey(0, 1, key).Build())
+	require.True(t, app.CheckTx(abci.RequestCheckTx{Tx: nextTx, Type: abci.CheckTxType_New}).IsOK())
+}
+
+func TestReplaceOneOfUnconfirmedTxs(t *testing.T) {
+	_, _, toAddr := testutil.KeyPubAddr()
+	key, _, fromAddr := testutil.KeyPubAddr()
+	coins := sdk.NewCoins(sdk.NewInt64Coin("cet", 30000000000))
+	app := initAppWithBaseAccounts(auth.BaseAccount{Address: fromAddr, Coins: coins})
+	app.account2UnconfirmedTx.SetQuota(2, nil)
+	now := time.Now()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1, Time: now, ChainID: testChainID}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2, Time: now, ChainID: testChainID}})
+
+	msg := bankx.NewMsgSend(fromAddr, toAddr, dex.NewCetCoins(100000000), 0)
+	checkTx := func(tx auth.StdTx) (sdk.CodeType, []byte) {
+		txBytes, _ := auth.DefaultTxEncoder(app.cdc)(tx)
+		res := app.CheckTx(abci.RequestCheckTx{Tx: txBytes, Type: abci.CheckTxType_New})
+		return sdk.CodeType(res.Code), tmtypes.Tx(txBytes).Hash()
+	}
+
+	// two pending txs, the one with the higher sequence has the lower gas price
+	tx0 := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 1800000000).AccNumSeqKey(0, 0, key).Build()
+	code, hash0 := checkTx(tx0)
+	require.Equal(t, sdk.CodeOK, code)
+	tx1 := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 1200000000).AccNumSeqKey(0, 1, key).Build()
+	code, hash1 := checkTx(tx1)
+	require.Equal(t, sdk.CodeOK, code)
+
+	// the replacement of the tx with sequence 0 replaces it instead of the cheaper one
+	newTx0 := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 2400000000).AccNumSeqKey(0, 0, key).Build()
+	code, newHash0 := checkTx(newTx0)
+	require.Equal(t, sdk.CodeOK, code)
+	_, ok := app.account2UnconfirmedTx.getTx(fromAddr, hash0)
+	require.False(t, ok)
+	require.Equal(t, SameTxExist, app.account2UnconfirmedTx.Lookup(fromAddr, hash1, now.Unix()))
+	require.Equal(t, SameTxExist, app.account2UnconfirmedTx.Lookup(fromAddr, newHash0, now.Unix()))
+	require.True(t, app.account2UnconfirmedTx.TakeReplaced(hash0))
+
+	// a replacement signed with a sequence which is not pending is rejected
+	newTx2 := newStdTxBuilder().Msgs(msg).GasAndFee(600000, 2400000000).AccNumSeqKey(0, 2, key).Build()
+	code, _ = checkTx(newTx2)
+	require.Equal(t, CodeTooManyUnconfirmedTx, code)
+}
+
+func TestFindReplaceable(t *testing.T) {
+	_, _, addr1 := testutil.KeyPubAddr()
+	_, _, addr2 := testutil.KeyPubAddr()
+	acc2unc := NewAccount2UnconfirmedTx(100)
+	acc2unc.SetQuota(3, nil)
+	track := func(hashid string, price int64, seq uint64, signers ...sdk.AccAddress) {
+		for _, signer := range signers {
+			acc2unc.AddTx(signer, UnconfirmedTx{HashID: []byte(hashid), Timestamp: 1000,
+				GasPrice: sdk.NewDec(price), Sequence: seq})
+		}
+	}
+	track("tx1", 5, 1, addr1)
+	track("tx2", 3, 2, addr1, addr2)
+	track("tx3", 2, 3, addr1)
+	anySeq := func(txs []UnconfirmedTx) bool { return true }
+	signedWith := func(seq uint64) func(txs []UnconfirmedTx) bool {
+		return func(txs []UnconfirmedTx) bool { return txs[0].Sequence == seq }
+	}
+
+	old, ok := acc2unc.FindReplaceable([]sdk.AccAddress{addr1}, sdk.NewDec(4), 1000, anySeq)
+	require.True(t, ok)
+	require.Equal(t, []byte("tx3"), old[0].HashID)
+	old, ok = acc2unc.FindReplaceable([]sdk.AccAddress{addr1, addr2}, sdk.NewDec(4), 1000, anySeq)
+	require.True(t, ok)
+	require.Equal(t, 2, len(old))
+	require.Equal(t, []byte("tx2"), old[1].HashID)
+	_, ok = acc2unc.FindReplaceable([]sdk.AccAddress{addr1, addr2}, sdk.NewDec(3), 1000, anySeq)
+	require.False(t, ok)
+	_, ok = acc2unc.FindReplaceable([]sdk.AccAddress{addr1}, sdk.NewDec(4), 1101, anySeq)
+	require.False(t, ok)
+
+	// the tx signed with the same sequence is replaced, even if another one is cheaper
+	old, ok = acc2unc.FindReplaceable([]sdk.AccAddress{addr1}, sdk.NewDec(6), 1000, signedWith(1))
+	require.True(t, ok)
+	require.Equal(t, []byte("tx1"), old[0].HashID)
+	_, ok = acc2unc.FindReplaceable([]sdk.AccAddress{addr1}, sdk.NewDec(4), 1000, signedWith(1))
+	require.False(t, ok)
+	_, ok = acc2unc.FindReplaceable([]sdk.AccAddress{addr1}, sdk.NewDec(6), 1000, signedWith(4))
+	require.False(t, ok)
+
+	newTxs := []UnconfirmedTx{
+		{HashID: []byte("tx4"), Timestamp: 1000, GasPrice: sdk.NewDec(4), Sequence: 2},
+		{HashID: []byte("tx4"), Timestamp: 1000, GasPrice: sdk.NewDec(4), Sequence: 2},
+	}
+	acc2unc.Replace([]sdk.AccAddress{addr1, addr2}, []byte("tx2"), newTxs)
+	require.Equal(t, NoTxExist, acc2unc.Lookup(addr2, []byte("tx2"), 1000))
+	require.Equal(t, SameTxExist, acc2unc.Lookup(addr2, []byte("tx4"), 1000))
+	require.Equal(t, OtherTxExist, acc2unc.Lookup(addr1, []byte("tx2"), 1000))
+	require.True(t, acc2unc.TakeReplaced([]byte("tx2")))
+	require.False(t, acc2unc.TakeReplaced([]byte("tx2")))
+}
@@ -7,11 +7,9 @@ import (
 	"github.com/cosmos/cosmos-sdk/x/staking"
 
 	"github.com/coinexchain/cet-sdk/modules/authx"
-	"github.com/coinexchain/cet-sdk/modules/bancorlite"
 	"github.com/coinexchain/cet-sdk/modules/bankx"
 	"github.com/coinexchain/cet-sdk/modules/distributionx"
 	"github.com/coinexchain/cet-sdk/modules/incentive"
-	"github.com/coinexchain/cet-sdk/modules/market"
 	"github.com/coinexchain/cet-sdk/modules/stakingx"
 	"github.com/coinexchain/cet-sdk/types"
 )
@@ -19,62 +17,73 @@ import (
 var _ authx.AnteHelper = anteHelper{}
 
 type anteHelper struct {
-	accountXKeeper authx.AccountXKeeper
-	stakingXKeeper stakingx.Keeper
+	accountXKeeper  authx.AccountXKeeper
+	stakingXKeeper  stakingx.Keeper
+	msgRoutesKeeper msgRoutesKeeper
+	rules           *anteRules
 }
 
-func newAnteHelper(accountXKeeper authx.AccountXKeeper, stakingXKeeper stakingx.Keeper) anteHelper {
-	return anteHelper{
-		accountXKeeper: accountXKeeper,
-		stakingXKeeper: stakingXKeeper,
+func newAnteHelper(accountXKeeper authx.AccountXKeeper, stakingXKeeper stakingx.Keeper,
+	msgRoutesKeeper msgRoutesKeeper) anteHelper {
+	ah := anteHelper{
+		accountXKeeper:  accountXKeeper,
+		stakingXKeeper:  stakingXKeeper,
+		msgRoutesKeeper: msgRoutesKeeper,
+		rules:           newAnteRules(),
 	}
+	ah.registerRules()
+	return ah
 }
 
-func (ah anteHelper) CheckMsg(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
-	if err := checkAddr(msg); err != nil {
-		return err
-	}
-
-	switch msg := msg.(type) {
-	case bankx.MsgSend:
-		return ah.checkMemo(ctx, msg.ToAddress, memo)
-
-	case bankx.MsgSupervisedSend:
-		return ah.checkMemo(ctx, msg.ToAddress, memo)
-
-	case bankx.MsgMultiSend:
-		for _, out := range msg.Outputs {
+// registerRules registers the rules of the app, the ones of the other modules are added by RegisterAnteRule
+func (ah anteHelper) registerRules() {
+	ah.rules.RegisterGlobal(AnteRule{Name: "signer_not_incentive_pool", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return checkAddr(msg)
+	}})
+	ah.rules.RegisterGlobal(AnteRule{Name: "msg_route_enabled", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return ah.msgRoutesKeeper.CheckMsgRoute(ctx, msg.Route())
+	}})
+
+	ah.rules.Register(bankx.MsgSend{}, AnteRule{Name: "memo_required", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return ah.checkMemo(ctx, msg.(bankx.MsgSend).ToAddress, memo)
+	}})
+	ah.rules.Register(bankx.MsgSupervisedSend{}, AnteRule{Name: "memo_required", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return ah.checkMemo(ctx, msg.(bankx.MsgSupervisedSend).ToAddress, memo)
+	}})
+	ah.rules.Register(bankx.MsgMultiSend{}, AnteRule{Name: "memo_required", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		for _, out := range msg.(bankx.MsgMultiSend).Outputs {
 			if err := ah.checkMemo(ctx, out.Address, memo); err != nil {
 				return err
 			}
 		}
 		return nil
-
-	case staking.MsgCreateValidator:
-		return ah.checkMsgCreateValidator(ctx, msg)
-
-	case staking.MsgEditValidator:
-		return ah.checkMsgEditValidator(ctx, msg.CommissionRate)
-
-	case distribution.MsgSetWithdrawAddress:
-		if ah.memoRequired(ctx, msg.WithdrawAddress) {
-			return distributionx.ErrMemoRequiredWithdrawAddr(msg.WithdrawAddress.String())
+	}})
+
+	ah.rules.Register(staking.MsgCreateValidator{}, AnteRule{Name: "min_self_delegation", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return ah.checkMinSelfDelegation(ctx, msg.(staking.MsgCreateValidator).MinSelfDelegation)
+	}})
+	ah.rules.Register(staking.MsgCreateValidator{}, AnteRule{Name: "min_commission_rate", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return ah.checkMinMandatoryCommissionRate(ctx, msg.(staking.MsgCreateValidator).Commission.Rate)
+	}})
+	ah.rules.Register(staking.MsgEditValidator{}, AnteRule{Name: "min_commission_rate", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return ah.checkMsgEditValidator(ctx, msg.(staking.MsgEditValidator).CommissionRate)
+	}})
+
+	ah.rules.Register(distribution.MsgSetWithdrawAddress{}, AnteRule{Name: "memo_required", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		addr := msg.(distribution.MsgSetWithdrawAddress).WithdrawAddress
+		if ah.memoRequired(ctx, addr) {
+			return distributionx.ErrMemoRequiredWithdrawAddr(addr.String())
 		}
 		return nil
+	}})
 
-	case gov.MsgDeposit:
-		return ah.checkMsgDeposit(msg)
-
-	case bancorlite.MsgBancorInit, bancorlite.MsgBancorTrade, bancorlite.MsgBancorCancel,
-		market.MsgCreateTradingPair, market.MsgModifyPricePrecision, market.MsgCancelTradingPair,
-		market.MsgCreateOrder, market.MsgCancelOrder:
-		if ctx.BlockHeight() >= Dex3StartHeight {
-			return sdk.NewError("DEX3", Dex3StartHeight,
-				"market module and bancor module are disabled")
-		}
-	}
+	ah.rules.Register(gov.MsgDeposit{}, AnteRule{Name: "deposit_cet_only", Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return ah.checkMsgDeposit(msg.(gov.MsgDeposit))
+	}})
+}
 
-	return nil
+func (ah anteHelper) CheckMsg(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+	return ah.rules.Check(ctx, msg, memo)
 }
 
 func (ah anteHelper) checkMsgEditValidator(ctx sdk.Context, newRate *sdk.Dec) sdk.Error {
@@ -85,14 +94,6 @@ func (ah anteHelper) checkMsgEditValidator(ctx sdk.Context, newRate *sdk.Dec) sd
 	return ah.checkMinMandatoryCommissionRate(ctx, *newRate)
 }
 
-func (ah anteHelper) checkMsgCreateValidator(ctx sdk.Context, msg staking.MsgCreateValidator) sdk.Error {
-	if err := ah.checkMinSelfDelegation(ctx, msg.MinSelfDelegation); err != nil {
-		return err
-	}
-
-	return ah.checkMinMandatoryCommissionRate(ctx, msg.Commission.Rate)
-}
-
 func (ah anteHelper) checkMemo(ctx sdk.Context, addr sdk.AccAddress, memo string) sdk.Error {
 	if ax, ok := ah.accountXKeeper.GetAccountX(ctx, addr); ok && ax.MemoRequired {
 		if len(memo) == 0 {
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// AllMsgs is the msg type of the rules checking every msg in the query result
+const AllMsgs = "*"
+
+// AnteCheck returns an error to reject the tx with msg, it must not write the state
+type AnteCheck func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error
+
+// AnteRule is a named check of the msgs of a type in the txs, run by the ante handler
+type AnteRule struct {
+	Name  string
+	Check AnteCheck
+}
+
+// AnteRuleSet is the names of the rules of a msg type, which is the route and type of the msg, or AllMsgs
+type AnteRuleSet struct {
+	MsgType string   `json:"msg_type"`
+	Rules   []string `json:"rules"`
+}
+
+type AnteRuleSets []AnteRuleSet
+
+func (sets AnteRuleSets) String() string {
+	var sb strings.Builder
+	sb.WriteString("Ante Rules:\n")
+	for _, set := range sets {
+		sb.WriteString(fmt.Sprintf("  %s: %s\n", set.MsgType, strings.Join(set.Rules, ", ")))
+	}
+	return sb.String()
+}
+
+// anteRules runs the rules of all the msgs, then the ones of the msg type, in the order they are registered.
+// The rules are registered before the app starts, and all the nodes must have the same rules.
+type anteRules struct {
+	global []AnteRule
+	byType map[reflect.Type][]AnteRule
+	// the msgs registered first for their types, to get their routes and types in the query
+	msgs map[reflect.Type]sdk.Msg
+}
+
+func newAnteRules() *anteRules {
+	return &anteRules{
+		byType: make(map[reflect.Type][]AnteRule),
+		msgs:   make(map[reflect.Type]sdk.Msg),
+	}
+}
+
+// RegisterGlobal adds a rule of all the msgs, it panics if the name is taken by another one
+func (r *anteRules) RegisterGlobal(rule AnteRule) {
+	r.global = appendAnteRule(r.global, rule, AllMsgs)
+}
+
+// Register adds a rule of the msgs of the same type as msg, it panics if the name is taken by another rule of
+// the type
+func (r *anteRules) Register(msg sdk.Msg, rule AnteRule) {
+	t := reflect.TypeOf(msg)
+	if _, ok := r.msgs[t]; !ok {
+		r.msgs[t] = msg
+	}
+	r.byType[t] = appendAnteRule(r.byType[t], rule, msgType(msg))
+}
+
+func appendAnteRule(rules []AnteRule, rule AnteRule, msgType string) []AnteRule {
+	if len(rule.Name) == 0 || rule.Check == nil {
+		panic(fmt.Sprintf("invalid ante rule %s of %s", rule.Name, msgType))
+	}
+	for _, other := range rules {
+		if other.Name == rule.Name {
+			panic(fmt.Sprintf("ante rule %s of %s is registered twice", rule.Name, msgType))
+		}
+	}
+	return append(rules, rule)
+}
+
+// Check returns the error of the first rule rejecting msg
+func (r *anteRules) Check(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+	for _, rule := range r.global {
+		if err := rule.Check(ctx, msg, memo); err != nil {
+			return err
+		}
+	}
+	for _, rule := range r.byType[reflect.TypeOf(msg)] {
+		if err := rule.Check(ctx, msg, memo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RuleSets returns the rules of all the msgs first, then the ones of each msg type in the order of the type
+func (r *anteRules) RuleSets() AnteRuleSets {
+	sets := AnteRuleSets{{MsgType: AllMsgs, Rules: anteRuleNames(r.global)}}
+	typed := make(AnteRuleSets, 0, len(r.byType))
+	for t, rules := range r.byType {
+		typed = append(typed, AnteRuleSet{MsgType: msgType(r.msgs[t]), Rules: anteRuleNames(rules)})
+	}
+	sort.Slice(typed, func(i, j int) bool { return typed[i].MsgType < typed[j].MsgType })
+	return append(sets, typed...)
+}
+
+func anteRuleNames(rules []AnteRule) []string {
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+func msgType(msg sdk.Msg) string {
+	return msg.Route() + "/" + msg.Type()
+}
+
+// RegisterAnteRule adds a rule of the msgs of the same type as msg to the ante handler. It must be called
+// before the app starts.
+func (app *CetChainApp) RegisterAnteRule(msg sdk.Msg, name string, check AnteCheck) {
+	app.anteHelper.rules.Register(msg, AnteRule{Name: name, Check: check})
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/gov"
+
+	"github.com/coinexchain/cet-sdk/modules/bankx"
+)
+
+func TestAnteRules(t *testing.T) {
+	var called []string
+	rule := func(name string, err sdk.Error) AnteRule {
+		return AnteRule{Name: name, Check: func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+			called = append(called, name)
+			return err
+		}}
+	}
+	rules := newAnteRules()
+	rules.RegisterGlobal(rule("g1", nil))
+	rules.Register(bankx.MsgSend{}, rule("s1", nil))
+	rules.Register(bankx.MsgSend{}, rule("s2", sdk.ErrUnauthorized("s2")))
+	rules.Register(bankx.MsgSend{}, rule("s3", nil))
+	rules.Register(gov.MsgDeposit{}, rule("s1", nil))
+
+	ctx := sdk.Context{}
+	require.Equal(t, sdk.ErrUnauthorized("s2"), rules.Check(ctx, bankx.MsgSend{}, ""))
+	require.Equal(t, []string{"g1", "s1", "s2"}, called)
+	called = nil
+	require.Nil(t, rules.Check(ctx, bankx.MsgMultiSend{}, ""))
+	require.Equal(t, []string{"g1"}, called)
+
+	require.Panics(t, func() { rules.Register(bankx.MsgSend{}, rule("s1", nil)) })
+	require.Panics(t, func() { rules.RegisterGlobal(rule("g1", nil)) })
+	require.Panics(t, func() { rules.Register(bankx.MsgSend{}, AnteRule{Name: "s4"}) })
+
+	require.Equal(t, AnteRuleSets{
+		{MsgType: AllMsgs, Rules: []string{"g1"}},
+		{MsgType: "bankx/send", Rules: []string{"s1", "s2", "s3"}},
+		{MsgType: "gov/deposit", Rules: []string{"s1"}},
+	}, rules.RuleSets())
+}
+
+func TestQueryAnteRules(t *testing.T) {
+	app := initAppWithBaseAccounts()
+	app.RegisterAnteRule(gov.MsgDeposit{}, "min_deposit", func(ctx sdk.Context, msg sdk.Msg, memo string) sdk.Error {
+		return nil
+	})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 1, ChainID: testChainID}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	res := app.Query(abci.RequestQuery{Path: fmt.Sprintf("custom/%s/%s", MsgRoutesQuerierRoute, QueryAnteRules)})
+	require.Equal(t, uint32(sdk.CodeOK), res.Code)
+	var sets AnteRuleSets
+	require.Nil(t, app.cdc.UnmarshalJSON(res.Value, &sets))
+	rules := make(map[string][]string)
+	for _, set := range sets {
+		rules[set.MsgType] = set.Rules
+	}
+	require.Equal(t, []string{"signer_not_incentive_pool", "msg_route_enabled"}, rules[AllMsgs])
+	require.Equal(t, []string{"memo_required"}, rules["bankx/send"])
+	require.Equal(t, []string{"min_self_delegation", "min_commission_rate"}, rules["staking/create_validator"])
+	require.Equal(t, []string{"deposit_cet_only", "min_deposit"}, rules["gov/deposit"])
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/cosmos/cosmos-sdk/client/flags"
 	"github.com/cosmos/cosmos-sdk/server"
 	"github.com/spf13/viper"
 
@@ -49,7 +52,9 @@ import (
 	"github.com/coinexchain/cet-sdk/modules/supplyx"
 	"github.com/coinexchain/cet-sdk/msgqueue"
 	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
 	"github.com/coinexchain/dex/app/plugin"
+	"github.com/coinexchain/dex/app/sink"
 	tserver "github.com/coinexchain/trade-server/server"
 )
 
@@ -57,9 +62,6 @@ const (
 	appName = "CoinExChainApp"
 	// DefaultKeyPass contains the default key password for genesis transactions
 	DefaultKeyPass = "12345678"
-
-	// TODO
-	Dex3StartHeight = 100000000
 )
 
 // default home directories for expected binaries
@@ -97,6 +99,7 @@ func init() {
 		comment.AppModuleBasic{},
 		incentive.AppModuleBasic{},
 		market.AppModuleBasic{},
+		MsgRoutesModuleBasic{},
 
 		//modules wraps those of cosmos
 		authx.AppModuleBasic{}, //before `bank` to override `/bank/balances/{address}`
@@ -138,6 +141,10 @@ type CetChainApp struct {
 	txDecoder sdk.TxDecoder // unmarshal []byte into sdk.Tx
 	txCount   int64
 	height    int64
+	header    abci.Header // header of the block being executed
+	// header of the check state, which is the one of the last committed block, or empty after a restart
+	checkHeader abci.Header
+	anteHandler sdk.AnteHandler
 
 	invCheckPeriod uint
 
@@ -183,6 +190,10 @@ type CetChainApp struct {
 	msgQueProducer  msgqueue.MsgSender
 	aliasKeeper     alias.Keeper
 	commentKeeper   comment.Keeper
+	msgRoutesKeeper msgRoutesKeeper
+	upgradeHandlers map[int64]Upgrade
+	upgradeSubspace params.Subspace
+	anteHelper      anteHelper
 	ts              *tserver.TradeServer
 	once            *sync.Once
 
@@ -193,7 +204,10 @@ type CetChainApp struct {
 	// the module manager
 	mm *module.Manager
 
-	pubMsgs []PubMsg
+	pubMsgs         []PubMsg
+	pubMsgWAL       *sink.WAL
+	touchedAccounts touchedAccounts
+	blockStats      blockStats
 	plugin.Holder
 }
 
@@ -213,18 +227,21 @@ func NewCetChainApp(logger log.Logger, db dbm.DB, traceStore io.Writer, loadLate
 	app.initPubMsgBuf()
 	app.initMsgQue()
 	app.initKeepers(invCheckPeriod)
+	app.initMsgRoutes()
+	app.anteHelper = newAnteHelper(app.accountXKeeper, app.stakingXKeeper, app.msgRoutesKeeper)
+	app.initUpgrades()
 	app.initModules()
 	app.mountStores()
 
-	app.WaitPluginToggleSignal(logger)
+	app.InitPluginHolder(logger)
 
-	ah := authx.NewAnteHandler(app.accountKeeper, app.supplyKeeper, app.accountXKeeper,
-		newAnteHelper(app.accountXKeeper, app.stakingXKeeper))
+	app.anteHandler = authx.NewAnteHandler(app.accountKeeper, app.supplyKeeper, app.accountXKeeper, app.anteHelper)
 
 	app.SetInitChainer(app.initChainer)
 	app.SetBeginBlocker(app.beginBlocker)
-	app.SetAnteHandler(ah)
+	app.SetAnteHandler(app.anteHandler)
 	app.SetEndBlocker(app.endBlocker)
+	app.initUnconfirmedTxLimit()
 
 	if loadLatest {
 		err := app.LoadLatestVersion(app.keyMain)
@@ -233,24 +250,58 @@ func NewCetChainApp(logger log.Logger, db dbm.DB, traceStore io.Writer, loadLate
 		}
 	}
 
-	unconfirmedTxLimitTime, ok := os.LookupEnv("COINEX_UNCONFIRMED_TX_LIMIT_TIME")
-	var limitTime int64
-	var err error
-	if ok {
-		limitTime, err = strconv.ParseInt(unconfirmedTxLimitTime, 10, 64)
-		if err != nil {
-			limitTime = -1
+	return app
+}
+
+// initUnconfirmedTxLimit configures the unconfirmed-tx tracker by the [unconfirmed-tx] section of app.toml,
+// the node refuses to start with invalid values
+func (app *CetChainApp) initUnconfirmedTxLimit() {
+	conf, err := LoadUnconfirmedTxConfig()
+	if err != nil {
+		cmn.Exit(fmt.Sprintf("invalid unconfirmed-tx config in app.toml, %s", err.Error()))
+	}
+	if _, ok := os.LookupEnv(EnvUnconfirmedLimitTime); ok {
+		if viper.IsSet(FlagUnconfirmedLimitTime) {
+			app.Logger().Error(fmt.Sprintf("%s is deprecated and ignored, %s in app.toml is used",
+				EnvUnconfirmedLimitTime, FlagUnconfirmedLimitTime))
+		} else {
+			app.Logger().Error(fmt.Sprintf("%s is deprecated, set %s in app.toml instead",
+				EnvUnconfirmedLimitTime, FlagUnconfirmedLimitTime))
 		}
-	} else {
-		limitTime = DefaultLimitTime
 	}
-	if limitTime > 0 {
-		app.enableUnconfirmedLimit = true
-		app.account2UnconfirmedTx = NewAccount2UnconfirmedTx(limitTime)
-	} else {
+	app.QueryRouter().AddRoute(UnconfirmedTxQuerierRoute, app.queryUnconfirmedTx)
+	if conf.LimitTime == 0 {
 		app.enableUnconfirmedLimit = false
+		return
 	}
-	return app
+	app.enableUnconfirmedLimit = true
+	app.account2UnconfirmedTx = NewAccount2UnconfirmedTxWithConfig(conf)
+
+	rootDir := viper.GetString(flags.FlagHome)
+	if len(rootDir) == 0 {
+		return
+	}
+	file := filepath.Join(rootDir, "data", UnconfirmedTxSnapshotFile)
+	blockTime, err := app.account2UnconfirmedTx.SetSnapshotFile(file)
+	if err != nil {
+		app.Logger().Error(fmt.Sprintf("load unconfirmed txs failed, %s", err.Error()))
+	}
+	app.currBlockTime = blockTime
+}
+
+func (app *CetChainApp) queryUnconfirmedTx(ctx sdk.Context, path []string, req abci.RequestQuery) ([]byte, sdk.Error) {
+	if len(path) == 0 || path[0] != QueryUnconfirmedTxStats {
+		return nil, sdk.ErrUnknownRequest(fmt.Sprintf("unknown unconfirmed-tx query endpoint: %s", strings.Join(path, "/")))
+	}
+	var stats UnconfirmedTxStats
+	if app.enableUnconfirmedLimit {
+		stats = app.account2UnconfirmedTx.GetStats(time.Now().Unix())
+	}
+	bz, err := codec.MarshalJSONIndent(app.cdc, stats)
+	if err != nil {
+		return nil, sdk.ErrInternal(err.Error())
+	}
+	return bz, nil
 }
 
 func newCetChainApp(bApp *bam.BaseApp, cdc *codec.Codec, invCheckPeriod uint, txDecoder sdk.TxDecoder) *CetChainApp {
@@ -281,7 +332,22 @@ func newCetChainApp(bApp *bam.BaseApp, cdc *codec.Codec, invCheckPeriod uint, tx
 }
 
 func (app *CetChainApp) initMsgQue() {
-	app.msgQueProducer = msgqueue.NewProducer(app.Logger()) // TODO
+	sinks, err := sink.LoadSinks()
+	if err != nil {
+		panic(fmt.Sprintf("open pubmsg sinks failed, err : %s", err.Error()))
+	}
+	app.msgQueProducer = sink.NewSender(msgqueue.NewProducer(app.Logger()), sinks, app.Logger())
+	if conf, ok := sink.AsyncConfigFromConfig(); ok && app.msgQueProducer.IsOpenToggle() {
+		if app.msgQueProducer, err = sink.NewAsyncSender(app.msgQueProducer, conf, app.Logger()); err != nil {
+			panic(fmt.Sprintf("open pubmsg async sender failed, err : %s", err.Error()))
+		}
+	}
+	if app.msgQueProducer.IsOpenToggle() {
+		app.pubMsgWAL, err = sink.OpenWAL(sink.WALDirFromConfig(), viper.GetInt64(sink.FlagWALKeepHeights))
+		if err != nil {
+			panic(fmt.Sprintf("open pubmsg WAL failed, err : %s", err.Error()))
+		}
+	}
 	if isOpenTs() {
 		conf, err := initConf()
 		if err != nil {
@@ -339,7 +405,7 @@ func (app *CetChainApp) initKeepers(invCheckPeriod uint) {
 	// register the proposal types
 	govRouter := gov.NewRouter()
 	govRouter.AddRoute(gov.RouterKey, gov.ProposalHandler).
-		AddRoute(params.RouterKey, params.NewParamChangeProposalHandler(app.paramsKeeper)).
+		AddRoute(params.RouterKey, app.newParamChangeProposalHandler()).
 		AddRoute(distr.RouterKey, distr.NewCommunityPoolSpendProposalHandler(app.distrKeeper))
 
 	app.govKeeper = gov.NewKeeper(
@@ -489,6 +555,7 @@ func (app *CetChainApp) initModules() {
 	app.mm.SetOrderExportGenesis(initGenesisOrder...)
 
 	app.crisisKeeper.RegisterRoute(authx.ModuleName, "pre-total-supply", authx.PreTotalSupplyInvariant(app.accountXKeeper))
+	app.crisisKeeper.RegisterRoute(MsgRoutesParamspace, "shutdown", app.shutdownInvariant)
 	app.mm.RegisterInvariants(&app.crisisKeeper)
 
 	app.registerRoutesWithOrder(modules)
@@ -516,6 +583,7 @@ func (app *CetChainApp) createAppModules() []module.AppModule {
 		genutil.NewAppModule(app.accountKeeper, app.stakingKeeper, app.BaseApp.DeliverTx),
 		alias.NewAppModule(app.aliasKeeper),
 		comment.NewAppModule(app.commentKeeper),
+		module.NewGenesisOnlyAppModule(msgRoutesAppModule{keeper: app.msgRoutesKeeper}),
 	}
 }
 
@@ -540,6 +608,7 @@ func getAppModuleInitOrder() []string {
 		genutil.ModuleName, //call DeliverGenTxs in genutil at last
 		alias.ModuleName,
 		comment.ModuleName,
+		MsgRoutesParamspace,
 	}
 }
 
@@ -570,48 +639,55 @@ func (app *CetChainApp) mountStores() {
 // application updates every begin block
 func (app *CetChainApp) beginBlocker(ctx sdk.Context, req abci.RequestBeginBlock) abci.ResponseBeginBlock {
 	app.height = ctx.BlockHeight()
+	app.header = ctx.BlockHeader()
 	app.resetPubMsgBuf()
 	if app.msgQueProducer.IsOpenToggle() {
+		app.touchedAccounts = make(touchedAccounts)
 		app.txCount = req.Header.TotalTxs - req.Header.NumTxs
 		app.pushNewHeightInfo(ctx)
 	}
+	app.haltForUpgrade(ctx)
+	app.runUpgrade(ctx)
 	ret := app.mm.BeginBlock(ctx, req)
 	if app.msgQueProducer.IsOpenToggle() {
+		app.resetBlockStats(ctx)
 		ret.Events = collectKafkaEvents(ret.Events, app)
-		app.notifyBeginBlock(ret.Events)
+		app.notifyBeginBlock(ctx, ret.Events)
 	}
 	if app.enableUnconfirmedLimit {
 		app.currBlockTime = req.Header.Time.Unix()
 		app.account2UnconfirmedTx.ClearRemoveList()
 	}
-	if ctx.BlockHeight() == Dex3StartHeight {
-		app.cancelAllBancors(ctx)
-	}
+	app.msgRoutesKeeper.Shutdown(ctx)
+	app.NotifyObservers(func(o plugin.AppObserver) {
+		var res abci.ResponseBeginBlock
+		copyProto(&res, &ret)
+		o.OnBeginBlock(copyHeader(app.header), res)
+	})
 	return ret
 }
 
-func (app *CetChainApp) cancelAllBancors(ctx sdk.Context) {
-	k := app.bancorKeeper
-	for _, bi := range app.bancorKeeper.GetAllBancorInfos(ctx) {
-		k.Remove(ctx, bi)
-		// ignore errors
-		if err := k.UnFreezeCoins(ctx, bi.Owner, sdk.NewCoins(sdk.NewCoin(bi.Stock, bi.StockInPool))); err != nil {
-			app.Logger().Error(err.Error())
-		}
-		if err := k.UnFreezeCoins(ctx, bi.Owner, sdk.NewCoins(sdk.NewCoin(bi.Money, bi.MoneyInPool))); err != nil {
-			app.Logger().Error(err.Error())
-		}
-	}
-}
-
 // application updates every end block
 // nolint: unparam
 func (app *CetChainApp) endBlocker(ctx sdk.Context, req abci.RequestEndBlock) abci.ResponseEndBlock {
+	var matured maturedEntries
+	var lastPowers lastValidatorPowers
+	if app.msgQueProducer.IsOpenToggle() {
+		matured = app.collectMaturedEntries(ctx)
+		lastPowers = app.collectLastValidatorPowers(ctx)
+	}
 	ret := app.mm.EndBlock(ctx, req)
 	if app.msgQueProducer.IsOpenToggle() {
 		ret.Events = collectKafkaEvents(ret.Events, app)
-		app.notifyEndBlock(ret.Events)
-	}
+		app.notifyEndBlock(ctx, ret.Events, matured)
+		app.notifyValidatorSetUpdate(ctx, ret.ValidatorUpdates, lastPowers)
+		app.notifyAccountsTouched(ctx.BlockHeight())
+	}
+	app.NotifyObservers(func(o plugin.AppObserver) {
+		var res abci.ResponseEndBlock
+		copyProto(&res, &ret)
+		o.OnEndBlock(copyHeader(app.header), res)
+	})
 	return ret
 }
 
@@ -623,6 +699,7 @@ func (app *CetChainApp) initChainer(ctx sdk.Context, req abci.RequestInitChain)
 	if err := ModuleBasics.ValidateGenesis(genesisState); err != nil {
 		panic(err)
 	}
+	app.checkHeader = ctx.BlockHeader()
 	return app.mm.InitGenesis(ctx, genesisState)
 }
 
@@ -662,10 +739,8 @@ func (app *CetChainApp) appendPubMsgKV(key string, val []byte) {
 /* "override" ABCI methods */
 
 func (app *CetChainApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
-	if p := app.GetPlugin(); p != nil {
-		if err := p.PreCheckTx(req, app.txDecoder, app.Logger()); err != nil {
-			return dex.ResponseFrom(err)
-		}
+	if err := app.RunPreCheckTx(req, app.txDecoder); err != nil {
+		return dex.ResponseFrom(err)
 	}
 
 	if !app.enableUnconfirmedLimit {
@@ -691,8 +766,12 @@ func (app *CetChainApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
 		}
 	}
 
-	otherTxExist := false
 	hashid := tmtypes.Tx(req.Tx).Hash()
+	if req.Type == abci.CheckTxType_Recheck && app.account2UnconfirmedTx.TakeReplaced(hashid) {
+		return dex.ResponseFrom(errTxReplaced)
+	}
+
+	otherTxExist := false
 	signers := stdTx.GetSigners()
 	for _, signer := range signers {
 		res := app.account2UnconfirmedTx.Lookup(signer, hashid, app.currBlockTime)
@@ -702,14 +781,32 @@ func (app *CetChainApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
 		}
 	}
 
+	gasPrice := getGasPrice(stdTx)
 	if otherTxExist {
+		if req.Type == abci.CheckTxType_New {
+			old, ok := app.account2UnconfirmedTx.FindReplaceable(signers, gasPrice, app.currBlockTime,
+				app.signedFor(stdTx, signers))
+			if ok {
+				return app.replaceUnconfirmedTx(req, stdTx, hashid, signers, gasPrice, old)
+			}
+		}
+		app.account2UnconfirmedTx.RecordRejection(time.Now().Unix())
 		return dex.ResponseFrom(errTooManyUnconfirmedTx)
 	}
+	sequences := app.getSequences(signers)
 	ret := app.BaseApp.CheckTx(req)
 	if ret.IsOK() {
-		for _, signer := range signers {
-			app.account2UnconfirmedTx.Add(signer, hashid, app.currBlockTime)
+		for i, signer := range signers {
+			app.account2UnconfirmedTx.AddTx(signer, UnconfirmedTx{
+				HashID:    hashid,
+				Timestamp: app.currBlockTime,
+				GasPrice:  gasPrice,
+				Sequence:  sequences[i],
+			})
 		}
+	} else if req.Type == abci.CheckTxType_Recheck {
+		// the tx is evicted from mempool, such as a replacement whose replaced tx has been confirmed
+		app.account2UnconfirmedTx.RemoveTx(signers, hashid)
 	}
 	return ret
 }
@@ -726,9 +823,14 @@ func (app *CetChainApp) DeliverTx(req abci.RequestDeliverTx) abci.ResponseDelive
 		formatOK = false
 	}
 
+	var feeCollectorCoins sdk.Coins
+	if app.msgQueProducer.IsOpenToggle() {
+		feeCollectorCoins = app.getFeeCollectorCoins(app.NewContext(false, app.header))
+	}
 	ret := app.BaseApp.DeliverTx(req)
 
 	if app.msgQueProducer.IsOpenToggle() {
+		app.addTxToBlockStats(stdTx, feeCollectorCoins, ret)
 		if formatOK {
 			app.notifyTx(req, stdTx, ret)
 		}
@@ -741,20 +843,62 @@ func (app *CetChainApp) DeliverTx(req abci.RequestDeliverTx) abci.ResponseDelive
 
 	if formatOK && app.enableUnconfirmedLimit {
 		signers := stdTx.GetSigners()
-		app.account2UnconfirmedTx.AddToRemoveList(signers)
+		app.account2UnconfirmedTx.AddToRemoveList(signers, tmtypes.Tx(req.Tx).Hash())
+	}
+	if formatOK {
+		app.NotifyObservers(func(o plugin.AppObserver) {
+			tx, _ := app.txDecoder(req.Tx)
+			var res abci.ResponseDeliverTx
+			copyProto(&res, &ret)
+			o.OnDeliverTx(copyHeader(app.header), tx.(auth.StdTx), res)
+		})
 	}
 	return ret
 }
 
+// Commit sends the pub messages of the block after the state is committed, so that block_summary has the app
+// hash after the block. The messages of a block are lost if the node crashes before they are written to the WAL.
 func (app *CetChainApp) Commit() abci.ResponseCommit {
+	var summary notify.NotificationBlockSummary
 	if app.msgQueProducer.IsOpenToggle() {
-		for _, msg := range app.pubMsgs {
-			app.msgQueProducer.SendMsg(msg.Key, msg.Value)
-		}
-		app.msgQueProducer.SendMsg([]byte("commit"), []byte("{}"))
+		summary = app.newBlockSummary()
 	}
 	if app.enableUnconfirmedLimit {
 		app.account2UnconfirmedTx.CommitRemove(app.currBlockTime)
+		if err := app.account2UnconfirmedTx.SaveSnapshot(app.currBlockTime); err != nil {
+			app.Logger().Error(fmt.Sprintf("save unconfirmed txs failed, %s", err.Error()))
+		}
+	}
+	ret := app.BaseApp.Commit()
+	if app.msgQueProducer.IsOpenToggle() {
+		app.pushBlockSummary(summary, ret.Data)
+		app.sendPubMsgs()
 	}
-	return app.BaseApp.Commit()
+	app.checkHeader = app.header
+	app.NotifyObservers(func(o plugin.AppObserver) {
+		o.OnCommit(copyHeader(app.header), abci.ResponseCommit{Data: append([]byte(nil), ret.Data...)})
+	})
+	return ret
+}
+
+type protoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// copyProto deep copies src to dst, so that an observer can not change what is returned to tendermint
+func copyProto(dst, src protoMessage) {
+	bz, err := src.Marshal()
+	if err != nil {
+		panic(err)
+	}
+	if err = dst.Unmarshal(bz); err != nil {
+		panic(err)
+	}
+}
+
+func copyHeader(header abci.Header) abci.Header {
+	var res abci.Header
+	copyProto(&res, &header)
+	return res
 }
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	abci "github.com/tendermint/tendermint/abci/types"
-	cmn "github.com/tendermint/tendermint/libs/common"
 	tmtypes "github.com/tendermint/tendermint/types"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
@@ -17,69 +16,54 @@ import (
 	stypes "github.com/cosmos/cosmos-sdk/x/staking/types"
 
 	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
 )
 
-type TxExtraInfo struct {
-	Code      uint32       `json:"code,omitempty"`
-	Data      []byte       `json:"data,omitempty"`
-	Log       string       `json:"log,omitempty"`
-	Info      string       `json:"info,omitempty"`
-	GasWanted int64        `json:"gas_wanted,omitempty"`
-	GasUsed   int64        `json:"gas_used,omitempty"`
-	Events    []abci.Event `json:"events,omitempty"`
-	Codespace string       `json:"codespace,omitempty"`
-}
-
-type NewHeightInfo struct {
-	ChainID       string       `json:"chain_id"`
-	Height        int64        `json:"height"`
-	TimeStamp     int64        `json:"timestamp"`
-	LastBlockHash cmn.HexBytes `json:"last_block_hash"`
-}
+// The notification messages are defined in package notify, which is imported by their consumers
+type (
+	TxExtraInfo                      = notify.TxExtraInfo
+	NewHeightInfo                    = notify.NewHeightInfo
+	TransferRecord                   = notify.TransferRecord
+	NotificationTx                   = notify.NotificationTx
+	NotificationBeginRedelegation    = notify.NotificationBeginRedelegation
+	NotificationBeginUnbonding       = notify.NotificationBeginUnbonding
+	NotificationCompleteRedelegation = notify.NotificationCompleteRedelegation
+	NotificationCompleteUnbonding    = notify.NotificationCompleteUnbonding
+	NotificationSlash                = notify.NotificationSlash
+	NotificationValidatorCommission  = notify.NotificationValidatorCommission
+	NotificationDelegatorRewards     = notify.NotificationDelegatorRewards
+)
 
 func (app *CetChainApp) pushNewHeightInfo(ctx sdk.Context) {
 	msg := NewHeightInfo{
+		Version:       notify.SchemaVersion,
 		ChainID:       ctx.BlockHeader().ChainID,
 		Height:        ctx.BlockHeight(),
 		TimeStamp:     ctx.BlockHeader().Time.Unix(),
 		LastBlockHash: ctx.BlockHeader().LastBlockId.Hash,
 	}
 	bytes := dex.SafeJSONMarshal(msg)
-	app.appendPubMsgKV("height_info", bytes)
-}
-
-type TransferRecord struct {
-	Sender    string `json:"sender"`
-	Recipient string `json:"recipient"`
-	Amount    string `json:"amount"`
+	app.appendPubMsgKV(notify.KeyHeightInfo, bytes)
 }
 
-type NotificationTx struct {
-	Signers      []sdk.AccAddress `json:"signers"`
-	Transfers    []TransferRecord `json:"transfers"`
-	SerialNumber int64            `json:"serial_number"`
-	MsgTypes     []string         `json:"msg_types"`
-	TxJSON       string           `json:"tx_json"`
-	Height       int64            `json:"height"`
-	Hash         []byte           `json:"hash"`
-	ExtraInfo    string           `json:"extra_info,omitempty"`
-}
-
-func getTransferRecord(dualEvent []abci.Event) TransferRecord {
-	var res TransferRecord
-	for _, attr := range dualEvent[0].Attributes {
-		if string(attr.Key) == "recipient" {
-			res.Recipient = string(attr.Value)
-		} else if string(attr.Key) == "amount" {
-			res.Amount = string(attr.Value)
+func getEventAttr(event abci.Event, key string) string {
+	for _, attr := range event.Attributes {
+		if string(attr.Key) == key {
+			return string(attr.Value)
 		}
 	}
-	for _, attr := range dualEvent[1].Attributes {
-		if string(attr.Key) == sdk.AttributeKeySender {
-			res.Sender = string(attr.Value)
+	return ""
+}
+
+// getModuleSender returns the sender of the msg which emits the event at i, from the message event of the
+// module following it
+func getModuleSender(events []abci.Event, i int, module string) string {
+	for ; i < len(events); i++ {
+		if events[i].Type == sdk.EventTypeMessage && getEventAttr(events[i], sdk.AttributeKeyModule) == module {
+			return getEventAttr(events[i], sdk.AttributeKeySender)
 		}
 	}
-	return res
+	return ""
 }
 
 func getType(myvar interface{}) string {
@@ -92,26 +76,17 @@ func getType(myvar interface{}) string {
 
 func (app *CetChainApp) notifyTx(req abci.RequestDeliverTx, stdTx auth.StdTx, ret abci.ResponseDeliverTx) {
 	events := ret.Events
-	transfers := make([]TransferRecord, 0, 10)
 	ok := ret.Code == uint32(sdk.CodeOK)
-	unbondingMsgList := make([][]byte, 0, 10)
-	redelegationMsgList := make([][]byte, 0, 10)
+	unbondings := make([]NotificationBeginUnbonding, 0, 10)
+	redelegations := make([]NotificationBeginRedelegation, 0, 10)
 	for i := 0; ok && i < len(events); i++ {
-		if events[i].Type == stypes.EventTypeUnbond {
-			if i+1 <= len(events) {
-				val := getNotificationBeginUnbonding(events[i : i+2])
-				unbondingMsgList = append(unbondingMsgList, val)
-				i++
-			}
-		} else if events[i].Type == stypes.EventTypeRedelegate {
-			if i+1 <= len(events) {
-				val := getNotificationBeginRedelegation(events[i : i+2])
-				redelegationMsgList = append(redelegationMsgList, val)
-				i++
-			}
-		} else if events[i].Type == "transfer" && i+2 <= len(events) {
-			val := getTransferRecord(events[i : i+2])
-			transfers = append(transfers, val)
+		if events[i].Type == stypes.EventTypeUnbond && i+2 <= len(events) {
+			val := getNotificationBeginUnbonding(events[i : i+2])
+			unbondings = append(unbondings, val)
+			i++
+		} else if events[i].Type == stypes.EventTypeRedelegate && i+2 <= len(events) {
+			val := getNotificationBeginRedelegation(events[i : i+2])
+			redelegations = append(redelegations, val)
 			i++
 		}
 	}
@@ -120,6 +95,13 @@ func (app *CetChainApp) notifyTx(req abci.RequestDeliverTx, stdTx auth.StdTx, re
 		app.txCount++
 	}()
 
+	transfers := make([]TransferRecord, 0)
+	if ok {
+		transfers = getTransferRecords(stdTx.Msgs, events)
+	}
+	txHash := tmtypes.Tx(req.Tx).Hash()
+	app.touchTxAccounts(stdTx, txHash, ok, transfers)
+
 	msgTypes := make([]string, len(stdTx.Msgs))
 	for i, msg := range stdTx.Msgs {
 		msgTypes[i] = getType(msg)
@@ -131,13 +113,14 @@ func (app *CetChainApp) notifyTx(req abci.RequestDeliverTx, stdTx auth.StdTx, re
 	}
 
 	n4s := &NotificationTx{
+		Version:      notify.SchemaVersion,
 		Signers:      stdTx.GetSigners(),
 		Transfers:    transfers,
 		SerialNumber: app.txCount,
 		TxJSON:       string(bytes),
 		MsgTypes:     msgTypes,
 		Height:       app.height,
-		Hash:         tmtypes.Tx(req.Tx).Hash(),
+		Hash:         txHash,
 	}
 
 	if ret.Code != uint32(sdk.CodeOK) {
@@ -162,25 +145,29 @@ func (app *CetChainApp) notifyTx(req abci.RequestDeliverTx, stdTx auth.StdTx, re
 		return
 	}
 
-	app.appendPubMsgKV("notify_tx", bytes)
-	for _, val := range unbondingMsgList {
-		app.appendPubMsgKV("begin_unbonding", val)
+	app.appendPubMsgKV(notify.KeyNotifyTx, bytes)
+	if ok {
+		app.notifyValidatorTx(events)
+		app.notifyGovTx(events)
 	}
-	for _, val := range redelegationMsgList {
-		app.appendPubMsgKV("begin_redelegation", val)
+	if len(unbondings) == 0 && len(redelegations) == 0 {
+		return
+	}
+	ctx := app.NewContext(false, app.header)
+	app.setUnbondingEntries(ctx, unbondings)
+	app.setRedelegationEntries(ctx, redelegations)
+	for _, val := range unbondings {
+		app.appendPubMsgKV(notify.KeyBeginUnbonding, dex.SafeJSONMarshal(val))
+	}
+	for _, val := range redelegations {
+		app.appendPubMsgKV(notify.KeyBeginRedelegation, dex.SafeJSONMarshal(val))
 	}
 }
 
-type NotificationBeginRedelegation struct {
-	Delegator      string `json:"delegator"`
-	ValidatorSrc   string `json:"src"`
-	ValidatorDst   string `json:"dst"`
-	Amount         string `json:"amount"`
-	CompletionTime int64  `json:"completion_time"`
-}
-
-func getNotificationBeginRedelegation(dualEvent []abci.Event) []byte {
-	var res NotificationBeginRedelegation
+// getNotificationBeginRedelegation returns the notification without the entry, which is set by
+// setRedelegationEntries. A zero completion time means the redelegation completes at once.
+func getNotificationBeginRedelegation(dualEvent []abci.Event) NotificationBeginRedelegation {
+	res := NotificationBeginRedelegation{Version: notify.SchemaVersion}
 	for _, attr := range dualEvent[0].Attributes {
 		if string(attr.Key) == stypes.AttributeKeySrcValidator {
 			res.ValidatorSrc = string(attr.Value)
@@ -188,9 +175,14 @@ func getNotificationBeginRedelegation(dualEvent []abci.Event) []byte {
 			res.ValidatorDst = string(attr.Value)
 		} else if string(attr.Key) == sdk.AttributeKeyAmount {
 			res.Amount = string(attr.Value)
+			res.Coins = parseBondCoins(res.Amount)
 		} else if string(attr.Key) == stypes.AttributeKeyCompletionTime {
-			if tmp, err := time.Parse(time.RFC3339, string(attr.Value)); err != nil {
-				res.CompletionTime = tmp.Unix()
+			if tmp, err := time.Parse(time.RFC3339, string(attr.Value)); err == nil {
+				if tmp.IsZero() {
+					res.CompleteNow = true
+				} else {
+					res.CompletionTime = tmp.Unix()
+				}
 			}
 		}
 	}
@@ -199,25 +191,20 @@ func getNotificationBeginRedelegation(dualEvent []abci.Event) []byte {
 			res.Delegator = string(attr.Value)
 		}
 	}
-	return dex.SafeJSONMarshal(res)
-}
-
-type NotificationBeginUnbonding struct {
-	Delegator      string `json:"delegator"`
-	Validator      string `json:"validator"`
-	Amount         string `json:"amount"`
-	CompletionTime int64  `json:"completion_time"`
+	return res
 }
 
-func getNotificationBeginUnbonding(dualEvent []abci.Event) []byte {
-	var res NotificationBeginUnbonding
+// getNotificationBeginUnbonding returns the notification without the entry, which is set by setUnbondingEntries
+func getNotificationBeginUnbonding(dualEvent []abci.Event) NotificationBeginUnbonding {
+	res := NotificationBeginUnbonding{Version: notify.SchemaVersion}
 	for _, attr := range dualEvent[0].Attributes {
 		if string(attr.Key) == stypes.AttributeKeyValidator {
 			res.Validator = string(attr.Value)
 		} else if string(attr.Key) == sdk.AttributeKeyAmount {
 			res.Amount = string(attr.Value)
+			res.Coins = parseBondCoins(res.Amount)
 		} else if string(attr.Key) == stypes.AttributeKeyCompletionTime {
-			if tmp, err := time.Parse(time.RFC3339, string(attr.Value)); err != nil {
+			if tmp, err := time.Parse(time.RFC3339, string(attr.Value)); err == nil {
 				res.CompletionTime = tmp.Unix()
 			}
 		}
@@ -227,17 +214,196 @@ func getNotificationBeginUnbonding(dualEvent []abci.Event) []byte {
 			res.Delegator = string(attr.Value)
 		}
 	}
-	return dex.SafeJSONMarshal(res)
+	return res
 }
 
-type NotificationCompleteRedelegation struct {
-	Delegator    string `json:"delegator"`
-	ValidatorSrc string `json:"src"`
-	ValidatorDst string `json:"dst"`
+// parseBondCoins parses the amount of the bond denom in the staking events
+func parseBondCoins(amount string) sdk.Coins {
+	amt, ok := sdk.NewIntFromString(amount)
+	if !ok || amt.IsNegative() {
+		return nil
+	}
+	return sdk.NewCoins(sdk.NewCoin(dex.CET, amt))
+}
+
+// entryOrdinal returns how many entries before the i-th one have the same creation height and completion time
+func entryOrdinal(i int, entryKey func(j int) (int64, int64)) int {
+	height, completionTime := entryKey(i)
+	ordinal := 0
+	for j := 0; j < i; j++ {
+		if h, t := entryKey(j); h == height && t == completionTime {
+			ordinal++
+		}
+	}
+	return ordinal
 }
 
-func getNotificationCompleteRedelegation(event abci.Event) []byte {
-	var res NotificationCompleteRedelegation
+// setUnbondingEntries sets the entries created by a tx to its notifications. The entries are appended to the
+// unbonding delegations, so those of a delegator and a validator are the last ones, in the order of the events.
+func (app *CetChainApp) setUnbondingEntries(ctx sdk.Context, notifications []NotificationBeginUnbonding) {
+	created := make(map[string]int, len(notifications))
+	for _, n := range notifications {
+		created[n.Delegator+"/"+n.Validator]++
+	}
+	for i := range notifications {
+		n := &notifications[i]
+		key := n.Delegator + "/" + n.Validator
+		later := created[key] - 1
+		created[key] = later
+
+		delAddr, err := sdk.AccAddressFromBech32(n.Delegator)
+		if err != nil {
+			continue
+		}
+		valAddr, err := sdk.ValAddressFromBech32(n.Validator)
+		if err != nil {
+			continue
+		}
+		ubd, found := app.stakingKeeper.GetUnbondingDelegation(ctx, delAddr, valAddr)
+		idx := len(ubd.Entries) - 1 - later
+		if !found || idx < 0 {
+			continue
+		}
+		entryKey := func(j int) (int64, int64) {
+			return ubd.Entries[j].CreationHeight, ubd.Entries[j].CompletionTime.Unix()
+		}
+		n.CreationHeight, n.CompletionTime = entryKey(idx)
+		n.EntryID = notify.UnbondingEntryID(n.Delegator, n.Validator, n.CreationHeight, n.CompletionTime,
+			entryOrdinal(idx, entryKey))
+	}
+}
+
+// setRedelegationEntries sets the entries created by a tx to its notifications like setUnbondingEntries,
+// the redelegations completed at once have no entries.
+func (app *CetChainApp) setRedelegationEntries(ctx sdk.Context, notifications []NotificationBeginRedelegation) {
+	created := make(map[string]int, len(notifications))
+	for _, n := range notifications {
+		if !n.CompleteNow {
+			created[n.Delegator+"/"+n.ValidatorSrc+"/"+n.ValidatorDst]++
+		}
+	}
+	for i := range notifications {
+		n := &notifications[i]
+		if n.CompleteNow {
+			continue
+		}
+		key := n.Delegator + "/" + n.ValidatorSrc + "/" + n.ValidatorDst
+		later := created[key] - 1
+		created[key] = later
+
+		delAddr, err := sdk.AccAddressFromBech32(n.Delegator)
+		if err != nil {
+			continue
+		}
+		srcAddr, err := sdk.ValAddressFromBech32(n.ValidatorSrc)
+		if err != nil {
+			continue
+		}
+		dstAddr, err := sdk.ValAddressFromBech32(n.ValidatorDst)
+		if err != nil {
+			continue
+		}
+		red, found := app.stakingKeeper.GetRedelegation(ctx, delAddr, srcAddr, dstAddr)
+		idx := len(red.Entries) - 1 - later
+		if !found || idx < 0 {
+			continue
+		}
+		entryKey := func(j int) (int64, int64) {
+			return red.Entries[j].CreationHeight, red.Entries[j].CompletionTime.Unix()
+		}
+		n.CreationHeight, n.CompletionTime = entryKey(idx)
+		n.EntryID = notify.RedelegationEntryID(n.Delegator, n.ValidatorSrc, n.ValidatorDst,
+			n.CreationHeight, n.CompletionTime, entryOrdinal(idx, entryKey))
+	}
+}
+
+// maturedEntries are the unbonding and redelegation entries completed in a block, keyed by
+// "delegator/validator" and "delegator/src/dst"
+type maturedEntries map[string][]notify.CompletedEntry
+
+// collectMaturedEntries finds the entries which the staking module is going to complete in EndBlock, the
+// same way it does, before they are removed
+func (app *CetChainApp) collectMaturedEntries(ctx sdk.Context) maturedEntries {
+	k := app.stakingKeeper
+	now := ctx.BlockHeader().Time
+	bondDenom := k.BondDenom(ctx)
+	res := make(maturedEntries)
+
+	ubdIter := k.UBDQueueIterator(ctx, now)
+	for ; ubdIter.Valid(); ubdIter.Next() {
+		var pairs []stypes.DVPair
+		app.cdc.MustUnmarshalBinaryLengthPrefixed(ubdIter.Value(), &pairs)
+		for _, pair := range pairs {
+			del, val := pair.DelegatorAddress.String(), pair.ValidatorAddress.String()
+			if _, ok := res[del+"/"+val]; ok {
+				continue
+			}
+			ubd, found := k.GetUnbondingDelegation(ctx, pair.DelegatorAddress, pair.ValidatorAddress)
+			if !found {
+				continue
+			}
+			entryKey := func(j int) (int64, int64) {
+				return ubd.Entries[j].CreationHeight, ubd.Entries[j].CompletionTime.Unix()
+			}
+			entries := make([]notify.CompletedEntry, 0, len(ubd.Entries))
+			for i, entry := range ubd.Entries {
+				if !entry.IsMature(now) {
+					continue
+				}
+				height, completionTime := entryKey(i)
+				entries = append(entries, notify.CompletedEntry{
+					EntryID:        notify.UnbondingEntryID(del, val, height, completionTime, entryOrdinal(i, entryKey)),
+					CreationHeight: height,
+					CompletionTime: completionTime,
+					Coins:          sdk.NewCoins(sdk.NewCoin(bondDenom, entry.Balance)),
+				})
+			}
+			res[del+"/"+val] = entries
+		}
+	}
+	ubdIter.Close()
+
+	redIter := k.RedelegationQueueIterator(ctx, now)
+	for ; redIter.Valid(); redIter.Next() {
+		var triplets []stypes.DVVTriplet
+		app.cdc.MustUnmarshalBinaryLengthPrefixed(redIter.Value(), &triplets)
+		for _, triplet := range triplets {
+			del, src, dst := triplet.DelegatorAddress.String(), triplet.ValidatorSrcAddress.String(),
+				triplet.ValidatorDstAddress.String()
+			if _, ok := res[del+"/"+src+"/"+dst]; ok {
+				continue
+			}
+			red, found := k.GetRedelegation(ctx, triplet.DelegatorAddress, triplet.ValidatorSrcAddress,
+				triplet.ValidatorDstAddress)
+			if !found {
+				continue
+			}
+			entryKey := func(j int) (int64, int64) {
+				return red.Entries[j].CreationHeight, red.Entries[j].CompletionTime.Unix()
+			}
+			entries := make([]notify.CompletedEntry, 0, len(red.Entries))
+			for i, entry := range red.Entries {
+				if !entry.IsMature(now) {
+					continue
+				}
+				height, completionTime := entryKey(i)
+				entries = append(entries, notify.CompletedEntry{
+					EntryID: notify.RedelegationEntryID(del, src, dst, height, completionTime,
+						entryOrdinal(i, entryKey)),
+					CreationHeight: height,
+					CompletionTime: completionTime,
+					Coins:          sdk.NewCoins(sdk.NewCoin(bondDenom, entry.InitialBalance)),
+				})
+			}
+			res[del+"/"+src+"/"+dst] = entries
+		}
+	}
+	redIter.Close()
+	return res
+}
+
+func getNotificationCompleteRedelegation(event abci.Event, matured maturedEntries) []byte {
+	res := NotificationCompleteRedelegation{Version: notify.SchemaVersion}
 	for _, attr := range event.Attributes {
 		if string(attr.Key) == stypes.AttributeKeyDstValidator {
 			res.ValidatorDst = string(attr.Value)
@@ -245,37 +411,31 @@ func getNotificationCompleteRedelegation(event abci.Event) []byte {
 			res.ValidatorSrc = string(attr.Value)
 		} else if string(attr.Key) == stypes.AttributeKeyDelegator {
 			res.Delegator = string(attr.Value)
+		} else if string(attr.Key) == sdk.AttributeKeyAmount {
+			res.Coins, _ = sdk.ParseCoins(string(attr.Value))
 		}
 	}
+	res.Entries = matured[res.Delegator+"/"+res.ValidatorSrc+"/"+res.ValidatorDst]
 	return dex.SafeJSONMarshal(res)
 }
 
-type NotificationCompleteUnbonding struct {
-	Delegator string `json:"delegator"`
-	Validator string `json:"validator"`
-}
-
-func getNotificationCompleteUnbonding(event abci.Event) []byte {
-	var res NotificationCompleteUnbonding
+func getNotificationCompleteUnbonding(event abci.Event, matured maturedEntries) []byte {
+	res := NotificationCompleteUnbonding{Version: notify.SchemaVersion}
 	for _, attr := range event.Attributes {
 		if string(attr.Key) == stypes.AttributeKeyValidator {
 			res.Validator = string(attr.Value)
 		} else if string(attr.Key) == stypes.AttributeKeyDelegator {
 			res.Delegator = string(attr.Value)
+		} else if string(attr.Key) == sdk.AttributeKeyAmount {
+			res.Coins, _ = sdk.ParseCoins(string(attr.Value))
 		}
 	}
+	res.Entries = matured[res.Delegator+"/"+res.Validator]
 	return dex.SafeJSONMarshal(res)
 }
 
-type NotificationSlash struct {
-	Validator string `json:"validator"`
-	Power     string `json:"power"`
-	Reason    string `json:"reason"`
-	Jailed    bool   `json:"jailed"`
-}
-
 func getNotificationSlash(event abci.Event) []byte {
-	var res NotificationSlash
+	res := NotificationSlash{Version: notify.SchemaVersion}
 	for _, attr := range event.Attributes {
 		if string(attr.Key) == sltypes.AttributeKeyAddress {
 			res.Validator = string(attr.Value)
@@ -290,7 +450,7 @@ func getNotificationSlash(event abci.Event) []byte {
 	return dex.SafeJSONMarshal(res)
 }
 
-func (app *CetChainApp) notifyBeginBlock(events []abci.Event) {
+func (app *CetChainApp) notifyBeginBlock(ctx sdk.Context, events []abci.Event) {
 	//fmt.Printf("========== BeginBlock events ============\n")
 	subscribedDistr := app.msgQueProducer.IsSubscribed(distr.ModuleName)
 	for _, event := range events {
@@ -300,18 +460,20 @@ func (app *CetChainApp) notifyBeginBlock(events []abci.Event) {
 		//}
 		if event.Type == sltypes.EventTypeSlash {
 			val := getNotificationSlash(event)
-			app.appendPubMsgKV("slash", val)
+			app.appendPubMsgKV(notify.KeySlash, val)
 		} else if subscribedDistr && event.Type == distrtypes.EventTypeCommission {
 			val := getValidatorCommissionMsg(event)
-			app.appendPubMsgKV("validator_commission", val)
+			app.appendPubMsgKV(notify.KeyValidatorCommission, val)
 		} else if subscribedDistr && event.Type == distrtypes.EventTypeRewards {
 			val := getDelegatorRewardsMsg(event)
-			app.appendPubMsgKV("delegator_rewards", val)
+			app.appendPubMsgKV(notify.KeyDelegatorRewards, val)
 		}
 	}
+	app.notifyValidatorJailed(ctx, events)
+	app.touchBlockAccounts(events)
 }
 
-func (app *CetChainApp) notifyEndBlock(events []abci.Event) {
+func (app *CetChainApp) notifyEndBlock(ctx sdk.Context, events []abci.Event, matured maturedEntries) {
 	//fmt.Printf("========== EndBlock events ============\n")
 	for _, event := range events {
 		//fmt.Printf("= Event: %s\n", event.Type)
@@ -319,22 +481,19 @@ func (app *CetChainApp) notifyEndBlock(events []abci.Event) {
 		//	fmt.Printf("= K: %s; V: %s\n", attr.Key, attr.Value)
 		//}
 		if event.Type == stypes.EventTypeCompleteUnbonding {
-			val := getNotificationCompleteUnbonding(event)
-			app.appendPubMsgKV("complete_unbonding", val)
+			val := getNotificationCompleteUnbonding(event, matured)
+			app.appendPubMsgKV(notify.KeyCompleteUnbonding, val)
 		} else if event.Type == stypes.EventTypeCompleteRedelegation {
-			val := getNotificationCompleteRedelegation(event)
-			app.appendPubMsgKV("complete_redelegation", val)
+			val := getNotificationCompleteRedelegation(event, matured)
+			app.appendPubMsgKV(notify.KeyCompleteRedelegation, val)
 		}
 	}
-}
-
-type NotificationValidatorCommission struct {
-	Validator  string `json:"validator"`
-	Commission string `json:"commission"`
+	app.notifyGovEndBlock(ctx, events)
+	app.touchBlockAccounts(events)
 }
 
 func getValidatorCommissionMsg(event abci.Event) []byte {
-	var res NotificationValidatorCommission
+	res := NotificationValidatorCommission{Version: notify.SchemaVersion}
 	for _, attr := range event.Attributes {
 		if string(attr.Key) == distrtypes.AttributeKeyValidator {
 			res.Validator = string(attr.Value)
@@ -345,13 +504,8 @@ func getValidatorCommissionMsg(event abci.Event) []byte {
 	return dex.SafeJSONMarshal(res)
 }
 
-type NotificationDelegatorRewards struct {
-	Validator string `json:"validator"`
-	Rewards   string `json:"rewards"`
-}
-
 func getDelegatorRewardsMsg(event abci.Event) []byte {
-	var res NotificationDelegatorRewards
+	res := NotificationDelegatorRewards{Version: notify.SchemaVersion}
 	for _, attr := range event.Attributes {
 		if string(attr.Key) == distrtypes.AttributeKeyValidator {
 			res.Validator = string(attr.Value)
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"bytes"
+	"sort"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	distr "github.com/cosmos/cosmos-sdk/x/distribution"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+	stypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+type touchedAccount struct {
+	txHashes []cmn.HexBytes
+	reasons  []string
+}
+
+// touchedAccounts collects the accounts touched in a block, keyed by the bech32 addresses
+type touchedAccounts map[string]*touchedAccount
+
+func (ta touchedAccounts) touch(addr string, txHash cmn.HexBytes, reason string) {
+	// nil if msgqueue is toggled on in the middle of the block
+	if ta == nil || len(addr) == 0 {
+		return
+	}
+	acc, ok := ta[addr]
+	if !ok {
+		acc = &touchedAccount{}
+		ta[addr] = acc
+	}
+	if len(txHash) != 0 && (len(acc.txHashes) == 0 || !bytes.Equal(acc.txHashes[len(acc.txHashes)-1], txHash)) {
+		acc.txHashes = append(acc.txHashes, txHash)
+	}
+	for _, r := range acc.reasons {
+		if r == reason {
+			return
+		}
+	}
+	acc.reasons = append(acc.reasons, reason)
+}
+
+func (ta touchedAccounts) touchTransfers(transfers []TransferRecord, txHash cmn.HexBytes, rewardSender string) {
+	for _, transfer := range transfers {
+		ta.touch(transfer.Sender, txHash, notify.ReasonSender)
+		if transfer.Sender == rewardSender {
+			ta.touch(transfer.Recipient, txHash, notify.ReasonRewardRecipient)
+		} else {
+			ta.touch(transfer.Recipient, txHash, notify.ReasonRecipient)
+		}
+	}
+}
+
+// getMsgDelegator returns the delegator of the staking and distribution msgs
+func getMsgDelegator(msg sdk.Msg) sdk.AccAddress {
+	switch msg := msg.(type) {
+	case staking.MsgCreateValidator:
+		return msg.DelegatorAddress
+	case staking.MsgDelegate:
+		return msg.DelegatorAddress
+	case staking.MsgUndelegate:
+		return msg.DelegatorAddress
+	case staking.MsgBeginRedelegate:
+		return msg.DelegatorAddress
+	case distr.MsgWithdrawDelegatorReward:
+		return msg.DelegatorAddress
+	case distr.MsgSetWithdrawAddress:
+		return msg.DelegatorAddress
+	}
+	return nil
+}
+
+// touchTxAccounts collects the accounts touched by a tx. A failed tx only touches its signers, the first of
+// which pays the fee.
+func (app *CetChainApp) touchTxAccounts(stdTx auth.StdTx, txHash cmn.HexBytes, ok bool, transfers []TransferRecord) {
+	for i, signer := range stdTx.GetSigners() {
+		app.touchedAccounts.touch(signer.String(), txHash, notify.ReasonSigner)
+		if i == 0 {
+			app.touchedAccounts.touch(signer.String(), txHash, notify.ReasonFeePayer)
+		}
+	}
+	if !ok {
+		return
+	}
+	app.touchedAccounts.touchTransfers(transfers, txHash, app.supplyKeeper.GetModuleAddress(distr.ModuleName).String())
+	for _, msg := range stdTx.Msgs {
+		if delegator := getMsgDelegator(msg); !delegator.Empty() {
+			app.touchedAccounts.touch(delegator.String(), txHash, notify.ReasonDelegator)
+		}
+	}
+}
+
+// touchBlockAccounts collects the accounts touched by the events of BeginBlock or EndBlock
+func (app *CetChainApp) touchBlockAccounts(events []abci.Event) {
+	transfers := appendMsgTransferRecords(nil, nil, events)
+	app.touchedAccounts.touchTransfers(transfers, nil, app.supplyKeeper.GetModuleAddress(distr.ModuleName).String())
+	for _, event := range events {
+		if event.Type == stypes.EventTypeCompleteUnbonding {
+			app.touchedAccounts.touch(getEventAttr(event, stypes.AttributeKeyDelegator), nil,
+				notify.ReasonUnbondingCompleted)
+		} else if event.Type == stypes.EventTypeCompleteRedelegation {
+			app.touchedAccounts.touch(getEventAttr(event, stypes.AttributeKeyDelegator), nil,
+				notify.ReasonRedelegationCompleted)
+		}
+	}
+}
+
+// notifyAccountsTouched sends the account_touched messages of the block, ordered by the addresses
+func (app *CetChainApp) notifyAccountsTouched(height int64) {
+	addrs := make([]string, 0, len(app.touchedAccounts))
+	for addr := range app.touchedAccounts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		acc := app.touchedAccounts[addr]
+		txHashes := acc.txHashes
+		if txHashes == nil {
+			txHashes = []cmn.HexBytes{}
+		}
+		app.appendPubMsgKV(notify.KeyAccountTouched, dex.SafeJSONMarshal(notify.NotificationAccountTouched{
+			Version:  notify.SchemaVersion,
+			Height:   height,
+			Address:  addr,
+			TxHashes: txHashes,
+			Reasons:  acc.reasons,
+		}))
+	}
+}
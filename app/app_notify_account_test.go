@@ -0,0 +1,121 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	tmtypes "github.com/tendermint/tendermint/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/bank"
+	distr "github.com/cosmos/cosmos-sdk/x/distribution"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+	stypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+
+	"github.com/coinexchain/cet-sdk/modules/bankx"
+	"github.com/coinexchain/cet-sdk/testutil"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func TestTouchedAccounts(t *testing.T) {
+	ta := make(touchedAccounts)
+	ta.touch("addr1", cmn.HexBytes{1}, notify.ReasonSigner)
+	ta.touch("addr1", cmn.HexBytes{1}, notify.ReasonFeePayer)
+	ta.touch("addr1", cmn.HexBytes{2}, notify.ReasonSigner)
+	ta.touch("addr1", nil, notify.ReasonUnbondingCompleted)
+	ta.touch("", cmn.HexBytes{2}, notify.ReasonRecipient)
+	require.Equal(t, 1, len(ta))
+	require.Equal(t, []cmn.HexBytes{{1}, {2}}, ta["addr1"].txHashes)
+	require.Equal(t, []string{notify.ReasonSigner, notify.ReasonFeePayer, notify.ReasonUnbondingCompleted},
+		ta["addr1"].reasons)
+
+	var nilAccounts touchedAccounts
+	nilAccounts.touch("addr1", nil, notify.ReasonSigner)
+	require.Equal(t, 0, len(nilAccounts))
+}
+
+func accountsTouched(t *testing.T, app *CetChainApp) map[string]*notify.NotificationAccountTouched {
+	res := make(map[string]*notify.NotificationAccountTouched)
+	for _, value := range pubMsgsOf(app, notify.KeyAccountTouched) {
+		n, err := notify.DecodeAccountTouched(value)
+		require.Nil(t, err)
+		res[n.Address] = n
+	}
+	return res
+}
+
+func TestAccountTouchedNotifications(t *testing.T) {
+	valKey, valAcc := testutil.NewBaseAccount(cetToken().GetTotalSupply().Int64()-2e9, 0, 0)
+	delKey, delAcc := testutil.NewBaseAccount(2e9, 1, 0)
+	_, _, toAddr := testutil.KeyPubAddr()
+	app := initApp(func(genState *GenesisState) {
+		addGenesisAccounts(genState, valAcc, delAcc)
+		genState.StakingXData.Params.MinSelfDelegation = 1e8
+	})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 1, Time: time.Now()}})
+
+	createVal := testutil.NewMsgCreateValidatorBuilder(sdk.ValAddress(valAcc.Address), valAcc.PubKey).
+		MinSelfDelegation(1e8).SelfDelegation(1e8).Commission("0.1", "0.1", "0.01").Build()
+	tx1 := newStdTxBuilder().Msgs(createVal).GasAndFee(1000000, 100).AccNumSeqKey(0, 0, valKey).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx1).Code)
+	tx2 := newStdTxBuilder().Msgs(
+		staking.NewMsgDelegate(delAcc.Address, sdk.ValAddress(valAcc.Address), dex.NewCetCoin(1e8)),
+		bankx.NewMsgSend(delAcc.Address, toAddr, dex.NewCetCoins(2e8), 0),
+	).GasAndFee(1000000, 100).AccNumSeqKey(1, 0, delKey).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx2).Code)
+	// fails for the insufficient coins
+	tx3 := newStdTxBuilder().Msgs(bankx.NewMsgSend(delAcc.Address, toAddr, dex.NewCetCoins(1e10), 0)).
+		GasAndFee(1000000, 100).AccNumSeqKey(1, 1, delKey).Build()
+	require.NotEqual(t, sdk.CodeOK, app.Deliver(tx3).Code)
+
+	require.Equal(t, 0, len(pubMsgsOf(app, notify.KeyAccountTouched)))
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	touched := accountsTouched(t, app)
+
+	hash1, hash2, hash3 := getTxHash(app, tx1), getTxHash(app, tx2), getTxHash(app, tx3)
+	val := touched[valAcc.Address.String()]
+	require.NotNil(t, val)
+	require.Equal(t, int64(1), val.Height)
+	require.Equal(t, []cmn.HexBytes{hash1}, val.TxHashes)
+	require.Equal(t, []string{notify.ReasonSigner, notify.ReasonFeePayer, notify.ReasonDelegator}, val.Reasons)
+
+	del := touched[delAcc.Address.String()]
+	require.NotNil(t, del)
+	require.Equal(t, []cmn.HexBytes{hash2, hash3}, del.TxHashes)
+	require.Equal(t, []string{notify.ReasonSigner, notify.ReasonFeePayer, notify.ReasonSender,
+		notify.ReasonDelegator}, del.Reasons)
+
+	to := touched[toAddr.String()]
+	require.NotNil(t, to)
+	require.Equal(t, []cmn.HexBytes{hash2}, to.TxHashes)
+	require.Equal(t, []string{notify.ReasonRecipient}, to.Reasons)
+	app.Commit()
+}
+
+func getTxHash(app *CetChainApp, tx interface{}) cmn.HexBytes {
+	return tmtypes.Tx(app.cdc.MustMarshalBinaryLengthPrefixed(tx)).Hash()
+}
+
+func TestTouchBlockAccounts(t *testing.T) {
+	app := newApp()
+	app.touchedAccounts = make(touchedAccounts)
+	distrAddr := app.supplyKeeper.GetModuleAddress(distr.ModuleName)
+	del, other := sdk.AccAddress("delegator"), sdk.AccAddress("other")
+	app.touchBlockAccounts([]abci.Event{
+		newEvent(bank.EventTypeTransfer, bank.AttributeKeyRecipient, del.String(), sdk.AttributeKeyAmount, "10cet"),
+		newEvent(sdk.EventTypeMessage, sdk.AttributeKeySender, distrAddr.String()),
+		newEvent(stypes.EventTypeCompleteUnbonding, stypes.AttributeKeyDelegator, del.String()),
+		newEvent(stypes.EventTypeCompleteRedelegation, stypes.AttributeKeyDelegator, other.String()),
+	})
+	require.Equal(t, 3, len(app.touchedAccounts))
+	require.Equal(t, []string{notify.ReasonRewardRecipient, notify.ReasonUnbondingCompleted},
+		app.touchedAccounts[del.String()].reasons)
+	require.Nil(t, app.touchedAccounts[del.String()].txHashes)
+	require.Equal(t, []string{notify.ReasonSender}, app.touchedAccounts[distrAddr.String()].reasons)
+	require.Equal(t, []string{notify.ReasonRedelegationCompleted}, app.touchedAccounts[other.String()].reasons)
+}
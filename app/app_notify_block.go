@@ -0,0 +1,87 @@
+package app
+
+import (
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+// blockStats accumulates the txs of a block for the block_summary message
+type blockStats struct {
+	txCount       int64
+	failedTxCount int64
+	gasUsed       int64
+	// the fees paid by the txs, which are not paid by the txs failing in the ante handler
+	fees sdk.Coins
+	// the coins of the fee collector after BeginBlock, which distributes the fees of the previous block
+	feeCollectorCoins sdk.Coins
+}
+
+func (app *CetChainApp) getFeeCollectorCoins(ctx sdk.Context) sdk.Coins {
+	acc := app.supplyKeeper.GetModuleAccount(ctx, auth.FeeCollectorName)
+	if acc == nil {
+		return sdk.Coins{}
+	}
+	return acc.GetCoins()
+}
+
+func (app *CetChainApp) resetBlockStats(ctx sdk.Context) {
+	app.blockStats = blockStats{feeCollectorCoins: app.getFeeCollectorCoins(ctx)}
+}
+
+// addTxToBlockStats adds a delivered tx, feeCollectorCoins is the coins of the fee collector before it. The
+// fee of stdTx is paid if the fee collector has received it, even if the tx fails in its msgs.
+func (app *CetChainApp) addTxToBlockStats(stdTx auth.StdTx, feeCollectorCoins sdk.Coins, ret abci.ResponseDeliverTx) {
+	app.blockStats.txCount++
+	if ret.Code != uint32(sdk.CodeOK) {
+		app.blockStats.failedTxCount++
+	}
+	app.blockStats.gasUsed += ret.GasUsed
+
+	ctx := app.NewContext(false, app.header)
+	received, neg := app.getFeeCollectorCoins(ctx).SafeSub(feeCollectorCoins)
+	if !neg && received.IsAllGTE(stdTx.Fee.Amount) {
+		app.blockStats.fees = app.blockStats.fees.Add(stdTx.Fee.Amount)
+	}
+}
+
+// newBlockSummary returns the block_summary message without its app hash, which must be called at Commit before
+// the state is committed
+func (app *CetChainApp) newBlockSummary() notify.NotificationBlockSummary {
+	ctx := app.NewContext(false, app.header)
+	received, neg := app.getFeeCollectorCoins(ctx).SafeSub(app.blockStats.feeCollectorCoins)
+	if neg {
+		received = sdk.Coins{}
+	}
+	otherInflows, neg := received.SafeSub(app.blockStats.fees)
+	if neg {
+		otherInflows = sdk.Coins{}
+	}
+	consAddr := sdk.ConsAddress(app.header.ProposerAddress)
+	msg := notify.NotificationBlockSummary{
+		Version:       notify.SchemaVersion,
+		Height:        app.height,
+		TxCount:       app.blockStats.txCount,
+		FailedTxCount: app.blockStats.failedTxCount,
+		GasUsed:       app.blockStats.gasUsed,
+		Fees:          app.blockStats.fees,
+		OtherInflows:  otherInflows,
+		Proposer:      consAddr.String(),
+		MsgCount:      int64(len(app.pubMsgs)),
+	}
+	if validator, found := app.stakingKeeper.GetValidatorByConsAddr(ctx, consAddr); found {
+		msg.ProposerValidator = validator.OperatorAddress.String()
+	}
+	return msg
+}
+
+// pushBlockSummary appends the block_summary message with appHash, which is the app hash after the block
+// returned by BaseApp.Commit
+func (app *CetChainApp) pushBlockSummary(msg notify.NotificationBlockSummary, appHash []byte) {
+	msg.AppHash = appHash
+	app.appendPubMsgKV(notify.KeyBlockSummary, dex.SafeJSONMarshal(msg))
+}
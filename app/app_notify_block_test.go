@@ -0,0 +1,73 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/coinexchain/cet-sdk/modules/bankx"
+	"github.com/coinexchain/cet-sdk/testutil"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func TestBlockSummaryNotification(t *testing.T) {
+	key1, acc1 := testutil.NewBaseAccount(cetToken().GetTotalSupply().Int64()-1e10, 0, 0)
+	_, acc2 := testutil.NewBaseAccount(1e10, 1, 0)
+	app := initApp(func(genState *GenesisState) {
+		addGenesisAccounts(genState, acc1, acc2)
+	})
+
+	proposer := sdk.ConsAddress(acc2.PubKey.Address())
+	appHash := cmn.HexBytes{1, 2, 3}
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 1, Time: time.Now(),
+		ProposerAddress: proposer, AppHash: appHash}})
+	tx := newStdTxBuilder().Msgs(bankx.NewMsgSend(acc1.Address, acc2.Address, dex.NewCetCoins(1e8), 0)).
+		GasAndFee(1000000, 100).AccNumSeqKey(0, 0, key1).Build()
+	res1 := app.Deliver(tx)
+	require.Equal(t, sdk.CodeOK, res1.Code)
+	// fails in the msg, after the fee is paid
+	tx = newStdTxBuilder().Msgs(bankx.NewMsgSend(acc1.Address, acc2.Address, dex.NewCetCoins(1e18), 0)).
+		GasAndFee(1000000, 200).AccNumSeqKey(0, 1, key1).Build()
+	res2 := app.Deliver(tx)
+	require.NotEqual(t, sdk.CodeOK, res2.Code)
+	// fails in the ante handler, the fee is not paid
+	tx = newStdTxBuilder().Msgs(bankx.NewMsgSend(acc1.Address, acc2.Address, dex.NewCetCoins(1e8), 0)).
+		GasAndFee(1000000, 400).AccNumSeqKey(0, 5, key1).Build()
+	res3 := app.Deliver(tx)
+	require.Equal(t, sdk.CodeUnauthorized, res3.Code)
+	// activates the recipient, whose activation fee goes to the fee collector
+	_, _, newAddr := testutil.KeyPubAddr()
+	tx = newStdTxBuilder().Msgs(bankx.NewMsgSend(acc1.Address, newAddr, dex.NewCetCoins(1e9), 0)).
+		GasAndFee(1000000, 800).AccNumSeqKey(0, 2, key1).Build()
+	res4 := app.Deliver(tx)
+	require.Equal(t, sdk.CodeOK, res4.Code)
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	msgCount := int64(len(app.pubMsgs))
+	ret := app.Commit()
+	require.NotEqual(t, []byte(appHash), ret.Data)
+
+	summaries := pubMsgsOf(app, notify.KeyBlockSummary)
+	require.Equal(t, 1, len(summaries))
+	require.Equal(t, notify.KeyBlockSummary, string(app.pubMsgs[len(app.pubMsgs)-1].Key))
+	summary, err := notify.DecodeBlockSummary(summaries[0])
+	require.Nil(t, err)
+	require.Equal(t, notify.NotificationBlockSummary{
+		Version:       notify.SchemaVersion,
+		Height:        1,
+		TxCount:       4,
+		FailedTxCount: 2,
+		GasUsed:       int64(res1.GasUsed + res2.GasUsed + res3.GasUsed + res4.GasUsed),
+		Fees:          dex.NewCetCoins(1100),
+		OtherInflows:  dex.NewCetCoins(app.bankxKeeper.GetParams(app.NewContext(true, abci.Header{})).ActivationFee),
+		AppHash:       ret.Data,
+		Proposer:      proposer.String(),
+		MsgCount:      msgCount,
+	}, *summary)
+}
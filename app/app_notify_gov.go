@@ -0,0 +1,132 @@
+package app
+
+import (
+	"strconv"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/gov"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func toNotifyTally(tally gov.TallyResult) notify.TallyResult {
+	return notify.TallyResult{
+		Yes:        tally.Yes,
+		Abstain:    tally.Abstain,
+		No:         tally.No,
+		NoWithVeto: tally.NoWithVeto,
+	}
+}
+
+// notifyGovTx sends the governance notifications of a successful tx in the order of its events, the
+// proposals are read after the tx is delivered
+func (app *CetChainApp) notifyGovTx(events []abci.Event) {
+	if !app.msgQueProducer.IsSubscribed(gov.ModuleName) {
+		return
+	}
+	var ctx sdk.Context
+	ctxReady := false
+	getProposal := func(id string) (gov.Proposal, bool) {
+		proposalID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return gov.Proposal{}, false
+		}
+		if !ctxReady {
+			ctx = app.NewContext(false, app.header)
+			ctxReady = true
+		}
+		return app.govKeeper.GetProposal(ctx, proposalID)
+	}
+
+	for i, event := range events {
+		if event.Type != govtypes.EventTypeSubmitProposal && event.Type != govtypes.EventTypeProposalDeposit &&
+			event.Type != govtypes.EventTypeProposalVote {
+			continue
+		}
+		if id := getEventAttr(event, govtypes.AttributeKeyVotingPeriodStart); len(id) != 0 {
+			if proposal, ok := getProposal(id); ok {
+				app.appendPubMsgKV(notify.KeyProposalVotingStarted, dex.SafeJSONMarshal(notify.NotificationProposalVotingStarted{
+					Version:         notify.SchemaVersion,
+					ProposalID:      proposal.ProposalID,
+					VotingStartTime: proposal.VotingStartTime.Unix(),
+					VotingEndTime:   proposal.VotingEndTime.Unix(),
+				}))
+			}
+			continue
+		}
+		proposal, ok := getProposal(getEventAttr(event, govtypes.AttributeKeyProposalID))
+		if !ok {
+			continue
+		}
+
+		switch event.Type {
+		case govtypes.EventTypeSubmitProposal:
+			res := notify.NotificationProposalSubmitted{
+				Version:        notify.SchemaVersion,
+				ProposalID:     proposal.ProposalID,
+				Proposer:       getModuleSender(events, i, govtypes.AttributeValueCategory),
+				ProposalType:   proposal.ProposalType(),
+				Title:          proposal.GetTitle(),
+				Description:    proposal.GetDescription(),
+				SubmitTime:     proposal.SubmitTime.Unix(),
+				DepositEndTime: proposal.DepositEndTime.Unix(),
+			}
+			// the initial deposit is made right after the proposal is created
+			for j := i + 1; j < len(events); j++ {
+				if events[j].Type == govtypes.EventTypeProposalDeposit {
+					res.InitialDeposit, _ = sdk.ParseCoins(getEventAttr(events[j], sdk.AttributeKeyAmount))
+					break
+				}
+			}
+			app.appendPubMsgKV(notify.KeyProposalSubmitted, dex.SafeJSONMarshal(res))
+		case govtypes.EventTypeProposalDeposit:
+			amount, _ := sdk.ParseCoins(getEventAttr(event, sdk.AttributeKeyAmount))
+			app.appendPubMsgKV(notify.KeyProposalDeposit, dex.SafeJSONMarshal(notify.NotificationProposalDeposit{
+				Version:      notify.SchemaVersion,
+				ProposalID:   proposal.ProposalID,
+				Depositor:    getModuleSender(events, i, govtypes.AttributeValueCategory),
+				Amount:       amount,
+				TotalDeposit: proposal.TotalDeposit,
+			}))
+		case govtypes.EventTypeProposalVote:
+			app.appendPubMsgKV(notify.KeyProposalVote, dex.SafeJSONMarshal(notify.NotificationProposalVote{
+				Version:    notify.SchemaVersion,
+				ProposalID: proposal.ProposalID,
+				Voter:      getModuleSender(events, i, govtypes.AttributeValueCategory),
+				Option:     getEventAttr(event, govtypes.AttributeKeyOption),
+			}))
+		}
+	}
+}
+
+// notifyGovEndBlock sends the proposal_finalized notifications of the proposals tallied or dropped in EndBlock
+func (app *CetChainApp) notifyGovEndBlock(ctx sdk.Context, events []abci.Event) {
+	if !app.msgQueProducer.IsSubscribed(gov.ModuleName) {
+		return
+	}
+	for _, event := range events {
+		if event.Type != govtypes.EventTypeActiveProposal && event.Type != govtypes.EventTypeInactiveProposal {
+			continue
+		}
+		proposalID, err := strconv.ParseUint(getEventAttr(event, govtypes.AttributeKeyProposalID), 10, 64)
+		if err != nil {
+			continue
+		}
+		res := notify.NotificationProposalFinalized{
+			Version:    notify.SchemaVersion,
+			ProposalID: proposalID,
+			Result:     getEventAttr(event, govtypes.AttributeKeyProposalResult),
+			Tally:      toNotifyTally(gov.EmptyTallyResult()),
+		}
+		// the dropped proposals are deleted
+		if proposal, ok := app.govKeeper.GetProposal(ctx, proposalID); ok && event.Type == govtypes.EventTypeActiveProposal {
+			res.Status = proposal.Status.String()
+			res.Tally = toNotifyTally(proposal.FinalTallyResult)
+		}
+		app.appendPubMsgKV(notify.KeyProposalFinalized, dex.SafeJSONMarshal(res))
+	}
+}
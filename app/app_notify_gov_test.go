@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/gov"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+
+	"github.com/coinexchain/cet-sdk/msgqueue"
+	"github.com/coinexchain/cet-sdk/testutil"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func TestProposalNotifications(t *testing.T) {
+	valKey, valAcc := testutil.NewBaseAccount(cetToken().GetTotalSupply().Int64()-1e10, 0, 0)
+	propKey, propAcc := testutil.NewBaseAccount(1e10, 1, 0)
+	app := initApp(func(genState *GenesisState) {
+		addGenesisAccounts(genState, valAcc, propAcc)
+		genState.StakingXData.Params.MinSelfDelegation = 1e8
+		genState.GovData.DepositParams.MinDeposit = dex.NewCetCoins(1e8)
+		genState.GovData.DepositParams.MaxDepositPeriod = 10 * time.Second
+		genState.GovData.VotingParams.VotingPeriod = 10 * time.Second
+	})
+	app.msgQueProducer = msgqueue.NewProducerFromConfig([]string{"nop"}, "auth,bank,gov", true, nil)
+
+	// block 1: a validator, a proposal entering the voting period with the second deposit and a proposal
+	// which is dropped
+	blockTime := time.Unix(1600000000, 0).UTC()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 1, Time: blockTime}})
+	createVal := testutil.NewMsgCreateValidatorBuilder(sdk.ValAddress(valAcc.Address), valAcc.PubKey).
+		MinSelfDelegation(1e8).SelfDelegation(1e9).Commission("0.1", "0.1", "0.01").Build()
+	tx := newStdTxBuilder().Msgs(createVal).GasAndFee(1000000, 100).AccNumSeqKey(0, 0, valKey).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+
+	tx = newStdTxBuilder().Msgs(
+		gov.NewMsgSubmitProposal(gov.NewTextProposal("title1", "desc1"), dex.NewCetCoins(4e7), propAcc.Address),
+		gov.NewMsgDeposit(propAcc.Address, 1, dex.NewCetCoins(6e7)),
+		gov.NewMsgSubmitProposal(gov.NewTextProposal("title2", "desc2"), dex.NewCetCoins(1e7), propAcc.Address),
+	).GasAndFee(1000000, 100).AccNumSeqKey(1, 0, propKey).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+
+	submitted := pubMsgsOf(app, notify.KeyProposalSubmitted)
+	require.Equal(t, 2, len(submitted))
+	submitted1, err := notify.DecodeProposalSubmitted(submitted[0])
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), submitted1.ProposalID)
+	require.Equal(t, propAcc.Address.String(), submitted1.Proposer)
+	require.Equal(t, "Text", submitted1.ProposalType)
+	require.Equal(t, "title1", submitted1.Title)
+	require.Equal(t, dex.NewCetCoins(4e7), submitted1.InitialDeposit)
+	require.Equal(t, blockTime.Unix(), submitted1.SubmitTime)
+	require.Equal(t, blockTime.Add(10*time.Second).Unix(), submitted1.DepositEndTime)
+	submitted2, err := notify.DecodeProposalSubmitted(submitted[1])
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), submitted2.ProposalID)
+	require.Equal(t, dex.NewCetCoins(1e7), submitted2.InitialDeposit)
+
+	deposits := pubMsgsOf(app, notify.KeyProposalDeposit)
+	require.Equal(t, 3, len(deposits))
+	deposit, err := notify.DecodeProposalDeposit(deposits[1])
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), deposit.ProposalID)
+	require.Equal(t, propAcc.Address.String(), deposit.Depositor)
+	require.Equal(t, dex.NewCetCoins(6e7), deposit.Amount)
+	require.Equal(t, dex.NewCetCoins(1e8), deposit.TotalDeposit)
+
+	started := pubMsgsOf(app, notify.KeyProposalVotingStarted)
+	require.Equal(t, 1, len(started))
+	votingStarted, err := notify.DecodeProposalVotingStarted(started[0])
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), votingStarted.ProposalID)
+	require.Equal(t, blockTime.Unix(), votingStarted.VotingStartTime)
+	require.Equal(t, blockTime.Add(10*time.Second).Unix(), votingStarted.VotingEndTime)
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	// block 2: the validator votes
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 2, Time: blockTime.Add(5 * time.Second)}})
+	tx = newStdTxBuilder().Msgs(gov.NewMsgVote(valAcc.Address, 1, gov.OptionYes)).
+		GasAndFee(1000000, 100).AccNumSeqKey(0, 1, valKey).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	votes := pubMsgsOf(app, notify.KeyProposalVote)
+	require.Equal(t, 1, len(votes))
+	vote, err := notify.DecodeProposalVote(votes[0])
+	require.Nil(t, err)
+	require.Equal(t, notify.NotificationProposalVote{Version: notify.SchemaVersion, ProposalID: 1,
+		Voter: valAcc.Address.String(), Option: gov.OptionYes.String()}, *vote)
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+
+	// block 3: the first proposal passes and the second one is dropped
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 3, Time: blockTime.Add(20 * time.Second)}})
+	app.EndBlock(abci.RequestEndBlock{Height: 3})
+	finalized := pubMsgsOf(app, notify.KeyProposalFinalized)
+	require.Equal(t, 2, len(finalized))
+	results := make(map[uint64]notify.NotificationProposalFinalized)
+	for _, value := range finalized {
+		var res notify.NotificationProposalFinalized
+		require.Nil(t, json.Unmarshal(value, &res))
+		results[res.ProposalID] = res
+	}
+	require.Equal(t, govtypes.AttributeValueProposalPassed, results[1].Result)
+	require.Equal(t, gov.StatusPassed.String(), results[1].Status)
+	require.Equal(t, sdk.NewInt(1e9), results[1].Tally.Yes)
+	require.True(t, results[1].Tally.No.IsZero())
+	require.Equal(t, govtypes.AttributeValueProposalDropped, results[2].Result)
+	require.Equal(t, "", results[2].Status)
+	require.True(t, results[2].Tally.Yes.IsZero())
+	app.Commit()
+}
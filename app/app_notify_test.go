@@ -0,0 +1,175 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/common"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+	stypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+
+	"github.com/coinexchain/cet-sdk/testutil"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func stakingEvents(typ string, sender string, attrs ...string) []abci.Event {
+	event := abci.Event{Type: typ}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		event.Attributes = append(event.Attributes, common.KVPair{Key: []byte(attrs[i]), Value: []byte(attrs[i+1])})
+	}
+	msgEvent := abci.Event{Type: sdk.EventTypeMessage, Attributes: []common.KVPair{
+		{Key: []byte(sdk.AttributeKeySender), Value: []byte(sender)},
+	}}
+	return []abci.Event{event, msgEvent}
+}
+
+func TestGetNotificationBeginUnbonding(t *testing.T) {
+	completionTime := time.Unix(1600000000, 0).UTC()
+	res := getNotificationBeginUnbonding(stakingEvents(stypes.EventTypeUnbond, "del",
+		stypes.AttributeKeyValidator, "val",
+		sdk.AttributeKeyAmount, "1000",
+		stypes.AttributeKeyCompletionTime, completionTime.Format(time.RFC3339)))
+	require.Equal(t, notify.SchemaVersion, res.Version)
+	require.Equal(t, "del", res.Delegator)
+	require.Equal(t, "val", res.Validator)
+	require.Equal(t, "1000", res.Amount)
+	require.Equal(t, dex.NewCetCoins(1000), res.Coins)
+	require.Equal(t, int64(1600000000), res.CompletionTime)
+
+	res = getNotificationBeginUnbonding(stakingEvents(stypes.EventTypeUnbond, "del",
+		stypes.AttributeKeyCompletionTime, "not a time"))
+	require.Equal(t, int64(0), res.CompletionTime)
+}
+
+func TestGetNotificationBeginRedelegation(t *testing.T) {
+	completionTime := time.Unix(1600000000, 0).UTC()
+	res := getNotificationBeginRedelegation(stakingEvents(stypes.EventTypeRedelegate, "del",
+		stypes.AttributeKeySrcValidator, "src",
+		stypes.AttributeKeyDstValidator, "dst",
+		sdk.AttributeKeyAmount, "2000",
+		stypes.AttributeKeyCompletionTime, completionTime.Format(time.RFC3339)))
+	require.Equal(t, "del", res.Delegator)
+	require.Equal(t, "src", res.ValidatorSrc)
+	require.Equal(t, "dst", res.ValidatorDst)
+	require.Equal(t, dex.NewCetCoins(2000), res.Coins)
+	require.Equal(t, int64(1600000000), res.CompletionTime)
+	require.False(t, res.CompleteNow)
+
+	// the src validator is unbonded
+	res = getNotificationBeginRedelegation(stakingEvents(stypes.EventTypeRedelegate, "del",
+		stypes.AttributeKeyCompletionTime, time.Time{}.Format(time.RFC3339)))
+	require.Equal(t, int64(0), res.CompletionTime)
+	require.True(t, res.CompleteNow)
+}
+
+func pubMsgsOf(app *CetChainApp, key string) []json.RawMessage {
+	var values []json.RawMessage
+	for _, msg := range app.pubMsgs {
+		if string(msg.Key) == key {
+			values = append(values, msg.Value)
+		}
+	}
+	return values
+}
+
+func TestUnbondingEntryNotifications(t *testing.T) {
+	val1Key, val1Acc := testutil.NewBaseAccount(cetToken().GetTotalSupply().Int64()-2e9, 0, 0)
+	val2Key, val2Acc := testutil.NewBaseAccount(1e9, 1, 0)
+	delKey, delAcc := testutil.NewBaseAccount(1e9, 2, 0)
+	val1Addr, val2Addr := sdk.ValAddress(val1Acc.Address), sdk.ValAddress(val2Acc.Address)
+	app := initApp(func(genState *GenesisState) {
+		addGenesisAccounts(genState, val1Acc, val2Acc, delAcc)
+		genState.StakingXData.Params.MinSelfDelegation = 1e8
+		genState.StakingData.Params.UnbondingTime = 10 * time.Second
+	})
+
+	// block 1: two validators and a delegation
+	blockTime := time.Unix(1600000000, 0).UTC()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 1, Time: blockTime}})
+	for i, acc := range []auth.BaseAccount{val1Acc, val2Acc} {
+		key := val1Key
+		if i == 1 {
+			key = val2Key
+		}
+		msg := testutil.NewMsgCreateValidatorBuilder(sdk.ValAddress(acc.Address), acc.PubKey).
+			MinSelfDelegation(1e8).SelfDelegation(1e8).Commission("0.1", "0.1", "0.01").Build()
+		tx := newStdTxBuilder().Msgs(msg).GasAndFee(1000000, 100).AccNumSeqKey(uint64(i), 0, key).Build()
+		require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	}
+	delegateMsg := staking.NewMsgDelegate(delAcc.Address, val1Addr, dex.NewCetCoin(1e8))
+	tx := newStdTxBuilder().Msgs(delegateMsg).GasAndFee(1000000, 100).AccNumSeqKey(2, 0, delKey).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	// block 2: two unbondings of the same validator and a redelegation in a tx
+	blockTime = blockTime.Add(5 * time.Second)
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 2, Time: blockTime}})
+	tx = newStdTxBuilder().Msgs(
+		staking.NewMsgUndelegate(delAcc.Address, val1Addr, dex.NewCetCoin(1000)),
+		staking.NewMsgUndelegate(delAcc.Address, val1Addr, dex.NewCetCoin(2000)),
+		staking.NewMsgBeginRedelegate(delAcc.Address, val1Addr, val2Addr, dex.NewCetCoin(3000)),
+	).GasAndFee(1000000, 100).AccNumSeqKey(2, 1, delKey).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+
+	completionTime := blockTime.Add(10 * time.Second).Unix()
+	unbondings := pubMsgsOf(app, notify.KeyBeginUnbonding)
+	require.Equal(t, 2, len(unbondings))
+	var unbonding1, unbonding2 NotificationBeginUnbonding
+	require.Nil(t, json.Unmarshal(unbondings[0], &unbonding1))
+	require.Nil(t, json.Unmarshal(unbondings[1], &unbonding2))
+	require.Equal(t, dex.NewCetCoins(1000), unbonding1.Coins)
+	require.Equal(t, dex.NewCetCoins(2000), unbonding2.Coins)
+	for _, n := range []NotificationBeginUnbonding{unbonding1, unbonding2} {
+		require.Equal(t, int64(2), n.CreationHeight)
+		require.Equal(t, completionTime, n.CompletionTime)
+		require.Equal(t, delAcc.Address.String(), n.Delegator)
+	}
+	require.Equal(t, notify.UnbondingEntryID(delAcc.Address.String(), val1Addr.String(), 2, completionTime, 0),
+		unbonding1.EntryID)
+	require.Equal(t, notify.UnbondingEntryID(delAcc.Address.String(), val1Addr.String(), 2, completionTime, 1),
+		unbonding2.EntryID)
+
+	redelegations := pubMsgsOf(app, notify.KeyBeginRedelegation)
+	require.Equal(t, 1, len(redelegations))
+	var redelegation NotificationBeginRedelegation
+	require.Nil(t, json.Unmarshal(redelegations[0], &redelegation))
+	require.False(t, redelegation.CompleteNow)
+	require.Equal(t, int64(2), redelegation.CreationHeight)
+	require.Equal(t, completionTime, redelegation.CompletionTime)
+	require.NotEmpty(t, redelegation.EntryID)
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+
+	// block 3: the entries complete
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 3, Time: blockTime.Add(20 * time.Second)}})
+	app.EndBlock(abci.RequestEndBlock{Height: 3})
+
+	completes := pubMsgsOf(app, notify.KeyCompleteUnbonding)
+	require.Equal(t, 1, len(completes))
+	var complete NotificationCompleteUnbonding
+	require.Nil(t, json.Unmarshal(completes[0], &complete))
+	require.Equal(t, dex.NewCetCoins(3000), complete.Coins)
+	require.Equal(t, 2, len(complete.Entries))
+	require.Equal(t, unbonding1.EntryID, complete.Entries[0].EntryID)
+	require.Equal(t, unbonding2.EntryID, complete.Entries[1].EntryID)
+	require.Equal(t, dex.NewCetCoins(2000), complete.Entries[1].Coins)
+	require.Equal(t, completionTime, complete.Entries[1].CompletionTime)
+
+	completes = pubMsgsOf(app, notify.KeyCompleteRedelegation)
+	require.Equal(t, 1, len(completes))
+	var completeRed NotificationCompleteRedelegation
+	require.Nil(t, json.Unmarshal(completes[0], &completeRed))
+	require.Equal(t, 1, len(completeRed.Entries))
+	require.Equal(t, redelegation.EntryID, completeRed.Entries[0].EntryID)
+	require.Equal(t, dex.NewCetCoins(3000), completeRed.Coins)
+	app.Commit()
+}
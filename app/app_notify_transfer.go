@@ -0,0 +1,148 @@
+package app
+
+import (
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/bank"
+
+	"github.com/coinexchain/cet-sdk/modules/bankx"
+)
+
+// getTransferRecords extracts the coin transfers made by the msgs of a successful tx, in the order they are made.
+// baseapp appends a message event with the action to the events of every msg, which splits the events by msgs.
+func getTransferRecords(msgs []sdk.Msg, events []abci.Event) []TransferRecord {
+	res := make([]TransferRecord, 0, 10)
+	start, msgIdx := 0, 0
+	for i, event := range events {
+		if event.Type != sdk.EventTypeMessage || len(getEventAttr(event, sdk.AttributeKeyAction)) == 0 {
+			continue
+		}
+		var msg sdk.Msg
+		if msgIdx < len(msgs) {
+			msg = msgs[msgIdx]
+		}
+		res = appendMsgTransferRecords(res, msg, events[start:i])
+		start, msgIdx = i+1, msgIdx+1
+	}
+	return res
+}
+
+// appendMsgTransferRecords appends the transfers in the events of a msg. A transfer of the bank keeper is a
+// transfer event followed by a message event with its sender, including the transfers from and to the module
+// accounts. The transfers of MsgMultiSend and MsgSupervisedSend, whose transfer events have no senders, are
+// built from the msgs instead, at the place of their first transfer events.
+func appendMsgTransferRecords(res []TransferRecord, msg sdk.Msg, events []abci.Event) []TransferRecord {
+	msgTransfers, fromMsg := getMsgTransferRecords(msg)
+	for i, event := range events {
+		if event.Type != bank.EventTypeTransfer {
+			continue
+		}
+		recipient := getEventAttr(event, bank.AttributeKeyRecipient)
+		amount := getEventAttr(event, sdk.AttributeKeyAmount)
+		if len(recipient) == 0 || len(amount) == 0 {
+			// bankx emits transfer events of the sender or the memo option only
+			continue
+		}
+		// the locked send of bankx puts the sender in the transfer event
+		sender := getEventAttr(event, bank.AttributeKeySender)
+		if len(sender) == 0 && i+1 < len(events) && isSenderEvent(events[i+1]) {
+			sender = getEventAttr(events[i+1], sdk.AttributeKeySender)
+		}
+		if len(sender) != 0 {
+			coins, _ := sdk.ParseCoins(amount)
+			res = append(res, TransferRecord{Sender: sender, Recipient: recipient, Amount: amount, Coins: coins})
+		} else if fromMsg {
+			res = append(res, msgTransfers...)
+			fromMsg = false
+		}
+	}
+	if fromMsg {
+		res = append(res, msgTransfers...)
+	}
+	return res
+}
+
+// isSenderEvent tells the message event emitted with a transfer event by the bank keeper
+func isSenderEvent(event abci.Event) bool {
+	return event.Type == sdk.EventTypeMessage && len(event.Attributes) == 1 &&
+		string(event.Attributes[0].Key) == sdk.AttributeKeySender
+}
+
+// getMsgTransferRecords returns the transfers of the msgs whose transfer events are incomplete
+func getMsgTransferRecords(msg sdk.Msg) ([]TransferRecord, bool) {
+	switch msg := msg.(type) {
+	case bankx.MsgMultiSend:
+		return getMultiSendTransferRecords(msg.Inputs, msg.Outputs), true
+	case bankx.MsgSupervisedSend:
+		return getSupervisedSendTransferRecords(msg), true
+	}
+	return nil, false
+}
+
+// getMultiSendTransferRecords matches the inputs to the outputs denom by denom, both in order, since the
+// coins are not sent from an input to an output. The coins from an input to an output are in one transfer.
+func getMultiSendTransferRecords(inputs []bank.Input, outputs []bank.Output) []TransferRecord {
+	remains := make([]sdk.Coins, len(inputs))
+	for i, input := range inputs {
+		remains[i] = input.Coins
+	}
+	transfers := make(map[[2]int]sdk.Coins)
+	order := make([][2]int, 0, len(outputs))
+	for j, output := range outputs {
+		for _, coin := range output.Coins {
+			need := coin.Amount
+			for i := 0; i < len(inputs) && need.IsPositive(); i++ {
+				have := remains[i].AmountOf(coin.Denom)
+				if !have.IsPositive() {
+					continue
+				}
+				amt := sdk.MinInt(have, need)
+				sent := sdk.NewCoins(sdk.NewCoin(coin.Denom, amt))
+				remains[i] = remains[i].Sub(sent)
+				need = need.Sub(amt)
+				key := [2]int{i, j}
+				if _, ok := transfers[key]; !ok {
+					order = append(order, key)
+				}
+				transfers[key] = transfers[key].Add(sent)
+			}
+		}
+	}
+
+	res := make([]TransferRecord, len(order))
+	for k, key := range order {
+		coins := transfers[key]
+		res[k] = TransferRecord{
+			Sender:    inputs[key[0]].Address.String(),
+			Recipient: outputs[key[1]].Address.String(),
+			Amount:    coins.String(),
+			Coins:     coins,
+		}
+	}
+	return res
+}
+
+// getSupervisedSendTransferRecords returns the coins locked to the recipient on creation, and those returned
+// to the sender and the reward paid to the supervisor from the locked coins of the recipient on unlocking
+func getSupervisedSendTransferRecords(msg bankx.MsgSupervisedSend) []TransferRecord {
+	newRecord := func(from, to sdk.AccAddress, amt sdk.Int) TransferRecord {
+		coins := sdk.NewCoins(sdk.NewCoin(msg.Amount.Denom, amt))
+		return TransferRecord{Sender: from.String(), Recipient: to.String(), Amount: coins.String(), Coins: coins}
+	}
+	if msg.Operation == bankx.Create {
+		return []TransferRecord{newRecord(msg.FromAddress, msg.ToAddress, msg.Amount.Amount)}
+	}
+	res := make([]TransferRecord, 0, 2)
+	reward := sdk.ZeroInt()
+	if !msg.Supervisor.Empty() {
+		reward = sdk.NewInt(msg.Reward)
+	}
+	if amt := msg.Amount.Amount.Sub(reward); msg.Operation == bankx.Return && amt.IsPositive() {
+		res = append(res, newRecord(msg.ToAddress, msg.FromAddress, amt))
+	}
+	if reward.IsPositive() {
+		res = append(res, newRecord(msg.ToAddress, msg.Supervisor, reward))
+	}
+	return res
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/common"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/cosmos/cosmos-sdk/x/bank"
+
+	"github.com/coinexchain/cet-sdk/modules/asset"
+	"github.com/coinexchain/cet-sdk/modules/bankx"
+	"github.com/coinexchain/cet-sdk/testutil"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func newEvent(typ string, attrs ...string) abci.Event {
+	event := abci.Event{Type: typ}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		event.Attributes = append(event.Attributes, common.KVPair{Key: []byte(attrs[i]), Value: []byte(attrs[i+1])})
+	}
+	return event
+}
+
+func newTransferRecord(sender, recipient sdk.AccAddress, coins sdk.Coins) TransferRecord {
+	return TransferRecord{Sender: sender.String(), Recipient: recipient.String(), Amount: coins.String(), Coins: coins}
+}
+
+func TestGetMultiSendTransferRecords(t *testing.T) {
+	addrA, addrB := sdk.AccAddress("addrA"), sdk.AccAddress("addrB")
+	addrC, addrD := sdk.AccAddress("addrC"), sdk.AccAddress("addrD")
+	abc := func(amt int64) sdk.Coin { return sdk.NewInt64Coin("abc", amt) }
+	inputs := []bank.Input{
+		bank.NewInput(addrA, sdk.NewCoins(abc(100), dex.NewCetCoin(300))),
+		bank.NewInput(addrB, dex.NewCetCoins(200)),
+	}
+	outputs := []bank.Output{
+		bank.NewOutput(addrC, sdk.NewCoins(abc(50), dex.NewCetCoin(100))),
+		bank.NewOutput(addrD, sdk.NewCoins(abc(50), dex.NewCetCoin(400))),
+	}
+	require.Equal(t, []TransferRecord{
+		newTransferRecord(addrA, addrC, sdk.NewCoins(abc(50), dex.NewCetCoin(100))),
+		newTransferRecord(addrA, addrD, sdk.NewCoins(abc(50), dex.NewCetCoin(200))),
+		newTransferRecord(addrB, addrD, dex.NewCetCoins(200)),
+	}, getMultiSendTransferRecords(inputs, outputs))
+}
+
+func TestGetSupervisedSendTransferRecords(t *testing.T) {
+	from, to, supervisor := sdk.AccAddress("from"), sdk.AccAddress("to"), sdk.AccAddress("supervisor")
+	msg := bankx.MsgSupervisedSend{FromAddress: from, Supervisor: supervisor, ToAddress: to,
+		Amount: dex.NewCetCoin(1000), UnlockTime: 100, Reward: 10, Operation: bankx.Create}
+	require.Equal(t, []TransferRecord{newTransferRecord(from, to, dex.NewCetCoins(1000))},
+		getSupervisedSendTransferRecords(msg))
+
+	msg.Operation = bankx.Return
+	require.Equal(t, []TransferRecord{
+		newTransferRecord(to, from, dex.NewCetCoins(990)),
+		newTransferRecord(to, supervisor, dex.NewCetCoins(10)),
+	}, getSupervisedSendTransferRecords(msg))
+
+	// the unlocked coins stay with the recipient
+	msg.Operation = bankx.EarlierUnlockBySupervisor
+	require.Equal(t, []TransferRecord{newTransferRecord(to, supervisor, dex.NewCetCoins(10))},
+		getSupervisedSendTransferRecords(msg))
+	msg.Operation, msg.Supervisor = bankx.EarlierUnlockBySender, nil
+	require.Equal(t, 0, len(getSupervisedSendTransferRecords(msg)))
+}
+
+func TestGetTransferRecords(t *testing.T) {
+	from, to, supervisor := sdk.AccAddress("from"), sdk.AccAddress("to"), sdk.AccAddress("supervisor")
+	feeCollector := sdk.AccAddress("fee_collector")
+	supervisedSend := bankx.MsgSupervisedSend{FromAddress: from, Supervisor: supervisor, ToAddress: to,
+		Amount: dex.NewCetCoin(1000), UnlockTime: 100, Reward: 10, Operation: bankx.Create}
+	events := []abci.Event{
+		// MsgSend to a fresh account
+		newEvent(bank.EventTypeTransfer, bank.AttributeKeyRecipient, feeCollector.String(), sdk.AttributeKeyAmount, "100cet"),
+		newEvent(sdk.EventTypeMessage, sdk.AttributeKeySender, from.String()),
+		newEvent(sdk.EventTypeMessage, sdk.AttributeKeyModule, bankx.ModuleName),
+		newEvent(bank.EventTypeTransfer, bank.AttributeKeyRecipient, to.String(), sdk.AttributeKeyAmount, "900cet"),
+		newEvent(sdk.EventTypeMessage, sdk.AttributeKeySender, from.String()),
+		newEvent(bank.EventTypeTransfer, bank.AttributeKeySender, from.String()),
+		newEvent(sdk.EventTypeMessage, sdk.AttributeKeyAction, "send"),
+		// MsgSupervisedSend
+		newEvent(sdk.EventTypeMessage, sdk.AttributeKeyModule, bankx.ModuleName, sdk.AttributeKeySender, from.String()),
+		newEvent(bank.EventTypeTransfer, bank.AttributeKeyRecipient, to.String(), sdk.AttributeKeyAmount, "1000cet"),
+		newEvent(sdk.EventTypeMessage, sdk.AttributeKeyAction, "supervised_send"),
+	}
+	require.Equal(t, []TransferRecord{
+		newTransferRecord(from, feeCollector, dex.NewCetCoins(100)),
+		newTransferRecord(from, to, dex.NewCetCoins(900)),
+		newTransferRecord(from, to, dex.NewCetCoins(1000)),
+	}, getTransferRecords([]sdk.Msg{bankx.NewMsgSend(from, to, dex.NewCetCoins(1000), 0), supervisedSend}, events))
+}
+
+func abcToken(totalSupply int64) asset.Token {
+	token := cetToken().(*asset.BaseToken)
+	token.Name = "ABC Token"
+	token.Symbol = "abc"
+	token.TotalSupply = sdk.NewInt(totalSupply)
+	token.TotalBurn = sdk.ZeroInt()
+	return token
+}
+
+func TestMultiSendTransferNotifications(t *testing.T) {
+	keyA, accA := testutil.NewBaseAccount(cetToken().GetTotalSupply().Int64()-1e10, 0, 0)
+	accA.Coins = accA.Coins.Add(sdk.NewCoins(sdk.NewInt64Coin("abc", 1e9)))
+	keyB, accB := testutil.NewBaseAccount(1e10, 1, 0)
+	_, _, addrC := testutil.KeyPubAddr()
+	_, _, addrD := testutil.KeyPubAddr()
+	app := initApp(func(genState *GenesisState) {
+		addGenesisAccounts(genState, accA, accB)
+		genState.AssetData.Tokens = append(genState.AssetData.Tokens, abcToken(1e9))
+	})
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 1, Time: time.Now()}})
+
+	abc := func(amt int64) sdk.Coin { return sdk.NewInt64Coin("abc", amt) }
+	multiSend := bankx.NewMsgMultiSend(
+		[]bank.Input{
+			bank.NewInput(accA.Address, sdk.NewCoins(abc(1000), dex.NewCetCoin(3e8))),
+			bank.NewInput(accB.Address, dex.NewCetCoins(2e8)),
+		},
+		[]bank.Output{
+			bank.NewOutput(addrC, sdk.NewCoins(abc(500), dex.NewCetCoin(2e8))),
+			bank.NewOutput(addrD, sdk.NewCoins(abc(500), dex.NewCetCoin(3e8))),
+		},
+	)
+	send := bankx.NewMsgSend(accB.Address, addrC, dex.NewCetCoins(1e8), 0)
+	tx := newStdTxBuilder().Msgs(multiSend, send).GasAndFee(1000000, 100).
+		AccNumSeqKey(0, 0, keyA).AccNumSeqKey(1, 0, keyB).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+
+	notifyTx, err := notify.DecodeTx(lastPubMsgOf(t, app, notify.KeyNotifyTx))
+	require.Nil(t, err)
+	feeCollector := app.supplyKeeper.GetModuleAddress(auth.FeeCollectorName)
+	activationFee := dex.NewCetCoins(app.bankxKeeper.GetParams(app.NewContext(false, app.header)).ActivationFee)
+	require.Equal(t, []TransferRecord{
+		newTransferRecord(accA.Address, addrC, sdk.NewCoins(abc(500), dex.NewCetCoin(2e8))),
+		newTransferRecord(accA.Address, addrD, sdk.NewCoins(abc(500), dex.NewCetCoin(1e8))),
+		newTransferRecord(accB.Address, addrD, dex.NewCetCoins(2e8)),
+		newTransferRecord(addrC, feeCollector, activationFee),
+		newTransferRecord(addrD, feeCollector, activationFee),
+		newTransferRecord(accB.Address, addrC, dex.NewCetCoins(1e8)),
+	}, notifyTx.Transfers)
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sltypes "github.com/cosmos/cosmos-sdk/x/slashing/types"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+	stypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+// lastValidatorPower is the power of a validator in the last validator set sent to tendermint
+type lastValidatorPower struct {
+	operator string
+	power    int64
+}
+
+// lastValidatorPowers are keyed by the consensus addresses, for the validators removed in EndBlock
+type lastValidatorPowers map[string]lastValidatorPower
+
+// collectLastValidatorPowers reads the last validator set before the staking module updates it in EndBlock
+func (app *CetChainApp) collectLastValidatorPowers(ctx sdk.Context) lastValidatorPowers {
+	res := make(lastValidatorPowers)
+	app.stakingKeeper.IterateLastValidatorPowers(ctx, func(operator sdk.ValAddress, power int64) bool {
+		if validator, found := app.stakingKeeper.GetValidator(ctx, operator); found {
+			res[validator.ConsAddress().String()] = lastValidatorPower{operator: operator.String(), power: power}
+		}
+		return false
+	})
+	return res
+}
+
+func consPubKeyString(validator staking.Validator) string {
+	pubKey, err := sdk.Bech32ifyConsPub(validator.ConsPubKey)
+	if err != nil {
+		return ""
+	}
+	return pubKey
+}
+
+// notifyValidatorTx sends the notifications of the validators created, edited and unjailed by a successful tx,
+// the validators are read after the tx is delivered
+func (app *CetChainApp) notifyValidatorTx(events []abci.Event) {
+	var ctx sdk.Context
+	ctxReady := false
+	getValidator := func(addr string) (staking.Validator, bool) {
+		valAddr, err := sdk.ValAddressFromBech32(addr)
+		if err != nil {
+			return staking.Validator{}, false
+		}
+		if !ctxReady {
+			ctx = app.NewContext(false, app.header)
+			ctxReady = true
+		}
+		return app.stakingKeeper.GetValidator(ctx, valAddr)
+	}
+
+	for i, event := range events {
+		switch {
+		case event.Type == stypes.EventTypeCreateValidator:
+			validator, ok := getValidator(getEventAttr(event, stypes.AttributeKeyValidator))
+			if !ok {
+				continue
+			}
+			power := validator.PotentialConsensusPower()
+			app.appendPubMsgKV(notify.KeyValidatorCreated, dex.SafeJSONMarshal(notify.NotificationValidatorCreated{
+				Version:           notify.SchemaVersion,
+				Validator:         validator.OperatorAddress.String(),
+				ConsAddress:       validator.ConsAddress().String(),
+				ConsPubKey:        consPubKeyString(validator),
+				Delegator:         getModuleSender(events, i, stypes.AttributeValueCategory),
+				Moniker:           validator.GetMoniker(),
+				CommissionRate:    validator.Commission.Rate,
+				MinSelfDelegation: validator.MinSelfDelegation,
+				SelfDelegation:    parseBondCoins(getEventAttr(event, sdk.AttributeKeyAmount)),
+				Power:             power,
+				PowerDelta:        power - app.stakingKeeper.GetLastValidatorPower(ctx, validator.OperatorAddress),
+			}))
+		case event.Type == stypes.EventTypeEditValidator:
+			validator, ok := getValidator(getModuleSender(events, i, stypes.AttributeValueCategory))
+			if !ok {
+				continue
+			}
+			lastPower := app.stakingKeeper.GetLastValidatorPower(ctx, validator.OperatorAddress)
+			app.appendPubMsgKV(notify.KeyValidatorEdited, dex.SafeJSONMarshal(notify.NotificationValidatorEdited{
+				Version:           notify.SchemaVersion,
+				Validator:         validator.OperatorAddress.String(),
+				Moniker:           validator.GetMoniker(),
+				CommissionRate:    validator.Commission.Rate,
+				MinSelfDelegation: validator.MinSelfDelegation,
+				Power:             validator.ConsensusPower(),
+				PowerDelta:        validator.ConsensusPower() - lastPower,
+			}))
+		case event.Type == sdk.EventTypeMessage &&
+			getEventAttr(event, sdk.AttributeKeyModule) == sltypes.AttributeValueCategory:
+			// MsgUnjail is the only msg of the slashing module, which emits no other events
+			validator, ok := getValidator(getEventAttr(event, sdk.AttributeKeySender))
+			if !ok {
+				continue
+			}
+			power := validator.PotentialConsensusPower()
+			app.appendPubMsgKV(notify.KeyValidatorUnjailed, dex.SafeJSONMarshal(notify.NotificationValidatorUnjailed{
+				Version:     notify.SchemaVersion,
+				Validator:   validator.OperatorAddress.String(),
+				ConsAddress: validator.ConsAddress().String(),
+				Power:       power,
+				PowerDelta:  power - app.stakingKeeper.GetLastValidatorPower(ctx, validator.OperatorAddress),
+			}))
+		}
+	}
+}
+
+// notifyValidatorJailed sends the notifications of the validators jailed by the slashing module in BeginBlock.
+// The jailing of a double signer is a slash event without the reason, following the one slashing it.
+func (app *CetChainApp) notifyValidatorJailed(ctx sdk.Context, events []abci.Event) {
+	reasons := make(map[string]string)
+	for _, event := range events {
+		if event.Type != sltypes.EventTypeSlash {
+			continue
+		}
+		if reason := getEventAttr(event, sltypes.AttributeKeyReason); len(reason) != 0 {
+			reasons[getEventAttr(event, sltypes.AttributeKeyAddress)] = reason
+		}
+		consAddr, err := sdk.ConsAddressFromBech32(getEventAttr(event, sltypes.AttributeKeyJailed))
+		if err != nil {
+			continue
+		}
+		validator, found := app.stakingKeeper.GetValidatorByConsAddr(ctx, consAddr)
+		if !found {
+			continue
+		}
+		app.appendPubMsgKV(notify.KeyValidatorJailed, dex.SafeJSONMarshal(notify.NotificationValidatorJailed{
+			Version:     notify.SchemaVersion,
+			Validator:   validator.OperatorAddress.String(),
+			ConsAddress: consAddr.String(),
+			Reason:      reasons[consAddr.String()],
+			PowerDelta:  -app.stakingKeeper.GetLastValidatorPower(ctx, validator.OperatorAddress),
+		}))
+	}
+}
+
+// notifyValidatorSetUpdate sends the validator updates returned by EndBlock, with the deltas from lastPowers
+func (app *CetChainApp) notifyValidatorSetUpdate(ctx sdk.Context, updates []abci.ValidatorUpdate, lastPowers lastValidatorPowers) {
+	if len(updates) == 0 {
+		return
+	}
+	res := notify.NotificationValidatorSetUpdate{
+		Version: notify.SchemaVersion,
+		Height:  ctx.BlockHeight(),
+		Updates: make([]notify.ValidatorPowerUpdate, 0, len(updates)),
+	}
+	for _, update := range updates {
+		pubKey, err := tmtypes.PB2TM.PubKey(update.PubKey)
+		if err != nil {
+			continue
+		}
+		consAddr := sdk.ConsAddress(pubKey.Address())
+		last := lastPowers[consAddr.String()]
+		operator := last.operator
+		if validator, found := app.stakingKeeper.GetValidatorByConsAddr(ctx, consAddr); found {
+			operator = validator.OperatorAddress.String()
+		}
+		consPubKey, _ := sdk.Bech32ifyConsPub(pubKey)
+		res.Updates = append(res.Updates, notify.ValidatorPowerUpdate{
+			Validator:   operator,
+			ConsAddress: consAddr.String(),
+			ConsPubKey:  consPubKey,
+			Power:       update.Power,
+			PowerDelta:  update.Power - last.power,
+		})
+	}
+	app.appendPubMsgKV(notify.KeyValidatorSetUpdate, dex.SafeJSONMarshal(res))
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/cosmos/cosmos-sdk/x/slashing"
+	sltypes "github.com/cosmos/cosmos-sdk/x/slashing/types"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+
+	"github.com/coinexchain/cet-sdk/testutil"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func lastPubMsgOf(t *testing.T, app *CetChainApp, key string) []byte {
+	values := pubMsgsOf(app, key)
+	require.NotEqual(t, 0, len(values), key)
+	return values[len(values)-1]
+}
+
+func TestValidatorNotifications(t *testing.T) {
+	val1Key, val1Acc := testutil.NewBaseAccount(cetToken().GetTotalSupply().Int64()-1e10, 0, 0)
+	val2Key, val2Acc := testutil.NewBaseAccount(1e10, 1, 0)
+	val1Addr, val2Addr := sdk.ValAddress(val1Acc.Address), sdk.ValAddress(val2Acc.Address)
+	val2ConsAddr := sdk.ConsAddress(val2Acc.PubKey.Address())
+	app := initApp(func(genState *GenesisState) {
+		addGenesisAccounts(genState, val1Acc, val2Acc)
+		genState.StakingXData.Params.MinSelfDelegation = 1e8
+		genState.SlashingData.Params.SignedBlocksWindow = 10
+		genState.SlashingData.Params.MinSignedPerWindow = sdk.NewDecWithPrec(5, 1)
+		genState.SlashingData.Params.DowntimeJailDuration = time.Minute
+	})
+
+	// block 1: two validators
+	blockTime := time.Unix(1600000000, 0).UTC()
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 1, Time: blockTime}})
+	for i, acc := range []auth.BaseAccount{val1Acc, val2Acc} {
+		key := val1Key
+		if i == 1 {
+			key = val2Key
+		}
+		msg := testutil.NewMsgCreateValidatorBuilder(sdk.ValAddress(acc.Address), acc.PubKey).
+			MinSelfDelegation(1e8).SelfDelegation(int64(i+1)*1e9).Commission("0.1", "0.1", "0.01").Build()
+		tx := newStdTxBuilder().Msgs(msg).GasAndFee(1000000, 100).AccNumSeqKey(uint64(i), 0, key).Build()
+		require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	}
+	created := pubMsgsOf(app, notify.KeyValidatorCreated)
+	require.Equal(t, 2, len(created))
+	created2, err := notify.DecodeValidatorCreated(created[1])
+	require.Nil(t, err)
+	require.Equal(t, val2Addr.String(), created2.Validator)
+	require.Equal(t, val2ConsAddr.String(), created2.ConsAddress)
+	require.Equal(t, sdk.MustBech32ifyConsPub(val2Acc.PubKey), created2.ConsPubKey)
+	require.Equal(t, val2Acc.Address.String(), created2.Delegator)
+	require.Equal(t, sdk.MustNewDecFromStr("0.1"), created2.CommissionRate)
+	require.Equal(t, sdk.NewInt(1e8), created2.MinSelfDelegation)
+	require.Equal(t, dex.NewCetCoins(2e9), created2.SelfDelegation)
+	require.Equal(t, int64(2000), created2.Power)
+	require.Equal(t, int64(2000), created2.PowerDelta)
+
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	update, err := notify.DecodeValidatorSetUpdate(lastPubMsgOf(t, app, notify.KeyValidatorSetUpdate))
+	require.Nil(t, err)
+	require.Equal(t, int64(1), update.Height)
+	require.Equal(t, 2, len(update.Updates))
+	powers := make(map[string]notify.ValidatorPowerUpdate)
+	for _, u := range update.Updates {
+		powers[u.Validator] = u
+	}
+	require.Equal(t, int64(1000), powers[val1Addr.String()].Power)
+	require.Equal(t, int64(1000), powers[val1Addr.String()].PowerDelta)
+	require.Equal(t, int64(2000), powers[val2Addr.String()].PowerDelta)
+	require.Equal(t, val2ConsAddr.String(), powers[val2Addr.String()].ConsAddress)
+	app.Commit()
+
+	// block 2: val2 is edited
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: 2, Time: blockTime.Add(5 * time.Second)}})
+	editMsg := staking.NewMsgEditValidator(val2Addr, staking.NewDescription("val2", "", "", ""), nil, nil)
+	tx := newStdTxBuilder().Msgs(editMsg).GasAndFee(1000000, 100).AccNumSeqKey(1, 1, val2Key).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	edited, err := notify.DecodeValidatorEdited(lastPubMsgOf(t, app, notify.KeyValidatorEdited))
+	require.Nil(t, err)
+	require.Equal(t, val2Addr.String(), edited.Validator)
+	require.Equal(t, "val2", edited.Moniker)
+	require.Equal(t, int64(2000), edited.Power)
+	require.Equal(t, int64(0), edited.PowerDelta)
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+
+	// val2 misses the blocks until it is jailed
+	val1Vote := abci.VoteInfo{Validator: abci.Validator{Address: val1Acc.PubKey.Address(), Power: 1000}, SignedLastBlock: true}
+	val2Vote := abci.VoteInfo{Validator: abci.Validator{Address: val2Acc.PubKey.Address(), Power: 2000}}
+	var jailed *notify.NotificationValidatorJailed
+	height := int64(3)
+	for ; jailed == nil && height < 20; height++ {
+		blockTime = blockTime.Add(5 * time.Second)
+		app.BeginBlock(abci.RequestBeginBlock{
+			Header:         abci.Header{ChainID: testChainID, Height: height, Time: blockTime},
+			LastCommitInfo: abci.LastCommitInfo{Votes: []abci.VoteInfo{val1Vote, val2Vote}},
+		})
+		if values := pubMsgsOf(app, notify.KeyValidatorJailed); len(values) != 0 {
+			jailed, err = notify.DecodeValidatorJailed(values[0])
+			require.Nil(t, err)
+		}
+		app.EndBlock(abci.RequestEndBlock{Height: height})
+		if jailed != nil {
+			update, err = notify.DecodeValidatorSetUpdate(lastPubMsgOf(t, app, notify.KeyValidatorSetUpdate))
+			require.Nil(t, err)
+		}
+		app.Commit()
+	}
+	require.NotNil(t, jailed)
+	require.Equal(t, val2Addr.String(), jailed.Validator)
+	require.Equal(t, val2ConsAddr.String(), jailed.ConsAddress)
+	require.Equal(t, sltypes.AttributeValueMissingSignature, jailed.Reason)
+	require.Equal(t, int64(0), jailed.Power)
+	require.Equal(t, int64(-2000), jailed.PowerDelta)
+	require.Equal(t, []notify.ValidatorPowerUpdate{{Validator: val2Addr.String(), ConsAddress: val2ConsAddr.String(),
+		ConsPubKey: sdk.MustBech32ifyConsPub(val2Acc.PubKey), Power: 0, PowerDelta: -2000}}, update.Updates)
+
+	// val2 is unjailed after the jail duration
+	blockTime = blockTime.Add(2 * time.Minute)
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{ChainID: testChainID, Height: height, Time: blockTime}})
+	tx = newStdTxBuilder().Msgs(slashing.NewMsgUnjail(val2Addr)).GasAndFee(1000000, 100).
+		AccNumSeqKey(1, 2, val2Key).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	unjailed, err := notify.DecodeValidatorUnjailed(lastPubMsgOf(t, app, notify.KeyValidatorUnjailed))
+	require.Nil(t, err)
+	require.Equal(t, val2Addr.String(), unjailed.Validator)
+	require.True(t, unjailed.Power > 0)
+	require.Equal(t, unjailed.Power, unjailed.PowerDelta)
+	app.EndBlock(abci.RequestEndBlock{Height: height})
+	update, err = notify.DecodeValidatorSetUpdate(lastPubMsgOf(t, app, notify.KeyValidatorSetUpdate))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(update.Updates))
+	require.Equal(t, unjailed.Power, update.Updates[0].Power)
+	require.Equal(t, unjailed.Power, update.Updates[0].PowerDelta)
+	app.Commit()
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/cosmos/cosmos-sdk/x/distribution"
 	"github.com/cosmos/cosmos-sdk/x/genaccounts"
 	"github.com/cosmos/cosmos-sdk/x/gov"
+	"github.com/cosmos/cosmos-sdk/x/params"
 	"github.com/cosmos/cosmos-sdk/x/staking"
 	"github.com/cosmos/cosmos-sdk/x/supply"
 
@@ -129,7 +130,11 @@ func addAccountForDanglingCET(amount int64, genState *GenesisState) {
 
 func initApp(cb genesisStateCallback, baseAppOptions ...func(*bam.BaseApp)) *CetChainApp {
 	app := newApp(baseAppOptions...)
+	initChain(app, cb)
+	return app
+}
 
+func initChain(app *CetChainApp, cb genesisStateCallback) {
 	// genesis state
 	genState := NewDefaultGenesisState()
 
@@ -145,8 +150,6 @@ func initApp(cb genesisStateCallback, baseAppOptions ...func(*bam.BaseApp)) *Cet
 	// init chain
 	genStateBytes, _ := app.cdc.MarshalJSON(genState)
 	app.InitChain(abci.RequestInitChain{ChainId: testChainID, AppStateBytes: genStateBytes})
-
-	return app
 }
 
 func initAppWithAccounts(accs ...auth.BaseAccount) *CetChainApp {
@@ -842,7 +845,7 @@ func TestMsgSetRefereeHandle(t *testing.T) {
 	require.Equal(t, authx.CodeRefereeChangeTooFast, res.Code)
 }
 
-func TestMarketAndBancorMsgAfterDex3(t *testing.T) {
+func TestDisabledMsgRoutes(t *testing.T) {
 	key, _, fromAddr := testutil.KeyPubAddr()
 	coins := sdk.NewCoins(sdk.NewInt64Coin("cet", 30000000000))
 	acc0 := auth.BaseAccount{Address: fromAddr, Coins: coins}
@@ -858,48 +861,68 @@ func TestMarketAndBancorMsgAfterDex3(t *testing.T) {
 		bancorlite.MsgBancorCancel{Owner: fromAddr, Stock: "foo", Money: "bar"},
 	}
 
-	oldGBH := types.GenesisBlockHeight
-	defer func() { types.GenesisBlockHeight = oldGBH }()
-	types.GenesisBlockHeight = Dex3StartHeight - 1
+	app := initAppWithBaseAccounts(acc0)
+	header := abci.Header{Height: 1}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	ctx := app.NewContext(false, header)
+	proposal := params.NewParameterChangeProposal("disable dex", "disable market and bancorlite", []params.ParamChange{
+		params.NewParamChange(MsgRoutesParamspace, string(KeyDisabledMsgRoutes),
+			`[{"route":"market","height":"3"},{"route":"bancorlite","height":"3"}]`),
+	})
+	handler := app.newParamChangeProposalHandler()
+	for _, value := range []string{
+		`[{"route":"gov","height":"3"}]`,
+		`[{"route":"params","height":"3"}]`,
+		`[{"route":"nosuch","height":"3"}]`,
+		`[{"route":"market","height":"3"},{"route":"market","height":"4"}]`,
+	} {
+		invalid := params.NewParameterChangeProposal("disable", "disable", []params.ParamChange{
+			params.NewParamChange(MsgRoutesParamspace, string(KeyDisabledMsgRoutes), value),
+		})
+		cacheCtx, _ := ctx.CacheContext()
+		err := handler(cacheCtx, invalid)
+		require.NotNil(t, err, value)
+		require.Equal(t, CodeInvalidMsgRoutes, err.Code())
+	}
+	require.Nil(t, handler(ctx, proposal))
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	res := app.Query(abci.RequestQuery{Path: fmt.Sprintf("custom/%s/%s", MsgRoutesQuerierRoute, QueryDisabledMsgRoutes)})
+	require.Equal(t, uint32(sdk.CodeOK), res.Code)
+	var p MsgRoutesParams
+	require.Nil(t, app.cdc.UnmarshalJSON(res.Value, &p))
+	require.Equal(t, []DisabledMsgRoute{{Route: market.ModuleName, Height: 3}, {Route: bancorlite.ModuleName, Height: 3}},
+		p.DisabledMsgRoutes)
 
+	ah := newAnteHelper(app.accountXKeeper, app.stakingXKeeper, app.msgRoutesKeeper)
 	for _, msg := range msgs {
-		app := initAppWithBaseAccounts(acc0)
-		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: Dex3StartHeight}})
-		tx := newStdTxBuilder().
-			Msgs(msg).GasAndFee(1000000, 100).AccNumSeqKey(0, 0, key).Build()
-		result := app.Deliver(tx)
-		require.Equal(t, "DEX3", string(result.Codespace))
-		require.Equal(t, Dex3StartHeight, int(result.Code))
+		require.Nil(t, ah.CheckMsg(ctx.WithBlockHeight(2), msg, ""))
+		require.Equal(t, ErrMsgRouteDisabled(msg.Route(), 3), ah.CheckMsg(ctx.WithBlockHeight(3), msg, ""))
 	}
+	require.Nil(t, ah.CheckMsg(ctx.WithBlockHeight(3), bankx.NewMsgSend(fromAddr, fromAddr, dex.NewCetCoins(1), 0), ""))
 
-	for _, msg := range msgs {
-		app := initAppWithBaseAccounts(acc0)
-		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: Dex3StartHeight}})
-		app.EndBlock(abci.RequestEndBlock{Height: Dex3StartHeight})
+	for h := int64(2); h <= 3; h++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: h, ChainID: testChainID}})
+		app.EndBlock(abci.RequestEndBlock{Height: h})
 		app.Commit()
-
-		// Dex3StartHeight+1
-		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: Dex3StartHeight + 1, ChainID: "c1"}})
-		tx := newStdTxBuilder().
-			Msgs(msg).GasAndFee(1000000, 100).AccNumSeqKey(0, 0, key).Build()
-		result := app.Deliver(tx)
-		//require.Equal(t, "DEX3", string(result.Codespace))
-		require.Equal(t, Dex3StartHeight, int(result.Code))
 	}
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 4, ChainID: testChainID}})
+	tx := newStdTxBuilder().
+		Msgs(msgs[0]).GasAndFee(1000000, 100).AccNumSeqKey(0, 0, key).Build()
+	result := app.Deliver(tx)
+	require.Equal(t, CodespaceApp, result.Codespace)
+	require.Equal(t, CodeMsgRouteDisabled, result.Code)
 }
 
-func TestDEX3BancorCancellation(t *testing.T) {
+func TestDisabledBancorCancellation(t *testing.T) {
 	key, _, fromAddr := testutil.KeyPubAddr()
 	coins := sdk.NewCoins(sdk.NewInt64Coin("cet", 3000000000000))
 	acc0 := auth.BaseAccount{Address: fromAddr, Coins: coins}
 
-	oldGBH := types.GenesisBlockHeight
-	defer func() { types.GenesisBlockHeight = oldGBH }()
-	types.GenesisBlockHeight = Dex3StartHeight - 5
-
 	// create bancors
 	app := initAppWithBaseAccounts(acc0)
-	var h int64 = Dex3StartHeight - 4
+	var h int64 = 1
 	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: h}})
 	msgs := []sdk.Msg{
 		asset.MsgIssueToken{Owner: fromAddr, Symbol: "foo", Identity: "foo", TotalSupply: sdk.NewInt(10000)},
@@ -911,12 +934,14 @@ func TestDEX3BancorCancellation(t *testing.T) {
 		Msgs(msgs...).GasAndFee(1000000, 100).AccNumSeqKey(0, 0, key).Build()
 	result := app.Deliver(tx)
 	require.Equal(t, sdk.CodeOK, result.Code)
+	app.msgRoutesKeeper.SetParams(app.NewContext(false, abci.Header{Height: h}), MsgRoutesParams{
+		DisabledMsgRoutes: []DisabledMsgRoute{{Route: bancorlite.ModuleName, Height: 4}},
+	})
 	app.EndBlock(abci.RequestEndBlock{Height: h})
 	app.Commit()
 
 	// query bancors
-	for i := int64(3); i >= 1; i-- {
-		h = Dex3StartHeight - i
+	for h = 2; h < 4; h++ {
 		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: h}})
 		bis := app.bancorKeeper.GetAllBancorInfos(app.NewContext(false, abci.Header{}))
 		require.Equal(t, 2, len(bis))
@@ -924,13 +949,31 @@ func TestDEX3BancorCancellation(t *testing.T) {
 		app.Commit()
 	}
 
-	// DEX3 start
-	for i := int64(0); i < 3; i++ {
-		h = Dex3StartHeight + i
+	// bancorlite is disabled
+	for ; h < 7; h++ {
 		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: h}})
 		bis := app.bancorKeeper.GetAllBancorInfos(app.NewContext(false, abci.Header{}))
 		require.Equal(t, 0, len(bis))
 		app.EndBlock(abci.RequestEndBlock{Height: h})
 		app.Commit()
 	}
+	acc := app.accountKeeper.GetAccount(app.NewContext(true, abci.Header{}), fromAddr)
+	require.Equal(t, int64(10000), acc.GetCoins().AmountOf("foo").Int64())
+	require.Equal(t, int64(10000), acc.GetCoins().AmountOf("bar").Int64())
+}
+
+func TestCopyForObservers(t *testing.T) {
+	header := abci.Header{Height: 3, AppHash: []byte{1, 2}, LastBlockId: abci.BlockID{Hash: []byte{3}}}
+	copied := copyHeader(header)
+	require.Equal(t, header.AppHash, copied.AppHash)
+	copied.AppHash[0] = 9
+	copied.LastBlockId.Hash[0] = 9
+	require.Equal(t, []byte{1, 2}, header.AppHash)
+	require.Equal(t, []byte{3}, header.LastBlockId.Hash)
+
+	ret := abci.ResponseEndBlock{ValidatorUpdates: []abci.ValidatorUpdate{{Power: 10}}}
+	var res abci.ResponseEndBlock
+	copyProto(&res, &ret)
+	res.ValidatorUpdates[0].Power = 0
+	require.Equal(t, int64(10), ret.ValidatorUpdates[0].Power)
 }
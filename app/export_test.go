@@ -253,3 +253,24 @@ func initAppWithValidators(gs GenesisState) *CetChainApp {
 
 	return app
 }
+
+func TestExportMsgRoutes(t *testing.T) {
+	disabled := []DisabledMsgRoute{{Route: "market", Height: 10}}
+	app1 := initApp(func(genState *GenesisState) {
+		genState.MsgRoutes.DisabledMsgRoutes = disabled
+	})
+	ctx1 := app1.NewContext(false, abci.Header{Height: app1.LastBlockHeight()})
+	require.Equal(t, disabled, app1.msgRoutesKeeper.GetParams(ctx1).DisabledMsgRoutes)
+	genState1 := app1.ExportGenesisState(ctx1)
+	require.Equal(t, disabled, genState1.MsgRoutes.DisabledMsgRoutes)
+
+	_, genState2 := startAppFromGenesisThenExport(genState1)
+	require.Equal(t, disabled, genState2.MsgRoutes.DisabledMsgRoutes)
+
+	// the routes are checked against the router at init
+	require.Panics(t, func() {
+		initApp(func(genState *GenesisState) {
+			genState.MsgRoutes.DisabledMsgRoutes = []DisabledMsgRoute{{Route: "nosuch", Height: 10}}
+		})
+	})
+}
@@ -47,6 +47,7 @@ type GenesisState struct {
 	Incentive    incentive.GenesisState    `json:"incentive"`
 	Supply       supply.GenesisState       `json:"supply"`
 	GenUtil      genutil.GenesisState      `json:"genutil"`
+	MsgRoutes    MsgRoutesParams           `json:"msgroutes"`
 }
 
 func NewDefaultGenesisState() GenesisState {
@@ -70,6 +71,7 @@ func NewDefaultGenesisState() GenesisState {
 		Incentive:    incentive.DefaultGenesisState(),
 		Supply:       supply.DefaultGenesisState(),
 		GenUtil:      genutil.GenesisState{},
+		MsgRoutes:    MsgRoutesParams{DisabledMsgRoutes: []DisabledMsgRoute{}},
 	}
 }
 
@@ -95,6 +97,7 @@ func FromMap(cdc *codec.Codec, g map[string]json.RawMessage) GenesisState {
 	unmarshalField(cdc, g[incentive.ModuleName], &gs.Incentive)
 	unmarshalField(cdc, g[supply.ModuleName], &gs.Supply)
 	unmarshalField(cdc, g[genutil.ModuleName], &gs.GenUtil)
+	unmarshalField(cdc, g[MsgRoutesParamspace], &gs.MsgRoutes)
 
 	return gs
 }
@@ -126,5 +129,6 @@ func (gs GenesisState) toMap(cdc *codec.Codec) map[string]json.RawMessage {
 	m[incentive.ModuleName] = cdc.MustMarshalJSON(gs.Incentive)
 	m[supply.ModuleName] = cdc.MustMarshalJSON(gs.Supply)
 	m[genutil.ModuleName] = cdc.MustMarshalJSON(gs.GenUtil)
+	m[MsgRoutesParamspace] = cdc.MustMarshalJSON(gs.MsgRoutes)
 	return m
 }
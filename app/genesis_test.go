@@ -31,6 +31,24 @@ func TestFromToMap(t *testing.T) {
 	m.toMap(cdc)
 }
 
+func TestValidateMsgRoutesGenesis(t *testing.T) {
+	state := ModuleBasics.DefaultGenesis()
+	require.Nil(t, ModuleBasics.ValidateGenesis(state))
+	delete(state, MsgRoutesParamspace)
+	require.Nil(t, ModuleBasics.ValidateGenesis(state))
+
+	for _, value := range []string{
+		`{"disabled_msg_routes":[{"route":"staking","height":"10"}]}`,
+		`{"disabled_msg_routes":[{"route":"market","height":"0"}]}`,
+		`{"disabled_msg_routes":[{"route":"market","height":"10"},{"route":"market","height":"20"}]}`,
+	} {
+		state[MsgRoutesParamspace] = []byte(value)
+		require.Error(t, ModuleBasics.ValidateGenesis(state), value)
+	}
+	state[MsgRoutesParamspace] = []byte(`{"disabled_msg_routes":[{"route":"market","height":"10"}]}`)
+	require.Nil(t, ModuleBasics.ValidateGenesis(state))
+}
+
 func TestDefaultGenesisState(t *testing.T) {
 	state := ModuleBasics.DefaultGenesis()
 
@@ -0,0 +1,321 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/cobra"
+
+	"github.com/cosmos/cosmos-sdk/client/context"
+	"github.com/cosmos/cosmos-sdk/codec"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/module"
+	"github.com/cosmos/cosmos-sdk/x/crisis"
+	"github.com/cosmos/cosmos-sdk/x/gov"
+	"github.com/cosmos/cosmos-sdk/x/params"
+	"github.com/cosmos/cosmos-sdk/x/slashing"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	"github.com/coinexchain/cet-sdk/modules/bancorlite"
+	"github.com/coinexchain/cet-sdk/modules/market"
+)
+
+const (
+	// MsgRoutesParamspace is the param subspace of the disabled msg routes, which are changed by the
+	// ParameterChangeProposal of the key DisabledMsgRoutes:
+	//
+	//	{"subspace": "msgroutes", "key": "DisabledMsgRoutes",
+	//	 "value": "[{\"route\":\"market\",\"height\":\"5000000\"},{\"route\":\"bancorlite\",\"height\":\"5000000\"}]"}
+	MsgRoutesParamspace = "msgroutes"
+
+	MsgRoutesQuerierRoute      = "msgroutes"
+	QueryDisabledMsgRoutes     = "disabled"
+	QueryBancorShutdownReports = "bancor-reports"
+	QueryAnteRules             = "ante-rules"
+
+	CodespaceApp         sdk.CodespaceType = "app"
+	CodeMsgRouteDisabled sdk.CodeType      = 101
+	CodeInvalidMsgRoutes sdk.CodeType      = 102
+	CodeInvalidUpgrades  sdk.CodeType      = 103
+)
+
+var KeyDisabledMsgRoutes = []byte("DisabledMsgRoutes")
+
+// nonDisableableMsgRoutes can not be disabled, the chain needs them to keep producing blocks and to enable the
+// disabled routes again by governance
+var nonDisableableMsgRoutes = map[string]bool{
+	gov.RouterKey:      true,
+	params.RouterKey:   true,
+	staking.RouterKey:  true,
+	slashing.RouterKey: true,
+	crisis.RouterKey:   true,
+}
+
+var msgRoutesCdc = codec.New()
+
+// DisabledMsgRoute rejects the msgs of Route in the txs from Height on
+type DisabledMsgRoute struct {
+	Route  string `json:"route"`
+	Height int64  `json:"height"`
+}
+
+// MsgRoutesParams is the genesis of the msgroutes module, no route is disabled on a new chain by default
+type MsgRoutesParams struct {
+	DisabledMsgRoutes []DisabledMsgRoute `json:"disabled_msg_routes"`
+}
+
+func (p *MsgRoutesParams) ParamSetPairs() params.ParamSetPairs {
+	return params.ParamSetPairs{
+		{Key: KeyDisabledMsgRoutes, Value: &p.DisabledMsgRoutes},
+	}
+}
+
+func (p MsgRoutesParams) String() string {
+	var sb strings.Builder
+	sb.WriteString("Disabled Msg Routes:\n")
+	for _, r := range p.DisabledMsgRoutes {
+		sb.WriteString(fmt.Sprintf("  %s: %d\n", r.Route, r.Height))
+	}
+	return sb.String()
+}
+
+// ValidateBasic checks the disabled routes without the router of the app
+func (p MsgRoutesParams) ValidateBasic() error {
+	routes := make(map[string]bool, len(p.DisabledMsgRoutes))
+	for _, r := range p.DisabledMsgRoutes {
+		if nonDisableableMsgRoutes[r.Route] {
+			return fmt.Errorf("msg route %s can not be disabled", r.Route)
+		}
+		if r.Height <= 0 {
+			return fmt.Errorf("invalid height %d of disabled msg route %s", r.Height, r.Route)
+		}
+		if routes[r.Route] {
+			return fmt.Errorf("duplicated disabled msg route %s", r.Route)
+		}
+		routes[r.Route] = true
+	}
+	return nil
+}
+
+// Validate also checks that the disabled routes are registered in router
+func (p MsgRoutesParams) Validate(router sdk.Router) error {
+	if err := p.ValidateBasic(); err != nil {
+		return err
+	}
+	for _, r := range p.DisabledMsgRoutes {
+		if router.Route(r.Route) == nil {
+			return fmt.Errorf("unknown msg route %s", r.Route)
+		}
+	}
+	return nil
+}
+
+func MsgRoutesParamKeyTable() params.KeyTable {
+	return params.NewKeyTable().RegisterParamSet(&MsgRoutesParams{})
+}
+
+func ErrMsgRouteDisabled(route string, height int64) sdk.Error {
+	return sdk.NewError(CodespaceApp, CodeMsgRouteDisabled,
+		fmt.Sprintf("msgs of route %s are disabled since height %d", route, height))
+}
+
+func ErrInvalidMsgRoutes(msg string) sdk.Error {
+	return sdk.NewError(CodespaceApp, CodeInvalidMsgRoutes, msg)
+}
+
+// shutdownKeyPrefix is followed by a route in the main store, the value is the first height its shutdown ran at
+var shutdownKeyPrefix = []byte("msgroutes/shutdown/")
+
+// msgRoutesKeeper reads the disabled msg routes, and shuts down the modules of the routes once they are disabled
+type msgRoutesKeeper struct {
+	paramSubspace params.Subspace
+	storeKey      sdk.StoreKey
+	cdc           *codec.Codec
+	router        sdk.Router
+	shutdowns     map[string]func(ctx sdk.Context)
+}
+
+func newMsgRoutesKeeper(paramSubspace params.Subspace, storeKey sdk.StoreKey, cdc *codec.Codec,
+	router sdk.Router) msgRoutesKeeper {
+	return msgRoutesKeeper{
+		paramSubspace: paramSubspace.WithKeyTable(MsgRoutesParamKeyTable()),
+		storeKey:      storeKey,
+		cdc:           cdc,
+		router:        router,
+		shutdowns:     make(map[string]func(ctx sdk.Context)),
+	}
+}
+
+func (k msgRoutesKeeper) GetParams(ctx sdk.Context) (p MsgRoutesParams) {
+	k.paramSubspace.GetIfExists(ctx, KeyDisabledMsgRoutes, &p.DisabledMsgRoutes)
+	return
+}
+
+func (k msgRoutesKeeper) SetParams(ctx sdk.Context, p MsgRoutesParams) {
+	k.paramSubspace.SetParamSet(ctx, &p)
+}
+
+// ValidateParams checks p against the routes of the app
+func (k msgRoutesKeeper) ValidateParams(p MsgRoutesParams) error {
+	return p.Validate(k.router)
+}
+
+// CheckMsgRoute returns an error if route is disabled at the height of ctx
+func (k msgRoutesKeeper) CheckMsgRoute(ctx sdk.Context, route string) sdk.Error {
+	for _, r := range k.GetParams(ctx).DisabledMsgRoutes {
+		if r.Route == route && ctx.BlockHeight() >= r.Height {
+			return ErrMsgRouteDisabled(route, r.Height)
+		}
+	}
+	return nil
+}
+
+// SetShutdown sets the function to clean up the state of route, such as refunding the frozen coins
+func (k msgRoutesKeeper) SetShutdown(route string, shutdown func(ctx sdk.Context)) {
+	k.shutdowns[route] = shutdown
+}
+
+// Shutdown runs the shutdown functions of the disabled routes at every block from their heights on. They
+// must do nothing once the state is cleaned up, so that a route disabled by a proposal with a passed height
+// is still cleaned up. The routes are recorded as shut down until they are enabled again.
+func (k msgRoutesKeeper) Shutdown(ctx sdk.Context) {
+	disabled := make(map[string]bool)
+	for _, r := range k.GetParams(ctx).DisabledMsgRoutes {
+		if ctx.BlockHeight() >= r.Height {
+			disabled[r.Route] = true
+		}
+	}
+	store := ctx.KVStore(k.storeKey)
+	routes := make([]string, 0, len(k.shutdowns))
+	for route := range k.shutdowns {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		key := append(append([]byte{}, shutdownKeyPrefix...), route...)
+		if !disabled[route] {
+			store.Delete(key)
+			continue
+		}
+		k.shutdowns[route](ctx)
+		if !store.Has(key) {
+			store.Set(key, k.cdc.MustMarshalBinaryBare(ctx.BlockHeight()))
+		}
+	}
+}
+
+// IsShutdown returns whether the shutdown of route ran since it is disabled
+func (k msgRoutesKeeper) IsShutdown(ctx sdk.Context, route string) bool {
+	return ctx.KVStore(k.storeKey).Has(append(append([]byte{}, shutdownKeyPrefix...), route...))
+}
+
+func (app *CetChainApp) initMsgRoutes() {
+	app.msgRoutesKeeper = newMsgRoutesKeeper(app.paramsKeeper.Subspace(MsgRoutesParamspace), app.keyMain, app.cdc,
+		app.Router())
+	app.msgRoutesKeeper.SetShutdown(bancorlite.ModuleName, app.cancelAllBancors)
+	app.msgRoutesKeeper.SetShutdown(market.ModuleName, app.cancelAllOrders)
+	app.QueryRouter().AddRoute(MsgRoutesQuerierRoute, app.queryMsgRoutes)
+}
+
+// newParamChangeProposalHandler rejects the proposals which leave the disabled msg routes or the planned upgrades
+// invalid, gov runs it when a proposal is submitted and when it passes
+func (app *CetChainApp) newParamChangeProposalHandler() gov.Handler {
+	handler := params.NewParamChangeProposalHandler(app.paramsKeeper)
+	return func(ctx sdk.Context, content gov.Content) sdk.Error {
+		if err := handler(ctx, content); err != nil {
+			return err
+		}
+		if err := app.msgRoutesKeeper.ValidateParams(app.msgRoutesKeeper.GetParams(ctx)); err != nil {
+			return ErrInvalidMsgRoutes(err.Error())
+		}
+		if err := app.validateUpgradeParams(ctx, app.GetUpgradeParams(ctx)); err != nil {
+			return ErrInvalidUpgrades(err.Error())
+		}
+		return nil
+	}
+}
+
+func (app *CetChainApp) queryMsgRoutes(ctx sdk.Context, path []string, req abci.RequestQuery) ([]byte, sdk.Error) {
+	var res interface{}
+	switch {
+	case len(path) != 0 && path[0] == QueryDisabledMsgRoutes:
+		res = app.msgRoutesKeeper.GetParams(ctx)
+	case len(path) != 0 && path[0] == QueryBancorShutdownReports:
+		res = app.GetBancorShutdownReports(ctx)
+	case len(path) != 0 && path[0] == QueryAnteRules:
+		res = app.anteHelper.rules.RuleSets()
+	default:
+		return nil, sdk.ErrUnknownRequest(fmt.Sprintf("unknown msgroutes query endpoint: %s", strings.Join(path, "/")))
+	}
+	bz, err := codec.MarshalJSONIndent(app.cdc, res)
+	if err != nil {
+		return nil, sdk.ErrInternal(err.Error())
+	}
+	return bz, nil
+}
+
+// MsgRoutesModuleBasic only has the genesis of the disabled msg routes, a genesis without it disables no route
+type MsgRoutesModuleBasic struct{}
+
+var _ module.AppModuleBasic = MsgRoutesModuleBasic{}
+
+func (MsgRoutesModuleBasic) Name() string {
+	return MsgRoutesParamspace
+}
+
+func (MsgRoutesModuleBasic) RegisterCodec(*codec.Codec) {}
+
+func (MsgRoutesModuleBasic) DefaultGenesis() json.RawMessage {
+	return msgRoutesCdc.MustMarshalJSON(MsgRoutesParams{DisabledMsgRoutes: []DisabledMsgRoute{}})
+}
+
+func (MsgRoutesModuleBasic) ValidateGenesis(bz json.RawMessage) error {
+	if len(bz) == 0 {
+		return nil
+	}
+	var p MsgRoutesParams
+	if err := msgRoutesCdc.UnmarshalJSON(bz, &p); err != nil {
+		return fmt.Errorf("failed to unmarshal %s genesis state: %s", MsgRoutesParamspace, err.Error())
+	}
+	return p.ValidateBasic()
+}
+
+func (MsgRoutesModuleBasic) RegisterRESTRoutes(context.CLIContext, *mux.Router) {}
+
+func (MsgRoutesModuleBasic) GetTxCmd(*codec.Codec) *cobra.Command {
+	return nil
+}
+
+func (MsgRoutesModuleBasic) GetQueryCmd(*codec.Codec) *cobra.Command {
+	return nil
+}
+
+// msgRoutesAppModule inits and exports the disabled msg routes, the routes are checked against the router
+type msgRoutesAppModule struct {
+	MsgRoutesModuleBasic
+	keeper msgRoutesKeeper
+}
+
+var _ module.AppModuleGenesis = msgRoutesAppModule{}
+
+func (am msgRoutesAppModule) InitGenesis(ctx sdk.Context, bz json.RawMessage) []abci.ValidatorUpdate {
+	var p MsgRoutesParams
+	msgRoutesCdc.MustUnmarshalJSON(bz, &p)
+	if err := am.keeper.ValidateParams(p); err != nil {
+		panic(err)
+	}
+	am.keeper.SetParams(ctx, p)
+	return nil
+}
+
+func (am msgRoutesAppModule) ExportGenesis(ctx sdk.Context) json.RawMessage {
+	p := am.keeper.GetParams(ctx)
+	if p.DisabledMsgRoutes == nil {
+		p.DisabledMsgRoutes = []DisabledMsgRoute{}
+	}
+	return msgRoutesCdc.MustMarshalJSON(p)
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cosmos/cosmos-sdk/client/context"
+	"github.com/cosmos/cosmos-sdk/types/rest"
+)
+
+// RegisterMsgRoutesRESTRoutes registers the queries of the msgroutes querier, which is not a module
+func RegisterMsgRoutesRESTRoutes(cliCtx context.CLIContext, r *mux.Router) {
+	r.HandleFunc("/msgroutes/disabled", queryMsgRoutesHandlerFn(cliCtx, QueryDisabledMsgRoutes)).Methods("GET")
+	r.HandleFunc("/msgroutes/bancor-reports", queryMsgRoutesHandlerFn(cliCtx, QueryBancorShutdownReports)).Methods("GET")
+	r.HandleFunc("/msgroutes/ante-rules", queryMsgRoutesHandlerFn(cliCtx, QueryAnteRules)).Methods("GET")
+}
+
+func queryMsgRoutesHandlerFn(cliCtx context.CLIContext, endpoint string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cliCtx, ok := rest.ParseQueryHeightOrReturnBadRequest(w, cliCtx, r)
+		if !ok {
+			return
+		}
+		route := fmt.Sprintf("custom/%s/%s", MsgRoutesQuerierRoute, endpoint)
+		res, height, err := cliCtx.QueryWithData(route, nil)
+		if err != nil {
+			rest.WriteErrorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cliCtx = cliCtx.WithHeight(height)
+		rest.PostProcessResponse(w, cliCtx, res)
+	}
+}
@@ -0,0 +1,259 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// messageTypes maps the keys to the types of their messages and describes them
+var messageTypes = map[string]struct {
+	typ  reflect.Type
+	desc string
+}{
+	KeyHeightInfo:           {reflect.TypeOf(NewHeightInfo{}), "a new block begins"},
+	KeyNotifyTx:             {reflect.TypeOf(NotificationTx{}), "a tx is delivered, successful or failed"},
+	KeyBeginUnbonding:       {reflect.TypeOf(NotificationBeginUnbonding{}), "a delegator begins unbonding"},
+	KeyBeginRedelegation:    {reflect.TypeOf(NotificationBeginRedelegation{}), "a delegator begins redelegating"},
+	KeyCompleteUnbonding:    {reflect.TypeOf(NotificationCompleteUnbonding{}), "an unbonding completes"},
+	KeyCompleteRedelegation: {reflect.TypeOf(NotificationCompleteRedelegation{}), "a redelegation completes"},
+	KeySlash:                {reflect.TypeOf(NotificationSlash{}), "a validator is slashed"},
+	KeyValidatorCommission:  {reflect.TypeOf(NotificationValidatorCommission{}), "commission is paid to a validator"},
+	KeyDelegatorRewards:     {reflect.TypeOf(NotificationDelegatorRewards{}), "rewards are paid to a delegator"},
+
+	KeyProposalSubmitted:     {reflect.TypeOf(NotificationProposalSubmitted{}), "a governance proposal is submitted"},
+	KeyProposalDeposit:       {reflect.TypeOf(NotificationProposalDeposit{}), "a deposit is made to a proposal"},
+	KeyProposalVote:          {reflect.TypeOf(NotificationProposalVote{}), "a vote is cast on a proposal"},
+	KeyProposalVotingStarted: {reflect.TypeOf(NotificationProposalVotingStarted{}), "the voting period of a proposal starts"},
+	KeyProposalFinalized:     {reflect.TypeOf(NotificationProposalFinalized{}), "a proposal is tallied or dropped"},
+
+	KeyValidatorJailed:    {reflect.TypeOf(NotificationValidatorJailed{}), "a validator is jailed"},
+	KeyValidatorUnjailed:  {reflect.TypeOf(NotificationValidatorUnjailed{}), "a validator is unjailed"},
+	KeyValidatorCreated:   {reflect.TypeOf(NotificationValidatorCreated{}), "a validator is created"},
+	KeyValidatorEdited:    {reflect.TypeOf(NotificationValidatorEdited{}), "a validator is edited"},
+	KeyValidatorSetUpdate: {reflect.TypeOf(NotificationValidatorSetUpdate{}), "the validator set changes at the end of a block"},
+
+	KeyAccountTouched: {reflect.TypeOf(NotificationAccountTouched{}), "an account is touched in a block, sent at the end of the block"},
+	KeyBlockSummary:   {reflect.TypeOf(NotificationBlockSummary{}), "a block is committed, sent before the commit marker"},
+
+	KeyBancorShutdownReport: {reflect.TypeOf(NotificationBancorShutdownReport{}), "the bancor pools are canceled since the bancorlite route is disabled"},
+}
+
+// Keys returns the keys of all the messages, sorted
+func Keys() []string {
+	keys := make([]string, 0, len(messageTypes))
+	for key := range messageTypes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ErrUnknownKey is returned by Decode for the keys which are not notifications, such as the messages of the
+// modules and the commit marker
+type ErrUnknownKey string
+
+func (e ErrUnknownKey) Error() string {
+	return fmt.Sprintf("unknown notification key: %s", string(e))
+}
+
+// Decode returns a pointer to the message of key decoded from value, e.g. *NotificationTx for "notify_tx".
+// The messages encoded with a newer SchemaVersion are rejected.
+func Decode(key string, value []byte) (interface{}, error) {
+	mt, ok := messageTypes[key]
+	if !ok {
+		return nil, ErrUnknownKey(key)
+	}
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(value, &header); err != nil {
+		return nil, err
+	}
+	if header.Version > SchemaVersion {
+		return nil, fmt.Errorf("%s of schema version %d is newer than the supported version %d",
+			key, header.Version, SchemaVersion)
+	}
+	msg := reflect.New(mt.typ).Interface()
+	if err := json.Unmarshal(value, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func DecodeHeightInfo(value []byte) (*NewHeightInfo, error) {
+	msg, err := Decode(KeyHeightInfo, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NewHeightInfo), nil
+}
+
+func DecodeTx(value []byte) (*NotificationTx, error) {
+	msg, err := Decode(KeyNotifyTx, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationTx), nil
+}
+
+func DecodeBeginUnbonding(value []byte) (*NotificationBeginUnbonding, error) {
+	msg, err := Decode(KeyBeginUnbonding, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationBeginUnbonding), nil
+}
+
+func DecodeBeginRedelegation(value []byte) (*NotificationBeginRedelegation, error) {
+	msg, err := Decode(KeyBeginRedelegation, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationBeginRedelegation), nil
+}
+
+func DecodeCompleteUnbonding(value []byte) (*NotificationCompleteUnbonding, error) {
+	msg, err := Decode(KeyCompleteUnbonding, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationCompleteUnbonding), nil
+}
+
+func DecodeCompleteRedelegation(value []byte) (*NotificationCompleteRedelegation, error) {
+	msg, err := Decode(KeyCompleteRedelegation, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationCompleteRedelegation), nil
+}
+
+func DecodeSlash(value []byte) (*NotificationSlash, error) {
+	msg, err := Decode(KeySlash, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationSlash), nil
+}
+
+func DecodeValidatorCommission(value []byte) (*NotificationValidatorCommission, error) {
+	msg, err := Decode(KeyValidatorCommission, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationValidatorCommission), nil
+}
+
+func DecodeDelegatorRewards(value []byte) (*NotificationDelegatorRewards, error) {
+	msg, err := Decode(KeyDelegatorRewards, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationDelegatorRewards), nil
+}
+
+func DecodeProposalSubmitted(value []byte) (*NotificationProposalSubmitted, error) {
+	msg, err := Decode(KeyProposalSubmitted, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationProposalSubmitted), nil
+}
+
+func DecodeProposalDeposit(value []byte) (*NotificationProposalDeposit, error) {
+	msg, err := Decode(KeyProposalDeposit, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationProposalDeposit), nil
+}
+
+func DecodeProposalVote(value []byte) (*NotificationProposalVote, error) {
+	msg, err := Decode(KeyProposalVote, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationProposalVote), nil
+}
+
+func DecodeProposalVotingStarted(value []byte) (*NotificationProposalVotingStarted, error) {
+	msg, err := Decode(KeyProposalVotingStarted, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationProposalVotingStarted), nil
+}
+
+func DecodeProposalFinalized(value []byte) (*NotificationProposalFinalized, error) {
+	msg, err := Decode(KeyProposalFinalized, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationProposalFinalized), nil
+}
+
+func DecodeValidatorJailed(value []byte) (*NotificationValidatorJailed, error) {
+	msg, err := Decode(KeyValidatorJailed, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationValidatorJailed), nil
+}
+
+func DecodeValidatorUnjailed(value []byte) (*NotificationValidatorUnjailed, error) {
+	msg, err := Decode(KeyValidatorUnjailed, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationValidatorUnjailed), nil
+}
+
+func DecodeValidatorCreated(value []byte) (*NotificationValidatorCreated, error) {
+	msg, err := Decode(KeyValidatorCreated, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationValidatorCreated), nil
+}
+
+func DecodeValidatorEdited(value []byte) (*NotificationValidatorEdited, error) {
+	msg, err := Decode(KeyValidatorEdited, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationValidatorEdited), nil
+}
+
+func DecodeValidatorSetUpdate(value []byte) (*NotificationValidatorSetUpdate, error) {
+	msg, err := Decode(KeyValidatorSetUpdate, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationValidatorSetUpdate), nil
+}
+
+func DecodeAccountTouched(value []byte) (*NotificationAccountTouched, error) {
+	msg, err := Decode(KeyAccountTouched, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationAccountTouched), nil
+}
+
+func DecodeBlockSummary(value []byte) (*NotificationBlockSummary, error) {
+	msg, err := Decode(KeyBlockSummary, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationBlockSummary), nil
+}
+
+func DecodeBancorShutdownReport(value []byte) (*NotificationBancorShutdownReport, error) {
+	msg, err := Decode(KeyBancorShutdownReport, value)
+	if err != nil {
+		return nil, err
+	}
+	return msg.(*NotificationBancorShutdownReport), nil
+}
@@ -0,0 +1,25 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// UnbondingEntryID returns the id of an unbonding entry. The entries of a delegator and a validator with the
+// same creation height and completion time (in unix seconds) are told apart by ordinal, which is the order
+// they are created in.
+func UnbondingEntryID(delegator, validator string, creationHeight, completionTime int64, ordinal int) string {
+	return entryID("unbonding", delegator, validator, creationHeight, completionTime, ordinal)
+}
+
+// RedelegationEntryID returns the id of a redelegation entry like UnbondingEntryID
+func RedelegationEntryID(delegator, src, dst string, creationHeight, completionTime int64, ordinal int) string {
+	return entryID("redelegation", delegator, src+"/"+dst, creationHeight, completionTime, ordinal)
+}
+
+func entryID(kind, delegator, validators string, creationHeight, completionTime int64, ordinal int) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%d/%d/%d",
+		kind, delegator, validators, creationHeight, completionTime, ordinal)))
+	return hex.EncodeToString(hash[:16])
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	slash := NotificationSlash{Version: SchemaVersion, Validator: "cosmosvalcons1", Power: "100",
+		Reason: "double_sign", Jailed: true}
+	bz, err := json.Marshal(slash)
+	require.Nil(t, err)
+	msg, err := Decode(KeySlash, bz)
+	require.Nil(t, err)
+	require.Equal(t, &slash, msg)
+	decoded, err := DecodeSlash(bz)
+	require.Nil(t, err)
+	require.Equal(t, slash, *decoded)
+
+	// the messages before the version field was added
+	tx, err := DecodeTx([]byte(`{"height":10,"serial_number":3,"src":"ignored"}`))
+	require.Nil(t, err)
+	require.Equal(t, 0, tx.Version)
+	require.Equal(t, int64(10), tx.Height)
+	require.Equal(t, int64(3), tx.SerialNumber)
+
+	_, err = DecodeTx([]byte(`{"version":2,"height":10}`))
+	require.NotNil(t, err)
+	_, err = Decode("commit", []byte(`{}`))
+	require.Equal(t, ErrUnknownKey("commit"), err)
+	_, err = DecodeHeightInfo([]byte(`not json`))
+	require.NotNil(t, err)
+}
+
+func TestSchema(t *testing.T) {
+	bz, err := Schema(KeyBeginRedelegation)
+	require.Nil(t, err)
+	var schema struct {
+		Title      string                            `json:"title"`
+		Required   []string                          `json:"required"`
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	require.Nil(t, json.Unmarshal(bz, &schema))
+	require.Equal(t, KeyBeginRedelegation, schema.Title)
+	require.Equal(t, []string{"version", "delegator", "src", "dst", "amount", "coins", "completion_time",
+		"creation_height", "entry_id", "complete_now"}, schema.Required)
+	require.Equal(t, "integer", schema.Properties["completion_time"]["type"])
+	require.Equal(t, "operator address of the validator redelegated from", schema.Properties["src"]["description"])
+
+	bz, err = Schema(KeyNotifyTx)
+	require.Nil(t, err)
+	schema.Required = nil
+	require.Nil(t, json.Unmarshal(bz, &schema))
+	require.NotContains(t, schema.Required, "extra_info")
+	require.Equal(t, "string", schema.Properties["extra_info"]["type"])
+
+	_, err = Schema("commit")
+	require.NotNil(t, err)
+}
+
+// The schemas in docs are generated by `cetdev notify-schemas docs/notify_schemas`
+func TestSchemaDocsUpToDate(t *testing.T) {
+	for _, key := range Keys() {
+		schema, err := Schema(key)
+		require.Nil(t, err)
+		doc, err := ioutil.ReadFile(filepath.Join("..", "..", "docs", "notify_schemas", key+".json"))
+		require.Nil(t, err, key)
+		require.Equal(t, string(schema)+"\n", string(doc), key)
+	}
+}
+
+func TestEntryID(t *testing.T) {
+	id := UnbondingEntryID("del", "val", 10, 1600000000, 0)
+	require.Equal(t, 32, len(id))
+	require.Equal(t, id, UnbondingEntryID("del", "val", 10, 1600000000, 0))
+	require.NotEqual(t, id, UnbondingEntryID("del", "val", 10, 1600000000, 1))
+	require.NotEqual(t, id, UnbondingEntryID("del", "val", 11, 1600000000, 0))
+	require.NotEqual(t, id, RedelegationEntryID("del", "val", "", 10, 1600000000, 0))
+}
@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	cmn "github.com/tendermint/tendermint/libs/common"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// the types which are not encoded by their go kinds
+var schemaOverrides = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(sdk.AccAddress{}): {"type": "string", "description": "bech32 address"},
+	reflect.TypeOf(cmn.HexBytes{}):   {"type": "string", "pattern": "^[0-9A-F]*$"},
+	reflect.TypeOf([]byte{}):         {"type": []string{"string", "null"}, "contentEncoding": "base64"},
+	reflect.TypeOf(sdk.Int{}):        {"type": "string", "pattern": "^-?[0-9]+$"},
+	reflect.TypeOf(sdk.Dec{}):        {"type": "string", "pattern": "^-?[0-9]+\\.[0-9]+$"},
+}
+
+// Schema returns the JSON Schema of the message of key, which is generated from its go type
+func Schema(key string) ([]byte, error) {
+	mt, ok := messageTypes[key]
+	if !ok {
+		return nil, ErrUnknownKey(key)
+	}
+	schema := schemaOf(mt.typ)
+	schema["$schema"] = jsonSchemaDraft
+	schema["$id"] = fmt.Sprintf("https://github.com/coinexchain/dex/notify/v%d/%s.json", SchemaVersion, key)
+	schema["title"] = key
+	schema["description"] = mt.desc
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func schemaOf(t reflect.Type) map[string]interface{} {
+	if s, ok := schemaOverrides[t]; ok {
+		return copySchema(s)
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		// a nil slice is encoded as null
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": schemaOf(t.Elem())}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name, opts := field.Name, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			opts = tag[idx:]
+			tag = tag[:idx]
+		}
+		if len(tag) != 0 {
+			name = tag
+		}
+
+		property := schemaOf(field.Type)
+		if desc := field.Tag.Get("desc"); len(desc) != 0 {
+			property["description"] = desc
+		}
+		properties[name] = property
+		if !strings.Contains(opts, ",omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func copySchema(s map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(s))
+	for k, v := range s {
+		res[k] = v
+	}
+	return res
+}
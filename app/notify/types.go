@@ -0,0 +1,312 @@
+// Package notify defines the notification messages which the node publishes to msgqueue and the pub message
+// sinks, with decoders and JSON Schemas for their consumers.
+//
+// Every message carries the SchemaVersion it is encoded with. A field is only added within a version, fields
+// are never renamed or removed without bumping it, so a consumer can reject the versions newer than the one
+// it is built with. Messages without the version field are written by the nodes before it was introduced.
+package notify
+
+import (
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// SchemaVersion is the version of the messages encoded by this package
+const SchemaVersion = 1
+
+// The keys of the messages
+const (
+	KeyHeightInfo           = "height_info"
+	KeyNotifyTx             = "notify_tx"
+	KeyBeginUnbonding       = "begin_unbonding"
+	KeyBeginRedelegation    = "begin_redelegation"
+	KeyCompleteUnbonding    = "complete_unbonding"
+	KeyCompleteRedelegation = "complete_redelegation"
+	KeySlash                = "slash"
+	KeyValidatorCommission  = "validator_commission"
+	KeyDelegatorRewards     = "delegator_rewards"
+
+	KeyProposalSubmitted     = "proposal_submitted"
+	KeyProposalDeposit       = "proposal_deposit"
+	KeyProposalVote          = "proposal_vote"
+	KeyProposalVotingStarted = "proposal_voting_started"
+	KeyProposalFinalized     = "proposal_finalized"
+
+	KeyValidatorJailed    = "validator_jailed"
+	KeyValidatorUnjailed  = "validator_unjailed"
+	KeyValidatorCreated   = "validator_created"
+	KeyValidatorEdited    = "validator_edited"
+	KeyValidatorSetUpdate = "validator_set_update"
+
+	KeyAccountTouched = "account_touched"
+	KeyBlockSummary   = "block_summary"
+
+	KeyBancorShutdownReport = "bancor_shutdown_report"
+)
+
+type NewHeightInfo struct {
+	Version       int          `json:"version" desc:"schema version of the message"`
+	ChainID       string       `json:"chain_id" desc:"chain id"`
+	Height        int64        `json:"height" desc:"height of the new block"`
+	TimeStamp     int64        `json:"timestamp" desc:"block time in unix seconds"`
+	LastBlockHash cmn.HexBytes `json:"last_block_hash" desc:"hash of the previous block, in hex"`
+}
+
+type TxExtraInfo struct {
+	Code      uint32       `json:"code,omitempty" desc:"result code of the failed tx"`
+	Data      []byte       `json:"data,omitempty" desc:"result data, in base64"`
+	Log       string       `json:"log,omitempty" desc:"result log"`
+	Info      string       `json:"info,omitempty" desc:"result info"`
+	GasWanted int64        `json:"gas_wanted,omitempty" desc:"gas limit of the tx"`
+	GasUsed   int64        `json:"gas_used,omitempty" desc:"gas consumed by the tx"`
+	Events    []abci.Event `json:"events,omitempty" desc:"events emitted by the tx"`
+	Codespace string       `json:"codespace,omitempty" desc:"codespace of the result code"`
+}
+
+type TransferRecord struct {
+	Sender    string    `json:"sender" desc:"bech32 address the coins are sent from"`
+	Recipient string    `json:"recipient" desc:"bech32 address the coins are sent to"`
+	Amount    string    `json:"amount" desc:"coins transferred, like 100cet,20abc"`
+	Coins     sdk.Coins `json:"coins" desc:"coins transferred, by denom"`
+}
+
+type NotificationTx struct {
+	Version      int              `json:"version" desc:"schema version of the message"`
+	Signers      []sdk.AccAddress `json:"signers" desc:"bech32 addresses of the signers"`
+	Transfers    []TransferRecord `json:"transfers" desc:"coin transfers made by the tx"`
+	SerialNumber int64            `json:"serial_number" desc:"number of the tx among all the txs of the chain, from 0"`
+	MsgTypes     []string         `json:"msg_types" desc:"go types of the msgs in the tx"`
+	TxJSON       string           `json:"tx_json" desc:"the tx in amino JSON"`
+	Height       int64            `json:"height" desc:"height of the block"`
+	Hash         []byte           `json:"hash" desc:"hash of the tx, in base64"`
+	ExtraInfo    string           `json:"extra_info,omitempty" desc:"TxExtraInfo in JSON, only for a failed tx"`
+}
+
+type NotificationBeginRedelegation struct {
+	Version        int       `json:"version" desc:"schema version of the message"`
+	Delegator      string    `json:"delegator" desc:"bech32 address of the delegator"`
+	ValidatorSrc   string    `json:"src" desc:"operator address of the validator redelegated from"`
+	ValidatorDst   string    `json:"dst" desc:"operator address of the validator redelegated to"`
+	Amount         string    `json:"amount" desc:"amount of cet redelegated"`
+	Coins          sdk.Coins `json:"coins" desc:"coins redelegated"`
+	CompletionTime int64     `json:"completion_time" desc:"unix seconds when the redelegation completes"`
+	CreationHeight int64     `json:"creation_height" desc:"creation height of the entry, the unbonding height of src if it is unbonding"`
+	EntryID        string    `json:"entry_id" desc:"id of the entry, which is in the complete_redelegation message of it"`
+	CompleteNow    bool      `json:"complete_now" desc:"src is unbonded, so no entry is created and no complete_redelegation follows"`
+}
+
+type NotificationBeginUnbonding struct {
+	Version        int       `json:"version" desc:"schema version of the message"`
+	Delegator      string    `json:"delegator" desc:"bech32 address of the delegator"`
+	Validator      string    `json:"validator" desc:"operator address of the validator"`
+	Amount         string    `json:"amount" desc:"amount of cet unbonded"`
+	Coins          sdk.Coins `json:"coins" desc:"coins unbonded"`
+	CompletionTime int64     `json:"completion_time" desc:"unix seconds when the unbonding completes"`
+	CreationHeight int64     `json:"creation_height" desc:"creation height of the entry"`
+	EntryID        string    `json:"entry_id" desc:"id of the entry, which is in the complete_unbonding message of it"`
+}
+
+// CompletedEntry is an unbonding or redelegation entry completed in a block
+type CompletedEntry struct {
+	EntryID        string    `json:"entry_id" desc:"id of the entry, the same as in its begin message"`
+	CreationHeight int64     `json:"creation_height" desc:"creation height of the entry"`
+	CompletionTime int64     `json:"completion_time" desc:"unix seconds when the entry completes"`
+	Coins          sdk.Coins `json:"coins" desc:"coins returned to the delegator, or redelegated, after slashing"`
+}
+
+type NotificationCompleteRedelegation struct {
+	Version      int              `json:"version" desc:"schema version of the message"`
+	Delegator    string           `json:"delegator" desc:"bech32 address of the delegator"`
+	ValidatorSrc string           `json:"src" desc:"operator address of the validator redelegated from"`
+	ValidatorDst string           `json:"dst" desc:"operator address of the validator redelegated to"`
+	Coins        sdk.Coins        `json:"coins" desc:"coins of the completed entries"`
+	Entries      []CompletedEntry `json:"entries" desc:"the completed entries"`
+}
+
+type NotificationCompleteUnbonding struct {
+	Version   int              `json:"version" desc:"schema version of the message"`
+	Delegator string           `json:"delegator" desc:"bech32 address of the delegator"`
+	Validator string           `json:"validator" desc:"operator address of the validator"`
+	Coins     sdk.Coins        `json:"coins" desc:"coins returned to the delegator"`
+	Entries   []CompletedEntry `json:"entries" desc:"the completed entries"`
+}
+
+type NotificationSlash struct {
+	Version   int    `json:"version" desc:"schema version of the message"`
+	Validator string `json:"validator" desc:"consensus address of the slashed validator"`
+	Power     string `json:"power" desc:"voting power of the validator when it is slashed"`
+	Reason    string `json:"reason" desc:"double_sign or missing_signature"`
+	Jailed    bool   `json:"jailed" desc:"whether the validator is jailed"`
+}
+
+type NotificationValidatorCommission struct {
+	Version    int    `json:"version" desc:"schema version of the message"`
+	Validator  string `json:"validator" desc:"operator address of the validator"`
+	Commission string `json:"commission" desc:"decimal coins of the commission, like 1.5cet"`
+}
+
+type NotificationDelegatorRewards struct {
+	Version   int    `json:"version" desc:"schema version of the message"`
+	Validator string `json:"validator" desc:"operator address of the validator"`
+	Rewards   string `json:"rewards" desc:"decimal coins of the rewards, like 1.5cet"`
+}
+
+type NotificationProposalSubmitted struct {
+	Version        int       `json:"version" desc:"schema version of the message"`
+	ProposalID     uint64    `json:"proposal_id" desc:"id of the proposal"`
+	Proposer       string    `json:"proposer" desc:"bech32 address of the proposer"`
+	ProposalType   string    `json:"proposal_type" desc:"type of the proposal content, like Text or ParameterChange"`
+	Title          string    `json:"title" desc:"title of the proposal"`
+	Description    string    `json:"description" desc:"description of the proposal"`
+	InitialDeposit sdk.Coins `json:"initial_deposit" desc:"deposit made by the proposer on submission"`
+	SubmitTime     int64     `json:"submit_time" desc:"unix seconds when the proposal is submitted"`
+	DepositEndTime int64     `json:"deposit_end_time" desc:"unix seconds when the deposit period ends"`
+}
+
+type NotificationProposalDeposit struct {
+	Version      int       `json:"version" desc:"schema version of the message"`
+	ProposalID   uint64    `json:"proposal_id" desc:"id of the proposal"`
+	Depositor    string    `json:"depositor" desc:"bech32 address of the depositor"`
+	Amount       sdk.Coins `json:"amount" desc:"coins deposited"`
+	TotalDeposit sdk.Coins `json:"total_deposit" desc:"total deposit of the proposal after the tx"`
+}
+
+type NotificationProposalVote struct {
+	Version    int    `json:"version" desc:"schema version of the message"`
+	ProposalID uint64 `json:"proposal_id" desc:"id of the proposal"`
+	Voter      string `json:"voter" desc:"bech32 address of the voter"`
+	Option     string `json:"option" desc:"Yes, Abstain, No or NoWithVeto, a later vote replaces the earlier one"`
+}
+
+type NotificationProposalVotingStarted struct {
+	Version         int    `json:"version" desc:"schema version of the message"`
+	ProposalID      uint64 `json:"proposal_id" desc:"id of the proposal"`
+	VotingStartTime int64  `json:"voting_start_time" desc:"unix seconds when the voting period starts"`
+	VotingEndTime   int64  `json:"voting_end_time" desc:"unix seconds when the voting period ends"`
+}
+
+type TallyResult struct {
+	Yes        sdk.Int `json:"yes" desc:"voting power of Yes"`
+	Abstain    sdk.Int `json:"abstain" desc:"voting power of Abstain"`
+	No         sdk.Int `json:"no" desc:"voting power of No"`
+	NoWithVeto sdk.Int `json:"no_with_veto" desc:"voting power of NoWithVeto"`
+}
+
+type NotificationProposalFinalized struct {
+	Version    int         `json:"version" desc:"schema version of the message"`
+	ProposalID uint64      `json:"proposal_id" desc:"id of the proposal"`
+	Result     string      `json:"result" desc:"proposal_passed, proposal_rejected, proposal_failed or proposal_dropped"`
+	Status     string      `json:"status" desc:"final status, Passed, Rejected or Failed, empty for a dropped proposal which is deleted"`
+	Tally      TallyResult `json:"tally" desc:"final tally result, zero for a dropped proposal"`
+}
+
+type NotificationValidatorJailed struct {
+	Version     int    `json:"version" desc:"schema version of the message"`
+	Validator   string `json:"validator" desc:"operator address of the validator"`
+	ConsAddress string `json:"cons_address" desc:"consensus address of the validator"`
+	Reason      string `json:"reason" desc:"double_sign or missing_signature"`
+	Power       int64  `json:"power" desc:"voting power of the validator after it is removed from the validator set, 0"`
+	PowerDelta  int64  `json:"power_delta" desc:"change of the voting power, taking effect in the validator_set_update of the block"`
+}
+
+type NotificationValidatorUnjailed struct {
+	Version     int    `json:"version" desc:"schema version of the message"`
+	Validator   string `json:"validator" desc:"operator address of the validator"`
+	ConsAddress string `json:"cons_address" desc:"consensus address of the validator"`
+	Power       int64  `json:"power" desc:"voting power of the bonded tokens of the validator, which it has if it enters the validator set"`
+	PowerDelta  int64  `json:"power_delta" desc:"power minus the voting power in the last validator set"`
+}
+
+type NotificationValidatorCreated struct {
+	Version           int       `json:"version" desc:"schema version of the message"`
+	Validator         string    `json:"validator" desc:"operator address of the validator"`
+	ConsAddress       string    `json:"cons_address" desc:"consensus address of the validator"`
+	ConsPubKey        string    `json:"cons_pubkey" desc:"bech32 consensus public key of the validator"`
+	Delegator         string    `json:"delegator" desc:"bech32 address making the self delegation"`
+	Moniker           string    `json:"moniker" desc:"moniker of the validator"`
+	CommissionRate    sdk.Dec   `json:"commission_rate" desc:"commission rate of the validator"`
+	MinSelfDelegation sdk.Int   `json:"min_self_delegation" desc:"minimum self delegation of the validator"`
+	SelfDelegation    sdk.Coins `json:"self_delegation" desc:"coins of the self delegation"`
+	Power             int64     `json:"power" desc:"voting power of the bonded tokens of the validator, which it has if it enters the validator set"`
+	PowerDelta        int64     `json:"power_delta" desc:"power minus the voting power in the last validator set, which is power"`
+}
+
+type NotificationValidatorEdited struct {
+	Version           int     `json:"version" desc:"schema version of the message"`
+	Validator         string  `json:"validator" desc:"operator address of the validator"`
+	Moniker           string  `json:"moniker" desc:"moniker of the validator after the edit"`
+	CommissionRate    sdk.Dec `json:"commission_rate" desc:"commission rate of the validator after the edit"`
+	MinSelfDelegation sdk.Int `json:"min_self_delegation" desc:"minimum self delegation of the validator after the edit"`
+	Power             int64   `json:"power" desc:"voting power of the validator, which is not changed by the edit"`
+	PowerDelta        int64   `json:"power_delta" desc:"power minus the voting power in the last validator set"`
+}
+
+// ValidatorPowerUpdate is a change of the validator set sent to tendermint
+type ValidatorPowerUpdate struct {
+	Validator   string `json:"validator" desc:"operator address of the validator"`
+	ConsAddress string `json:"cons_address" desc:"consensus address of the validator"`
+	ConsPubKey  string `json:"cons_pubkey" desc:"bech32 consensus public key of the validator"`
+	Power       int64  `json:"power" desc:"new voting power, 0 if the validator is removed from the set"`
+	PowerDelta  int64  `json:"power_delta" desc:"new voting power minus the one in the last validator set"`
+}
+
+type NotificationValidatorSetUpdate struct {
+	Version int                    `json:"version" desc:"schema version of the message"`
+	Height  int64                  `json:"height" desc:"height of the block, the updates take effect at height+2"`
+	Updates []ValidatorPowerUpdate `json:"updates" desc:"the validators whose voting power changes"`
+}
+
+// The reasons why an account is touched
+const (
+	ReasonSigner                = "signer"
+	ReasonFeePayer              = "fee_payer"
+	ReasonSender                = "sender"
+	ReasonRecipient             = "recipient"
+	ReasonRewardRecipient       = "reward_recipient"
+	ReasonDelegator             = "delegator"
+	ReasonUnbondingCompleted    = "unbonding_completed"
+	ReasonRedelegationCompleted = "redelegation_completed"
+)
+
+type NotificationAccountTouched struct {
+	Version  int            `json:"version" desc:"schema version of the message"`
+	Height   int64          `json:"height" desc:"height of the block"`
+	Address  string         `json:"address" desc:"bech32 address of the account"`
+	TxHashes []cmn.HexBytes `json:"tx_hashes" desc:"hashes of the txs touching the account in the block, in hex, empty if it is only touched by BeginBlock or EndBlock"`
+	Reasons  []string       `json:"reasons" desc:"signer, fee_payer, sender, recipient, reward_recipient, delegator, unbonding_completed or redelegation_completed"`
+}
+
+type NotificationBlockSummary struct {
+	Version           int          `json:"version" desc:"schema version of the message"`
+	Height            int64        `json:"height" desc:"height of the block"`
+	TxCount           int64        `json:"tx_count" desc:"number of the txs in the block"`
+	FailedTxCount     int64        `json:"failed_tx_count" desc:"number of the failed txs in the block"`
+	GasUsed           int64        `json:"gas_used" desc:"total gas consumed by the txs"`
+	Fees              sdk.Coins    `json:"fees" desc:"sum of the fees paid by the txs, including the ones failing in their msgs but not in the ante handler"`
+	OtherInflows      sdk.Coins    `json:"other_inflows" desc:"other coins collected by the fee collector in the txs and EndBlock, such as the activation and lock fees"`
+	AppHash           cmn.HexBytes `json:"app_hash" desc:"app hash after the block, which is in the header of the next block, in hex"`
+	Proposer          string       `json:"proposer" desc:"consensus address of the proposer"`
+	ProposerValidator string       `json:"proposer_validator" desc:"operator address of the proposer, empty if it is not found"`
+	MsgCount          int64        `json:"msg_count" desc:"number of the messages of the block before this one, from height_info"`
+}
+
+// BancorRefund is a bancor pool canceled since the bancorlite route is disabled, a pool which is not removed is
+// canceled again at the next block
+type BancorRefund struct {
+	Owner       string  `json:"owner" desc:"owner of the pool"`
+	Stock       string  `json:"stock" desc:"stock of the pool"`
+	Money       string  `json:"money" desc:"money of the pool"`
+	StockAmount sdk.Int `json:"stock_amount" desc:"stock in the pool, which is unfrozen to the owner"`
+	MoneyAmount sdk.Int `json:"money_amount" desc:"money in the pool, which is unfrozen to the owner"`
+	Success     bool    `json:"success" desc:"whether all the coins in the pool are unfrozen"`
+	Removed     bool    `json:"removed" desc:"whether the pool is removed, a pool is kept unchanged if its coins are not unfrozen"`
+	Error       string  `json:"error" desc:"why the coins are not unfrozen, empty on success"`
+}
+
+type NotificationBancorShutdownReport struct {
+	Version int            `json:"version" desc:"schema version of the message"`
+	Height  int64          `json:"height" desc:"height of the block whose BeginBlock cancels the pools"`
+	Refunds []BancorRefund `json:"refunds" desc:"the canceled pools, and the kept pools whose errors are new"`
+}
@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/cosmos/cosmos-sdk/client/flags"
+	"github.com/spf13/viper"
+)
+
+const (
+	AdminSocketFile = "admin.sock"
+
+	AdminCmdStatus   = "status"
+	AdminCmdLoad     = "load"
+	AdminCmdUnload   = "unload"
+	AdminCmdEnable   = "enable"
+	AdminCmdDisable  = "disable"
+	AdminCmdReload   = "reload"
+	AdminCmdUpgrade  = "upgrade"
+	AdminCmdRollback = "rollback"
+)
+
+// AdminResponse is returned by every admin command, with the status of the whole chain after the command
+type AdminResponse struct {
+	Plugins []PluginStatus `json:"plugins"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// DefaultAdminSocket returns the unix socket of the admin endpoint in the plugins directory of the node
+func DefaultAdminSocket() string {
+	rootDir := viper.GetString(flags.FlagHome)
+	return path.Join(rootDir, PluginsDir, AdminSocketFile)
+}
+
+// StartAdminServer serves the plugin admin commands on a unix socket, which is only reachable from the
+// local machine. A stale socket file left by a crashed node is removed before listening.
+func (loader *Holder) StartAdminServer(socket string) error {
+	if err := os.MkdirAll(path.Dir(socket), 0750); err != nil {
+		return err
+	}
+	if _, err := os.Stat(socket); err == nil {
+		if err = os.Remove(socket); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		if err := http.Serve(listener, loader.adminHandler()); err != nil {
+			loader.logger.Error(fmt.Sprintf("plugin admin server stopped: %s", err.Error()))
+		}
+	}()
+	loader.logger.Info(fmt.Sprintf("plugin admin server is listening on %s", socket))
+	return nil
+}
+
+// adminHandler serves status with any method, the commands changing the chain are only accepted as POST
+func (loader *Holder) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+AdminCmdStatus, loader.adminCmd(false, func(name, file string) error {
+		return nil
+	}))
+	mux.HandleFunc("/"+AdminCmdLoad, loader.adminCmd(true, loader.LoadPlugin))
+	mux.HandleFunc("/"+AdminCmdUnload, loader.adminCmd(true, func(name, file string) error {
+		return loader.UnloadPlugin(name)
+	}))
+	mux.HandleFunc("/"+AdminCmdEnable, loader.adminCmd(true, func(name, file string) error {
+		return loader.EnablePlugin(name)
+	}))
+	mux.HandleFunc("/"+AdminCmdDisable, loader.adminCmd(true, func(name, file string) error {
+		return loader.DisablePlugin(name)
+	}))
+	mux.HandleFunc("/"+AdminCmdReload, loader.adminCmd(true, func(name, file string) error {
+		return loader.ReloadPlugins()
+	}))
+	mux.HandleFunc("/"+AdminCmdUpgrade, loader.adminCmd(true, loader.UpgradePlugin))
+	mux.HandleFunc("/"+AdminCmdRollback, loader.adminCmd(true, func(name, file string) error {
+		return loader.RollbackPlugin(name)
+	}))
+	return mux
+}
+
+func (loader *Holder) adminCmd(postOnly bool, cmd func(name, file string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var res AdminResponse
+		status := http.StatusOK
+		if postOnly && r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			res.Error = fmt.Sprintf("method %s is not allowed, use POST", r.Method)
+			status = http.StatusMethodNotAllowed
+		} else if err := cmd(r.FormValue("name"), r.FormValue("file")); err != nil {
+			res.Error = err.Error()
+			status = http.StatusBadRequest
+		}
+		res.Plugins = loader.GetPluginsStatus()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+// AdminClient sends the admin commands to a running node
+type AdminClient struct {
+	socket string
+	client *http.Client
+}
+
+func NewAdminClient(socket string) AdminClient {
+	return AdminClient{
+		socket: socket,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Send executes cmd on the node. The error of a failed command is returned together with the status of the chain.
+func (c AdminClient) Send(cmd, name, file string) (AdminResponse, error) {
+	var res AdminResponse
+	form := url.Values{}
+	form.Set("name", name)
+	form.Set("file", file)
+
+	resp, err := c.client.PostForm("http://unix/"+cmd, form)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return res, err
+	}
+	if err = json.Unmarshal(body, &res); err != nil {
+		return res, fmt.Errorf("invalid response from %s: %s", c.socket, string(body))
+	}
+	if len(res.Error) != 0 {
+		return res, fmt.Errorf("%s", res.Error)
+	}
+	return res, nil
+}
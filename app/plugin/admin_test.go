@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestAdminServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugin_admin")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	holder := Holder{}
+	holder.InitPluginHolder(log.NewNopLogger())
+	holder.plugins = []*pluginEntry{
+		{name: "checker", path: "checker.so", instance: checkerPlugin{}, isEnabled: 1},
+	}
+
+	socket := path.Join(dir, "data", AdminSocketFile)
+	require.Nil(t, holder.StartAdminServer(socket))
+	client := NewAdminClient(socket)
+
+	res, err := client.Send(AdminCmdStatus, "", "")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(res.Plugins))
+	require.Equal(t, "checker", res.Plugins[0].Name)
+	require.Equal(t, "checker.so", res.Plugins[0].Path)
+	require.True(t, res.Plugins[0].Enabled)
+
+	// the commands changing the chain are only accepted as POST
+	resp, err := client.client.Get("http://unix/" + AdminCmdDisable + "?name=checker")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	require.Equal(t, 1, len(holder.GetPlugins()))
+
+	res, err = client.Send(AdminCmdDisable, "checker", "")
+	require.Nil(t, err)
+	require.False(t, res.Plugins[0].Enabled)
+	require.Nil(t, holder.GetPlugins())
+
+	res, err = client.Send(AdminCmdEnable, "checker", "")
+	require.Nil(t, err)
+	require.True(t, res.Plugins[0].Enabled)
+
+	_, err = client.Send(AdminCmdEnable, "unknown", "")
+	require.NotNil(t, err)
+
+	res, err = client.Send(AdminCmdUnload, "checker", "")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(res.Plugins))
+
+	_, err = client.Send("unknown", "", "")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const builtinSourcePrefix = "builtin:"
+
+// builtinPlugins creates the plugins compiled into cetd, from their config files
+var builtinPlugins = map[string]func(config string) (AppPlugin, error){
+	RuleFilterName: func(config string) (AppPlugin, error) {
+		return NewRuleFilter(config)
+	},
+}
+
+func isBuiltinSource(source string) bool {
+	return strings.HasPrefix(source, builtinSourcePrefix)
+}
+
+// openBuiltin returns a new entry for the builtin plugin, or old if neither the builtin nor its config is changed
+func openBuiltin(name, builtin, config string, old *pluginEntry) (*pluginEntry, error) {
+	source := builtinSourcePrefix + builtin
+	if old != nil && old.source == source && old.path == config {
+		return old, nil
+	}
+
+	create, ok := builtinPlugins[builtin]
+	if !ok {
+		return nil, fmt.Errorf("unknown builtin %s of plugin %s", builtin, name)
+	}
+	instance, err := create(config)
+	if err != nil {
+		return nil, fmt.Errorf("create builtin plugin %s failed, %s", name, err.Error())
+	}
+
+	version := 1
+	if old != nil {
+		version = old.version + 1
+	}
+	entry := &pluginEntry{
+		name:     name,
+		source:   source,
+		path:     config,
+		version:  version,
+		loadTime: time.Now(),
+		instance: instance,
+		previous: old,
+	}
+	entry.trimPrevious()
+	return entry, nil
+}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+const (
+	PluginsDir   = "data/plugins"
+	ManifestFile = "plugins.toml"
+)
+
+// ManifestEntry describes one plugin in the chain, which is either a go plugin file or a built-in plugin
+// with its config file. The files are relative to the plugins directory unless they are absolute paths.
+type ManifestEntry struct {
+	Name    string `toml:"name"`
+	File    string `toml:"file"`
+	Builtin string `toml:"builtin"`
+	Config  string `toml:"config"`
+	Enabled bool   `toml:"enabled"`
+}
+
+// Manifest lists the plugins of the chain, in the order their PreCheckTx are called.
+//
+//	[[plugin]]
+//	name = "spam_filter"
+//	file = "spam_filter.so"
+//	enabled = true
+//
+//	[[plugin]]
+//	name = "rules"
+//	builtin = "rule_filter"
+//	config = "rules.toml"
+//	enabled = true
+type Manifest struct {
+	Plugins []ManifestEntry `toml:"plugin"`
+}
+
+func LoadManifest(pluginsDir string) (Manifest, error) {
+	var manifest Manifest
+	data, err := ioutil.ReadFile(path.Join(pluginsDir, ManifestFile))
+	if err != nil {
+		return manifest, err
+	}
+	if err = toml.Unmarshal(data, &manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, manifest.Validate()
+}
+
+func (m Manifest) Validate() error {
+	names := make(map[string]struct{}, len(m.Plugins))
+	for _, e := range m.Plugins {
+		if len(e.Name) == 0 {
+			return fmt.Errorf("plugin name is empty")
+		}
+		if len(e.Builtin) != 0 {
+			if len(e.File) != 0 {
+				return fmt.Errorf("plugin %s can not have both file and builtin", e.Name)
+			}
+			if _, ok := builtinPlugins[e.Builtin]; !ok {
+				return fmt.Errorf("unknown builtin %s of plugin %s", e.Builtin, e.Name)
+			}
+		} else if len(e.File) == 0 {
+			return fmt.Errorf("file of plugin %s is empty", e.Name)
+		}
+		if _, ok := names[e.Name]; ok {
+			return fmt.Errorf("duplicated plugin name %s", e.Name)
+		}
+		names[e.Name] = struct{}{}
+	}
+	return nil
+}
+
+func (e ManifestEntry) filePath(pluginsDir string) string {
+	return joinPluginsDir(pluginsDir, e.File)
+}
+
+func (e ManifestEntry) configPath(pluginsDir string) string {
+	if len(e.Config) == 0 {
+		return ""
+	}
+	return joinPluginsDir(pluginsDir, e.Config)
+}
+
+func joinPluginsDir(pluginsDir, file string) string {
+	if path.IsAbs(file) {
+		return file
+	}
+	return path.Join(pluginsDir, file)
+}
@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"sync"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MetricsSubsystem is a subsystem shared by all metrics exposed by this
+	// package.
+	MetricsSubsystem = "plugin"
+
+	MetricsNamespace = "cetd"
+)
+
+// Metrics contains metrics exposed by this package.
+type Metrics struct {
+	// Number of PreCheckTx calls, labeled by plugin and result (accept, reject, timeout or panic).
+	PreCheckTxResults metrics.Counter
+}
+
+// PrometheusMetrics returns Metrics build using Prometheus client library.
+func PrometheusMetrics(namespace string) *Metrics {
+	return &Metrics{
+		PreCheckTxResults: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "pre_check_tx_results",
+			Help:      "Number of PreCheckTx calls by plugin and result.",
+		}, []string{"plugin", "result"}),
+	}
+}
+
+// NopMetrics returns no-op Metrics.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		PreCheckTxResults: discard.NewCounter(),
+	}
+}
+
+var (
+	metricsOnce   sync.Once
+	pluginMetrics *Metrics
+)
+
+// getMetrics registers the prometheus metrics only once, since several apps may be created in a process
+func getMetrics() *Metrics {
+	metricsOnce.Do(func() {
+		pluginMetrics = PrometheusMetrics(MetricsNamespace)
+	})
+	return pluginMetrics
+}
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
 	abci "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/libs/log"
 )
@@ -10,3 +11,13 @@ type AppPlugin interface {
 	PreCheckTx(abci.RequestCheckTx, sdk.TxDecoder, log.Logger) sdk.Error
 	Name() string
 }
+
+// AppObserver can be optionally implemented by an AppPlugin to observe the blocks being executed.
+// The observers are called after the state has been changed, within the time budget of the sandbox. Every
+// observer gets its own copies of the arguments.
+type AppObserver interface {
+	OnDeliverTx(header abci.Header, tx auth.StdTx, res abci.ResponseDeliverTx)
+	OnBeginBlock(header abci.Header, res abci.ResponseBeginBlock)
+	OnEndBlock(header abci.Header, res abci.ResponseEndBlock)
+	OnCommit(header abci.Header, res abci.ResponseCommit)
+}
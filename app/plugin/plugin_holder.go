@@ -1,129 +1,501 @@
 package plugin
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"os/signal"
 	"path"
 	"plugin"
-	"runtime/debug"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cosmos/cosmos-sdk/client/flags"
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/spf13/viper"
 	"github.com/tendermint/tendermint/libs/log"
 )
 
-var reloadPluginSignal os.Signal
+// VersionsDir keeps the versioned copies of plugin files, which are the ones really opened.
+// So a plugin file can be overwritten by a new build and reloaded without restarting the node.
+//
+// Go refuses to open a plugin whose pluginpath is taken by a loaded one, whatever its file is. A plugin built
+// from a package directory always has the import path of the package as its pluginpath, so every build
+// to be upgraded to must be given a unique one. The symbols are named after the package path given to the
+// compiler, which must be the same:
+//
+//	go build -buildmode=plugin -gcflags=-p=spam_filter_v2 -ldflags=-pluginpath=spam_filter_v2 \
+//		-o spam_filter.so ./spam_filter
+//
+// A plugin built from go files, such as spam_filter/*.go, gets a pluginpath from the hash of the files,
+// which is unique already.
+const VersionsDir = "versions"
 
-func SetReloadPluginSignal(signal os.Signal) {
-	reloadPluginSignal = signal
+// MaxPreviousVersions is the number of the previous versions of a plugin kept to roll back to
+const MaxPreviousVersions = 3
+
+const errPluginAlreadyLoaded = "plugin already loaded"
+
+type pluginEntry struct {
+	name      string
+	source    string // the file given by manifest or admin command
+	path      string // the versioned copy of source which is opened
+	hash      string
+	version   int
+	loadTime  time.Time
+	isEnabled int32
+	instance  AppPlugin
+	previous  *pluginEntry // the entry to roll back to
+	stats     callStats
 }
 
-func (loader *Holder) WaitPluginToggleSignal(logger log.Logger) {
-	loader.logger = logger
-	togglePlugin := func(c chan os.Signal) {
-		for {
-			<-c
-			loader.togglePlugin()
-		}
+func (entry *pluginEntry) isPluginEnabled() bool {
+	return atomic.LoadInt32(&entry.isEnabled) == 1
+}
+
+func (entry *pluginEntry) setEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&entry.isEnabled, 1)
+	} else {
+		atomic.StoreInt32(&entry.isEnabled, 0)
 	}
+}
+
+// PluginStatus is reported by the admin endpoint for every plugin in the chain
+type PluginStatus struct {
+	Name            string    `json:"name"`
+	Source          string    `json:"source"`
+	Path            string    `json:"path"`
+	Hash            string    `json:"hash"`
+	Version         int       `json:"version"`
+	PreviousVersion int       `json:"previous_version,omitempty"`
+	LoadTime        time.Time `json:"load_time"`
+	Enabled         bool      `json:"enabled"`
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, reloadPluginSignal)
-	go togglePlugin(c)
+	Accepted            int64 `json:"accepted"`
+	Rejected            int64 `json:"rejected"`
+	Timeouts            int64 `json:"timeouts"`
+	Panics              int64 `json:"panics"`
+	ConsecutiveFailures int64 `json:"consecutive_failures"`
+	StuckCalls          int64 `json:"stuck_calls"`
 }
 
+type openedPlugin struct {
+	path     string
+	instance AppPlugin
+}
+
+// go plugins can not be opened twice in a process, so the opened ones are kept by the hash of their contents
+var (
+	openedMtx     sync.Mutex
+	openedPlugins = make(map[string]openedPlugin)
+)
+
+// Holder keeps an ordered chain of AppPlugins, which is described by the manifest in data/plugins
 type Holder struct {
-	isEnabled      int32
-	pluginInstance AppPlugin
-	logger         log.Logger
+	mtx     sync.RWMutex
+	plugins []*pluginEntry
+	logger  log.Logger
+
+	// loadMtx serializes the changes of the chain
+	loadMtx sync.Mutex
+
+	callTimeout time.Duration
+	maxFailures int64
+	metrics     *Metrics
 }
 
-func (loader *Holder) isPluginLoaded() bool {
-	return loader.pluginInstance != nil
+// InitPluginHolder loads the chain in the manifest of data/plugins if it exists, so the plugins run again
+// after a restart. The plugins failed to load are logged and skipped, they can be loaded by the admin commands.
+func (loader *Holder) InitPluginHolder(logger log.Logger) {
+	loader.logger = logger
+	loader.initSandbox()
+
+	manifestPath := path.Join(getPluginsDir(), ManifestFile)
+	if _, err := os.Stat(manifestPath); err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error(fmt.Sprintf("plugin manifest %s is unreadable: %s", manifestPath, err.Error()))
+		}
+		return
+	}
+	if err := loader.ReloadPlugins(); err != nil {
+		logger.Error(fmt.Sprintf("load plugins at startup failed: %s", err.Error()))
+	}
 }
 
-func (loader *Holder) GetPlugin() AppPlugin {
-	if loader.isPluginEnabled() {
-		return loader.pluginInstance
+// GetPlugins returns the enabled plugins in the order of the manifest
+func (loader *Holder) GetPlugins() []AppPlugin {
+	var res []AppPlugin
+	for _, entry := range loader.getEnabledEntries() {
+		res = append(res, entry.instance)
 	}
+	return res
+}
 
-	return nil
+func (loader *Holder) getEnabledEntries() []*pluginEntry {
+	loader.mtx.RLock()
+	defer loader.mtx.RUnlock()
+
+	var res []*pluginEntry
+	for _, entry := range loader.plugins {
+		if entry.isPluginEnabled() {
+			res = append(res, entry)
+		}
+	}
+	return res
 }
 
-func (loader *Holder) togglePlugin() {
-	defer func() {
-		if r := recover(); r != nil {
-			loader.logger.Error(fmt.Sprintf("toggle plugin failed: %s", string(debug.Stack())))
+// NotifyObservers calls fn with every enabled plugin which implements AppObserver, in the sandbox of
+// PreCheckTx. A panicking or timed-out observer is logged and skipped, it must not stop the block execution.
+// fn must give every observer its own copies of the arguments, since a timed-out call is left running.
+func (loader *Holder) NotifyObservers(fn func(AppObserver)) {
+	for _, entry := range loader.getEnabledEntries() {
+		if observer, ok := entry.instance.(AppObserver); ok {
+			res := loader.runSandboxed(entry, func() sdk.Error {
+				fn(observer)
+				return nil
+			})
+			loader.recordObserverResult(entry, res)
 		}
-	}()
+	}
+}
 
-	if !loader.isPluginLoaded() {
-		loader.loadAndEnablePlugin()
-		return
+func (loader *Holder) GetPluginsStatus() []PluginStatus {
+	loader.mtx.RLock()
+	defer loader.mtx.RUnlock()
+
+	res := make([]PluginStatus, 0, len(loader.plugins))
+	for _, entry := range loader.plugins {
+		status := PluginStatus{
+			Name:     entry.name,
+			Source:   entry.source,
+			Path:     entry.path,
+			Hash:     entry.hash,
+			Version:  entry.version,
+			LoadTime: entry.loadTime,
+			Enabled:  entry.isPluginEnabled(),
+
+			Accepted:            atomic.LoadInt64(&entry.stats.accepted),
+			Rejected:            atomic.LoadInt64(&entry.stats.rejected),
+			Timeouts:            atomic.LoadInt64(&entry.stats.timeouts),
+			Panics:              atomic.LoadInt64(&entry.stats.panics),
+			ConsecutiveFailures: atomic.LoadInt64(&entry.stats.consecutiveFailures),
+			StuckCalls:          atomic.LoadInt64(&entry.stats.stuckCalls),
+		}
+		if entry.previous != nil {
+			status.PreviousVersion = entry.previous.version
+		}
+		res = append(res, status)
+	}
+	return res
+}
+
+func (loader *Holder) EnablePlugin(name string) error {
+	return loader.setPluginEnabled(name, true)
+}
+
+func (loader *Holder) DisablePlugin(name string) error {
+	return loader.setPluginEnabled(name, false)
+}
+
+func (loader *Holder) setPluginEnabled(name string, enabled bool) error {
+	entry := loader.getPluginEntry(name)
+	if entry == nil {
+		return fmt.Errorf("plugin %s is not loaded", name)
 	}
 
-	if loader.isPluginEnabled() {
-		loader.disablePlugin()
+	entry.setEnabled(enabled)
+	if enabled {
+		atomic.StoreInt64(&entry.stats.consecutiveFailures, 0)
+		loader.logger.Info(fmt.Sprintf("plugin %s is enabled", name))
 	} else {
-		loader.enablePlugin()
+		loader.logger.Info(fmt.Sprintf("plugin %s is disabled", name))
 	}
+	return nil
 }
 
-func (loader *Holder) isPluginEnabled() bool {
-	return atomic.LoadInt32(&loader.isEnabled) == 1
+func (loader *Holder) getPluginEntry(name string) *pluginEntry {
+	loader.mtx.RLock()
+	defer loader.mtx.RUnlock()
+
+	for _, entry := range loader.plugins {
+		if entry.name == name {
+			return entry
+		}
+	}
+	return nil
 }
 
-func (loader *Holder) enablePlugin() {
-	atomic.StoreInt32(&loader.isEnabled, 1)
+// replacePluginEntry swaps in the new entry of a plugin, so CheckTx sees either the old or the new instance
+func (loader *Holder) replacePluginEntry(old, entry *pluginEntry) {
+	entry.setEnabled(old.isPluginEnabled())
+
+	loader.mtx.Lock()
+	defer loader.mtx.Unlock()
 
-	if loader.pluginInstance != nil {
-		loader.logger.Info(fmt.Sprintf("plugin %s is enabled", loader.pluginInstance.Name()))
+	plugins := make([]*pluginEntry, len(loader.plugins))
+	for i, e := range loader.plugins {
+		if e == old {
+			plugins[i] = entry
+		} else {
+			plugins[i] = e
+		}
 	}
+	loader.plugins = plugins
+	old.setEnabled(false)
 }
 
-func (loader *Holder) disablePlugin() {
-	atomic.StoreInt32(&loader.isEnabled, 0)
+// LoadPlugin opens a plugin and appends it to the end of the chain in disabled state.
+// If file is empty, it is taken from the manifest entry with the same name.
+func (loader *Holder) LoadPlugin(name, file string) error {
+	loader.loadMtx.Lock()
+	defer loader.loadMtx.Unlock()
+
+	if loader.getPluginEntry(name) != nil {
+		return fmt.Errorf("plugin %s is already loaded", name)
+	}
+
+	pluginsDir := getPluginsDir()
+	e := ManifestEntry{Name: name, File: file}
+	if len(file) == 0 {
+		manifest, err := LoadManifest(pluginsDir)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, me := range manifest.Plugins {
+			if me.Name == name {
+				e, found = me, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("plugin %s is not in manifest", name)
+		}
+	}
 
-	if loader.pluginInstance != nil {
-		loader.logger.Info(fmt.Sprintf("plugin %s is disabled", loader.pluginInstance.Name()))
+	entry, err := loader.openEntry(e, pluginsDir, nil)
+	if err != nil {
+		return err
 	}
+
+	loader.mtx.Lock()
+	loader.plugins = append(loader.plugins, entry)
+	loader.mtx.Unlock()
+	loader.logger.Info(fmt.Sprintf("plugin %s is loaded from %s", name, entry.path))
+	return nil
 }
 
-func (loader *Holder) loadAndEnablePlugin() {
-	defer func() {
-		if r := recover(); r != nil {
-			loader.logger.Error(fmt.Sprintf("load plugin failed: %s", string(debug.Stack())))
+// UnloadPlugin removes a plugin from the chain. The code of a go plugin stays in memory
+// until the process exits, but it will never be called again.
+func (loader *Holder) UnloadPlugin(name string) error {
+	loader.loadMtx.Lock()
+	defer loader.loadMtx.Unlock()
+
+	loader.mtx.Lock()
+	defer loader.mtx.Unlock()
+
+	for i, entry := range loader.plugins {
+		if entry.name == name {
+			entry.setEnabled(false)
+			plugins := make([]*pluginEntry, 0, len(loader.plugins)-1)
+			plugins = append(plugins, loader.plugins[:i]...)
+			loader.plugins = append(plugins, loader.plugins[i+1:]...)
+			loader.logger.Info(fmt.Sprintf("plugin %s is unloaded", name))
+			return nil
 		}
-	}()
+	}
+	return fmt.Errorf("plugin %s is not loaded", name)
+}
+
+// UpgradePlugin opens a new build of a loaded plugin and swaps it in, keeping its state.
+// If file is empty, the plugin is reopened from its current source file.
+func (loader *Holder) UpgradePlugin(name, file string) error {
+	loader.loadMtx.Lock()
+	defer loader.loadMtx.Unlock()
 
+	old := loader.getPluginEntry(name)
+	if old == nil {
+		return fmt.Errorf("plugin %s is not loaded", name)
+	}
+	if isBuiltinSource(old.source) {
+		return fmt.Errorf("plugin %s is built in, it reloads its config by itself", name)
+	}
+
+	source := old.source
+	if len(file) != 0 {
+		source = ManifestEntry{Name: name, File: file}.filePath(getPluginsDir())
+	}
+	entry, err := loader.openPlugin(name, source, old)
+	if err != nil {
+		return err
+	}
+	if entry == old {
+		return fmt.Errorf("plugin %s is not changed", name)
+	}
+
+	loader.replacePluginEntry(old, entry)
+	loader.logger.Info(fmt.Sprintf("plugin %s is upgraded from version %d to %d", name, old.version, entry.version))
+	return nil
+}
+
+// RollbackPlugin swaps the previous instance of a plugin back in
+func (loader *Holder) RollbackPlugin(name string) error {
+	loader.loadMtx.Lock()
+	defer loader.loadMtx.Unlock()
+
+	old := loader.getPluginEntry(name)
+	if old == nil {
+		return fmt.Errorf("plugin %s is not loaded", name)
+	}
+	if old.previous == nil {
+		return fmt.Errorf("plugin %s has no previous version", name)
+	}
+
+	loader.replacePluginEntry(old, old.previous)
+	loader.logger.Info(fmt.Sprintf("plugin %s is rolled back from version %d to %d", name, old.version, old.previous.version))
+	return nil
+}
+
+func getPluginsDir() string {
 	rootDir := viper.GetString(flags.FlagHome)
-	pluginPath := path.Join(rootDir, "data/plugin.so")
+	return path.Join(rootDir, PluginsDir)
+}
 
-	if _, err := os.Stat(pluginPath); os.IsNotExist(err) {
-		loader.logger.Error(fmt.Sprintf("plugin %s not exists", pluginPath))
-		return
+// ReloadPlugins rebuilds the chain from the manifest. The plugins whose files are changed are upgraded,
+// and the others are reused. The plugins failed to load are skipped and reported in the returned error.
+func (loader *Holder) ReloadPlugins() error {
+	loader.loadMtx.Lock()
+	defer loader.loadMtx.Unlock()
+
+	pluginsDir := getPluginsDir()
+	manifest, err := LoadManifest(pluginsDir)
+	if err != nil {
+		return fmt.Errorf("load plugin manifest in %s failed, %s", pluginsDir, err.Error())
 	}
 
+	var failed []string
+	plugins := make([]*pluginEntry, 0, len(manifest.Plugins))
+	for _, e := range manifest.Plugins {
+		entry, err := loader.openEntry(e, pluginsDir, loader.getPluginEntry(e.Name))
+		if err != nil {
+			loader.logger.Error(err.Error())
+			failed = append(failed, err.Error())
+			continue
+		}
+
+		entry.setEnabled(e.Enabled)
+		plugins = append(plugins, entry)
+	}
+
+	loader.mtx.Lock()
+	loader.plugins = plugins
+	loader.mtx.Unlock()
+
+	for _, entry := range plugins {
+		loader.logger.Info(fmt.Sprintf("plugin %s (%s) version %d is loaded, enabled: %v",
+			entry.name, entry.instance.Name(), entry.version, entry.isPluginEnabled()))
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (loader *Holder) openEntry(e ManifestEntry, pluginsDir string, old *pluginEntry) (*pluginEntry, error) {
+	if len(e.Builtin) != 0 {
+		return openBuiltin(e.Name, e.Builtin, e.configPath(pluginsDir), old)
+	}
+	return loader.openPlugin(e.Name, e.filePath(pluginsDir), old)
+}
+
+// openPlugin returns a new entry for the source file, or old if the file is not changed.
+// The file is copied to a versioned path before opening, since go caches the opened plugins by path.
+func (loader *Holder) openPlugin(name, source string, old *pluginEntry) (*pluginEntry, error) {
+	content, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s not exists", source)
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if old != nil && old.hash == hash && old.source == source {
+		return old, nil
+	}
+
+	version := 1
+	if old != nil {
+		version = old.version + 1
+	}
+
+	openedMtx.Lock()
+	defer openedMtx.Unlock()
+	opened, ok := openedPlugins[hash]
+	if !ok {
+		opened.path = path.Join(path.Dir(source), VersionsDir, fmt.Sprintf("%s.v%d.%s.so", name, version, hash[:8]))
+		if err = os.MkdirAll(path.Dir(opened.path), 0750); err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(opened.path, content, 0640); err != nil {
+			return nil, err
+		}
+		if opened.instance, err = loadPlugin(opened.path); err != nil {
+			_ = os.Remove(opened.path)
+			if strings.Contains(err.Error(), errPluginAlreadyLoaded) {
+				return nil, fmt.Errorf("%s has the same pluginpath as a loaded plugin, build it with "+
+					"-gcflags=-p=<unique name> -ldflags=-pluginpath=<unique name>: %s", source, err.Error())
+			}
+			return nil, err
+		}
+		openedPlugins[hash] = opened
+	}
+
+	entry := &pluginEntry{
+		name:     name,
+		source:   source,
+		path:     opened.path,
+		hash:     hash,
+		version:  version,
+		loadTime: time.Now(),
+		instance: opened.instance,
+		previous: old,
+	}
+	entry.trimPrevious()
+	return entry, nil
+}
+
+// trimPrevious drops the versions before the last MaxPreviousVersions ones, they can not be rolled back to
+func (entry *pluginEntry) trimPrevious() {
+	e := entry
+	for i := 0; i < MaxPreviousVersions && e.previous != nil; i++ {
+		e = e.previous
+	}
+	e.previous = nil
+}
+
+func loadPlugin(pluginPath string) (instance AppPlugin, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("load plugin %s failed: %v", pluginPath, r)
+		}
+	}()
+
 	p, err := plugin.Open(pluginPath)
 	if err != nil {
-		loader.logger.Error(fmt.Sprintf("plugin %s open failed, %s", pluginPath, err.Error()))
-		return
+		return nil, fmt.Errorf("plugin %s open failed, %s", pluginPath, err.Error())
 	}
 
 	symbol, err := p.Lookup("Instance")
 	if err != nil {
-		loader.logger.Error(fmt.Sprintf("Lookup Instance in plugin %s failed", pluginPath))
-		return
+		return nil, fmt.Errorf("lookup Instance in plugin %s failed", pluginPath)
 	}
 
 	instance, ok := symbol.(AppPlugin)
 	if !ok {
-		loader.logger.Error(fmt.Sprintf("Instance in plugin %s is invalid", pluginPath))
-		return
+		return nil, fmt.Errorf("symbol Instance in plugin %s is invalid", pluginPath)
 	}
 
-	loader.pluginInstance = instance
-	loader.enablePlugin()
+	return instance, nil
 }
@@ -1,46 +1,252 @@
 package plugin
 
 import (
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"testing"
 
 	"github.com/cosmos/cosmos-sdk/client/flags"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/libs/log"
 )
 
-func TestTogglePlugin(t *testing.T) {
+const testManifest = `
+[[plugin]]
+name = "first"
+file = "test_plugin.so"
+enabled = true
+
+[[plugin]]
+name = "missing"
+file = "missing.so"
+enabled = true
+
+[[plugin]]
+name = "second"
+file = "test_plugin.so"
+enabled = false
+`
+
+func TestReloadPlugins(t *testing.T) {
 	cmd := exec.Command("/bin/bash", "./test_plugin/build_test_plugin.sh")
 	err := cmd.Run()
 	require.Nil(t, err)
 
 	defer func() {
-		cmd = exec.Command("rm", "./test_plugin/data/plugin.so")
-		_ = cmd.Run()
+		_ = os.RemoveAll("./test_plugin/data")
 	}()
 
 	logger := log.NewNopLogger()
 	holder := Holder{}
-	holder.WaitPluginToggleSignal(logger)
+	holder.InitPluginHolder(logger)
 
 	// invalid path
 	viper.Set(flags.FlagHome, "./invalid/")
-	holder.togglePlugin()
-	require.Equal(t, int32(0), holder.isEnabled)
-	require.Nil(t, holder.GetPlugin())
+	require.NotNil(t, holder.ReloadPlugins())
+	require.Nil(t, holder.GetPlugins())
+
+	// no manifest
+	viper.Set(flags.FlagHome, "./test_plugin/")
+	require.NotNil(t, holder.ReloadPlugins())
+	require.Nil(t, holder.GetPlugins())
+
+	// valid manifest, the missing plugin is skipped
+	err = ioutil.WriteFile("./test_plugin/data/plugins/plugins.toml", []byte(testManifest), 0644)
+	require.Nil(t, err)
+	require.NotNil(t, holder.ReloadPlugins())
+	require.Equal(t, 2, len(holder.plugins))
+	require.Equal(t, "first", holder.plugins[0].name)
+	require.Equal(t, "second", holder.plugins[1].name)
+	require.Equal(t, 1, len(holder.GetPlugins()))
+	require.Equal(t, "TestPlugin", holder.GetPlugins()[0].Name())
+
+	// the manifest is loaded at startup
+	restarted := Holder{}
+	restarted.InitPluginHolder(logger)
+	require.Equal(t, 2, len(restarted.plugins))
+	require.Equal(t, 1, len(restarted.GetPlugins()))
+
+	require.Nil(t, holder.EnablePlugin("second"))
+	require.Equal(t, 2, len(holder.GetPlugins()))
+	require.Nil(t, holder.DisablePlugin("first"))
+	require.Equal(t, 1, len(holder.GetPlugins()))
+	require.NotNil(t, holder.EnablePlugin("missing"))
+
+	// reloading restores the states in manifest
+	require.NotNil(t, holder.ReloadPlugins())
+	require.Equal(t, 1, len(holder.GetPlugins()))
+	require.True(t, holder.plugins[0].isPluginEnabled())
+	require.False(t, holder.plugins[1].isPluginEnabled())
+
+	require.Nil(t, holder.UnloadPlugin("first"))
+	require.NotNil(t, holder.UnloadPlugin("first"))
+	require.Nil(t, holder.GetPlugins())
+	require.NotNil(t, holder.LoadPlugin("second", ""))
+	require.NotNil(t, holder.LoadPlugin("missing", ""))
+	require.NotNil(t, holder.LoadPlugin("unknown", ""))
+	require.Nil(t, holder.LoadPlugin("first", ""))
+	require.Equal(t, "second", holder.plugins[0].name)
+	require.Equal(t, "first", holder.plugins[1].name)
+	require.False(t, holder.plugins[1].isPluginEnabled())
+	require.Nil(t, holder.LoadPlugin("third", "test_plugin.so"))
+	require.Equal(t, 3, len(holder.GetPluginsStatus()))
+	require.Equal(t, holder.plugins[0].path, holder.plugins[2].path)
+}
+
+func TestUpgradePlugin(t *testing.T) {
+	cmd := exec.Command("/bin/bash", "./test_plugin/build_test_plugin.sh")
+	err := cmd.Run()
+	require.Nil(t, err)
+
+	defer func() {
+		_ = os.RemoveAll("./test_plugin/data")
+	}()
+
+	holder := Holder{}
+	holder.InitPluginHolder(log.NewNopLogger())
+	viper.Set(flags.FlagHome, "./test_plugin/")
+
+	require.Nil(t, holder.LoadPlugin("test", "test_plugin.so"))
+	require.Nil(t, holder.EnablePlugin("test"))
+	require.NotNil(t, holder.UpgradePlugin("test", ""))
+	require.NotNil(t, holder.RollbackPlugin("test"))
+	v1 := holder.GetPluginsStatus()[0]
+	require.Equal(t, 1, v1.Version)
+	require.Equal(t, "TestPlugin", holder.GetPlugins()[0].Name())
+
+	// overwrite the source with a new build
+	content, err := ioutil.ReadFile("./test_plugin/data/plugins/test_plugin_v2.so")
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile("./test_plugin/data/plugins/test_plugin.so", content, 0644))
+
+	require.Nil(t, holder.UpgradePlugin("test", ""))
+	v2 := holder.GetPluginsStatus()[0]
+	require.Equal(t, 2, v2.Version)
+	require.Equal(t, 1, v2.PreviousVersion)
+	require.Equal(t, v1.Source, v2.Source)
+	require.NotEqual(t, v1.Path, v2.Path)
+	require.NotEqual(t, v1.Hash, v2.Hash)
+	require.True(t, v2.Enabled)
+	require.Equal(t, "TestPluginV2", holder.GetPlugins()[0].Name())
+
+	require.Nil(t, holder.RollbackPlugin("test"))
+	require.Equal(t, v1.Path, holder.GetPluginsStatus()[0].Path)
+	require.Equal(t, "TestPlugin", holder.GetPlugins()[0].Name())
+	require.NotNil(t, holder.RollbackPlugin("test"))
+
+	// an opened build is reused rather than opened again
+	require.Nil(t, holder.UpgradePlugin("test", ""))
+	require.Equal(t, v2.Path, holder.GetPluginsStatus()[0].Path)
+	require.Equal(t, "TestPluginV2", holder.GetPlugins()[0].Name())
+}
 
-	// valid path
+func TestUpgradePackagePlugin(t *testing.T) {
+	cmd := exec.Command("/bin/bash", "./test_plugin/build_test_plugin.sh")
+	require.Nil(t, cmd.Run())
+
+	defer func() {
+		_ = os.RemoveAll("./test_plugin/data")
+	}()
+
+	holder := Holder{}
+	holder.InitPluginHolder(log.NewNopLogger())
 	viper.Set(flags.FlagHome, "./test_plugin/")
-	holder.togglePlugin()
-	require.Equal(t, int32(1), holder.isEnabled)
-	require.NotNil(t, holder.GetPlugin())
 
-	holder.togglePlugin()
-	require.Equal(t, int32(0), holder.isEnabled)
-	require.Nil(t, holder.GetPlugin())
+	require.Nil(t, holder.LoadPlugin("pkg", "pkg_plugin.so"))
+	require.Equal(t, "TestPlugin", holder.plugins[0].instance.Name())
+
+	// a rebuild of the package has the same pluginpath
+	err := holder.UpgradePlugin("pkg", "pkg_plugin_v3_same_path.so")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "-pluginpath")
+	versions, err := ioutil.ReadDir("./test_plugin/data/plugins/versions")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(versions))
+	require.Equal(t, 1, holder.GetPluginsStatus()[0].Version)
+
+	require.Nil(t, holder.UpgradePlugin("pkg", "pkg_plugin_v3.so"))
+	require.Equal(t, "TestPluginV3", holder.plugins[0].instance.Name())
+	require.Equal(t, 1, holder.GetPluginsStatus()[0].PreviousVersion)
+}
+
+func TestTrimPrevious(t *testing.T) {
+	var entry *pluginEntry
+	for v := 1; v <= MaxPreviousVersions+3; v++ {
+		entry = &pluginEntry{version: v, previous: entry}
+		entry.trimPrevious()
+	}
+	var versions []int
+	for e := entry; e != nil; e = e.previous {
+		versions = append(versions, e.version)
+	}
+	require.Equal(t, []int{6, 5, 4, 3}, versions)
+}
+
+type observerPlugin struct {
+	heights []int64
+}
+
+func (p *observerPlugin) PreCheckTx(abci.RequestCheckTx, sdk.TxDecoder, log.Logger) sdk.Error {
+	return nil
+}
+func (p *observerPlugin) Name() string { return "observer" }
+func (p *observerPlugin) OnDeliverTx(header abci.Header, tx auth.StdTx, res abci.ResponseDeliverTx) {
+	panic("observer panics")
+}
+func (p *observerPlugin) OnBeginBlock(header abci.Header, res abci.ResponseBeginBlock) {
+	p.heights = append(p.heights, header.Height)
+}
+func (p *observerPlugin) OnEndBlock(header abci.Header, res abci.ResponseEndBlock) {}
+func (p *observerPlugin) OnCommit(header abci.Header, res abci.ResponseCommit)     {}
+
+type checkerPlugin struct{}
+
+func (p checkerPlugin) PreCheckTx(abci.RequestCheckTx, sdk.TxDecoder, log.Logger) sdk.Error {
+	return nil
+}
+func (p checkerPlugin) Name() string { return "checker" }
+
+func TestNotifyObservers(t *testing.T) {
+	observer := &observerPlugin{}
+	holder := Holder{logger: log.NewNopLogger()}
+	holder.plugins = []*pluginEntry{
+		{name: "checker", instance: checkerPlugin{}, isEnabled: 1},
+		{name: "observer", instance: observer, isEnabled: 1},
+	}
+
+	holder.NotifyObservers(func(o AppObserver) {
+		o.OnBeginBlock(abci.Header{Height: 10}, abci.ResponseBeginBlock{})
+	})
+	require.Equal(t, []int64{10}, observer.heights)
+
+	require.NotPanics(t, func() {
+		holder.NotifyObservers(func(o AppObserver) {
+			o.OnDeliverTx(abci.Header{Height: 10}, auth.StdTx{}, abci.ResponseDeliverTx{})
+		})
+	})
+
+	require.Nil(t, holder.DisablePlugin("observer"))
+	holder.NotifyObservers(func(o AppObserver) {
+		o.OnBeginBlock(abci.Header{Height: 11}, abci.ResponseBeginBlock{})
+	})
+	require.Equal(t, []int64{10}, observer.heights)
+}
+
+func TestManifestValidate(t *testing.T) {
+	m := Manifest{Plugins: []ManifestEntry{{Name: "a", File: "a.so"}, {Name: "b", File: "b.so"}}}
+	require.Nil(t, m.Validate())
+
+	m.Plugins = append(m.Plugins, ManifestEntry{Name: "a", File: "c.so"})
+	require.NotNil(t, m.Validate())
+
+	m.Plugins = []ManifestEntry{{Name: "a"}}
+	require.NotNil(t, m.Validate())
 
-	holder.togglePlugin()
-	require.Equal(t, int32(1), holder.isEnabled)
-	require.NotNil(t, holder.GetPlugin())
+	m.Plugins = []ManifestEntry{{File: "a.so"}}
+	require.NotNil(t, m.Validate())
 }
@@ -0,0 +1,368 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	toml "github.com/pelletier/go-toml"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+const (
+	RuleFilterName = "rule_filter"
+
+	CodeSpacePlugin       sdk.CodespaceType = "plugin"
+	DefaultRuleRejectCode sdk.CodeType      = 2000
+
+	// RulesCheckInterval is how often the rules file is checked for changes
+	RulesCheckInterval = 2 * time.Second
+)
+
+// Rule rejects a tx when all of its non-empty conditions match. The msg conditions match if any msg of
+// the tx has one of the MsgTypes and involves one of the Denoms. MinFee and MaxFee are coins like "100cet",
+// compared with the amount of the same denom in the tx fee.
+type Rule struct {
+	Name      string   `toml:"name" json:"name"`
+	Code      int64    `toml:"code" json:"code"`
+	Reason    string   `toml:"reason" json:"reason"`
+	MsgTypes  []string `toml:"msg_types" json:"msg_types"`
+	Signers   []string `toml:"signers" json:"signers"`
+	Denoms    []string `toml:"denoms" json:"denoms"`
+	MemoRegex string   `toml:"memo_regex" json:"memo_regex"`
+	MinFee    string   `toml:"min_fee" json:"min_fee"`
+	MaxFee    string   `toml:"max_fee" json:"max_fee"`
+	MinGas    int64    `toml:"min_gas" json:"min_gas"`
+	MaxGas    int64    `toml:"max_gas" json:"max_gas"`
+}
+
+// Rules is the content of a rules file, in TOML or in JSON if the file name ends with ".json".
+//
+//	[[rule]]
+//	name = "no_big_fee_send"
+//	code = 2001
+//	msg_types = ["MsgSend"]
+//	min_fee = "1000000000000cet"
+type Rules struct {
+	Rules []Rule `toml:"rule" json:"rules"`
+}
+
+type compiledRule struct {
+	name     string
+	err      sdk.Error
+	msgTypes map[string]struct{}
+	signers  map[string]struct{}
+	denoms   map[string]struct{}
+	memo     *regexp.Regexp
+	minFee   *sdk.Coin
+	maxFee   *sdk.Coin
+	minGas   uint64
+	maxGas   uint64
+}
+
+// RuleFilter is a built-in plugin which rejects txs by the declarative rules in a file.
+// The file is reloaded when it is changed, and the old rules are kept if the new ones are invalid.
+type RuleFilter struct {
+	// lastCheck is the unix nano time the file is checked last time, which is accessed atomically and
+	// kept first for its 64-bit alignment
+	lastCheck int64
+	file      string
+
+	mtx     sync.RWMutex
+	rules   []*compiledRule
+	modTime time.Time
+}
+
+var _ AppPlugin = (*RuleFilter)(nil)
+
+func NewRuleFilter(file string) (*RuleFilter, error) {
+	if len(file) == 0 {
+		return nil, fmt.Errorf("rules file is not specified")
+	}
+
+	f := &RuleFilter{file: file}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if f.rules, err = loadRules(file); err != nil {
+		return nil, err
+	}
+	f.modTime = info.ModTime()
+	f.lastCheck = time.Now().UnixNano()
+	return f, nil
+}
+
+func (f *RuleFilter) Name() string {
+	return "RuleFilter"
+}
+
+func (f *RuleFilter) PreCheckTx(req abci.RequestCheckTx, txDecoder sdk.TxDecoder, logger log.Logger) sdk.Error {
+	tx, err := txDecoder(req.Tx)
+	if err != nil {
+		return err
+	}
+	stdTx, ok := tx.(auth.StdTx)
+	if !ok {
+		return nil
+	}
+
+	f.reloadIfChanged(logger)
+
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+	for _, rule := range f.rules {
+		if rule.match(stdTx) {
+			return rule.err
+		}
+	}
+	return nil
+}
+
+// reloadIfChanged checks the file once every RulesCheckInterval by one of the callers, and only takes the write
+// lock to swap in the new rules, so that CheckTx is not serialized by the check
+func (f *RuleFilter) reloadIfChanged(logger log.Logger) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&f.lastCheck)
+	if now-last < int64(RulesCheckInterval) || !atomic.CompareAndSwapInt64(&f.lastCheck, last, now) {
+		return
+	}
+
+	info, err := os.Stat(f.file)
+	if err != nil {
+		logger.Error(fmt.Sprintf("stat rules file %s failed, %s", f.file, err.Error()))
+		return
+	}
+	f.mtx.RLock()
+	changed := !info.ModTime().Equal(f.modTime)
+	f.mtx.RUnlock()
+	if !changed {
+		return
+	}
+
+	rules, err := loadRules(f.file)
+	if err != nil {
+		logger.Error(fmt.Sprintf("reload rules file %s failed, keep the old rules: %s", f.file, err.Error()))
+		return
+	}
+	f.mtx.Lock()
+	f.rules = rules
+	f.modTime = info.ModTime()
+	f.mtx.Unlock()
+	logger.Info(fmt.Sprintf("%d rules are reloaded from %s", len(rules), f.file))
+}
+
+func loadRules(file string) ([]*compiledRule, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	if path.Ext(file) == ".json" {
+		err = json.Unmarshal(data, &rules)
+	} else {
+		err = toml.Unmarshal(data, &rules)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*compiledRule, 0, len(rules.Rules))
+	for _, rule := range rules.Rules {
+		c, err := rule.compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %s: %s", rule.Name, err.Error())
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func (r Rule) compile() (*compiledRule, error) {
+	c := &compiledRule{
+		name:     r.Name,
+		msgTypes: toSet(r.MsgTypes),
+		denoms:   toSet(r.Denoms),
+		signers:  make(map[string]struct{}, len(r.Signers)),
+	}
+	if len(r.Name) == 0 {
+		return nil, fmt.Errorf("name is empty")
+	}
+
+	code := DefaultRuleRejectCode
+	if r.Code != 0 {
+		if r.Code < 0 || r.Code > int64(^uint16(0)) {
+			return nil, fmt.Errorf("code %d is out of range", r.Code)
+		}
+		code = sdk.CodeType(r.Code)
+	}
+	reason := r.Reason
+	if len(reason) == 0 {
+		reason = fmt.Sprintf("tx is rejected by rule %s", r.Name)
+	}
+	c.err = sdk.NewError(CodeSpacePlugin, code, reason)
+
+	for _, signer := range r.Signers {
+		addr, err := sdk.AccAddressFromBech32(signer)
+		if err != nil {
+			return nil, err
+		}
+		c.signers[string(addr)] = struct{}{}
+	}
+
+	var err error
+	if len(r.MemoRegex) != 0 {
+		if c.memo, err = regexp.Compile(r.MemoRegex); err != nil {
+			return nil, err
+		}
+	}
+	if c.minFee, err = parseFee(r.MinFee); err != nil {
+		return nil, err
+	}
+	if c.maxFee, err = parseFee(r.MaxFee); err != nil {
+		return nil, err
+	}
+	if r.MinGas < 0 || r.MaxGas < 0 {
+		return nil, fmt.Errorf("gas can not be negative")
+	}
+	c.minGas, c.maxGas = uint64(r.MinGas), uint64(r.MaxGas)
+
+	if len(c.msgTypes) == 0 && len(c.signers) == 0 && len(c.denoms) == 0 && c.memo == nil &&
+		c.minFee == nil && c.maxFee == nil && c.minGas == 0 && c.maxGas == 0 {
+		return nil, fmt.Errorf("rule without conditions would reject all txs")
+	}
+	return c, nil
+}
+
+func parseFee(fee string) (*sdk.Coin, error) {
+	if len(fee) == 0 {
+		return nil, nil
+	}
+	coin, err := sdk.ParseCoin(fee)
+	if err != nil {
+		return nil, err
+	}
+	return &coin, nil
+}
+
+func toSet(list []string) map[string]struct{} {
+	res := make(map[string]struct{}, len(list))
+	for _, s := range list {
+		res[s] = struct{}{}
+	}
+	return res
+}
+
+func (r *compiledRule) match(tx auth.StdTx) bool {
+	if len(r.signers) != 0 && !r.matchSigners(tx.GetSigners()) {
+		return false
+	}
+	if r.memo != nil && !r.memo.MatchString(tx.Memo) {
+		return false
+	}
+	if r.minFee != nil && tx.Fee.Amount.AmountOf(r.minFee.Denom).LT(r.minFee.Amount) {
+		return false
+	}
+	if r.maxFee != nil && tx.Fee.Amount.AmountOf(r.maxFee.Denom).GT(r.maxFee.Amount) {
+		return false
+	}
+	if r.minGas != 0 && tx.Fee.Gas < r.minGas {
+		return false
+	}
+	if r.maxGas != 0 && tx.Fee.Gas > r.maxGas {
+		return false
+	}
+	if len(r.msgTypes) == 0 && len(r.denoms) == 0 {
+		return true
+	}
+	for _, msg := range tx.Msgs {
+		if r.matchMsg(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *compiledRule) matchSigners(signers []sdk.AccAddress) bool {
+	for _, signer := range signers {
+		if _, ok := r.signers[string(signer)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *compiledRule) matchMsg(msg sdk.Msg) bool {
+	if len(r.msgTypes) != 0 {
+		if _, ok := r.msgTypes[msgTypeName(msg)]; !ok {
+			return false
+		}
+	}
+	if len(r.denoms) == 0 {
+		return true
+	}
+	for _, denom := range msgDenoms(msg) {
+		if _, ok := r.denoms[denom]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// msgTypeName returns the same name as getType in app_notify.go, such as "MsgSend"
+func msgTypeName(msg sdk.Msg) string {
+	t := reflect.TypeOf(msg)
+	if t.Kind() == reflect.Ptr {
+		return "*" + t.Elem().Name()
+	}
+	return t.Name()
+}
+
+// msgDenoms collects the denoms of the coins, tokens and trading pairs in a msg
+func msgDenoms(msg sdk.Msg) []string {
+	var res []string
+	collectDenoms(reflect.ValueOf(msg), "", &res)
+	return res
+}
+
+func collectDenoms(v reflect.Value, field string, res *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectDenoms(v.Elem(), field, res)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				collectDenoms(v.Field(i), t.Field(i).Name, res)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			collectDenoms(v.Index(i), field, res)
+		}
+	case reflect.String:
+		switch field {
+		case "Denom", "Symbol", "Stock", "Money":
+			*res = append(*res, v.String())
+		case "TradingPair":
+			*res = append(*res, strings.Split(v.String(), "/")...)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/coinexchain/cet-sdk/modules/bankx"
+	"github.com/coinexchain/cet-sdk/modules/market"
+)
+
+var (
+	ruleAddr1 = sdk.AccAddress([]byte("rule_filter_addr_1__"))
+	ruleAddr2 = sdk.AccAddress([]byte("rule_filter_addr_2__"))
+)
+
+const testRules = `
+[[rule]]
+name = "blacklist"
+code = 2001
+reason = "blacklisted"
+signers = ["%s"]
+
+[[rule]]
+name = "abc_send"
+code = 2002
+msg_types = ["MsgSend"]
+denoms = ["abc"]
+
+[[rule]]
+name = "spam_memo"
+memo_regex = "(?i)airdrop"
+max_fee = "100cet"
+
+[[rule]]
+name = "huge_gas"
+min_gas = 10000000
+`
+
+func newRuleTx(signer sdk.AccAddress, msg sdk.Msg, memo string, fee int64, gas uint64) sdk.TxDecoder {
+	tx := auth.NewStdTx([]sdk.Msg{msg}, auth.NewStdFee(gas, sdk.NewCoins(sdk.NewInt64Coin("cet", fee))), nil, memo)
+	return func([]byte) (sdk.Tx, sdk.Error) {
+		return tx, nil
+	}
+}
+
+func checkRuleTx(f *RuleFilter, decoder sdk.TxDecoder) sdk.CodeType {
+	if err := f.PreCheckTx(abci.RequestCheckTx{}, decoder, log.NewNopLogger()); err != nil {
+		return err.Code()
+	}
+	return sdk.CodeOK
+}
+
+func TestRuleFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rule_filter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "rules.toml")
+	rules := []byte(fmtRules(testRules, ruleAddr1.String()))
+	require.Nil(t, ioutil.WriteFile(file, rules, 0644))
+	f, err := NewRuleFilter(file)
+	require.Nil(t, err)
+
+	send := func(from sdk.AccAddress, denom string) sdk.Msg {
+		return bankx.NewMsgSend(from, ruleAddr2, sdk.NewCoins(sdk.NewInt64Coin(denom, 1)), 0)
+	}
+	order := market.MsgCreateOrder{Sender: ruleAddr2, TradingPair: "abc/cet"}
+
+	require.Equal(t, sdk.CodeType(2001), checkRuleTx(f, newRuleTx(ruleAddr1, send(ruleAddr1, "cet"), "", 1000, 100000)))
+	require.Equal(t, sdk.CodeType(2002), checkRuleTx(f, newRuleTx(ruleAddr2, send(ruleAddr2, "abc"), "", 1000, 100000)))
+	require.Equal(t, sdk.CodeOK, checkRuleTx(f, newRuleTx(ruleAddr2, send(ruleAddr2, "cet"), "", 1000, 100000)))
+	require.Equal(t, sdk.CodeOK, checkRuleTx(f, newRuleTx(ruleAddr2, order, "", 1000, 100000)))
+	require.Equal(t, DefaultRuleRejectCode, checkRuleTx(f, newRuleTx(ruleAddr2, order, "free AirDrop", 100, 100000)))
+	require.Equal(t, sdk.CodeOK, checkRuleTx(f, newRuleTx(ruleAddr2, order, "free AirDrop", 1000, 100000)))
+	require.Equal(t, DefaultRuleRejectCode, checkRuleTx(f, newRuleTx(ruleAddr2, order, "", 1000, 10000000)))
+
+	// invalid rules are not applied
+	f.lastCheck = 0
+	modTime := time.Now().Add(time.Second)
+	require.Nil(t, ioutil.WriteFile(file, []byte("[[rule]]\nname = \"all\"\n"), 0644))
+	require.Nil(t, os.Chtimes(file, modTime, modTime))
+	require.Equal(t, sdk.CodeType(2001), checkRuleTx(f, newRuleTx(ruleAddr1, send(ruleAddr1, "cet"), "", 1000, 100000)))
+
+	// reloaded from the changed file
+	f.lastCheck = 0
+	modTime = modTime.Add(time.Second)
+	require.Nil(t, ioutil.WriteFile(file, []byte("[[rule]]\nname = \"orders\"\nmsg_types = [\"MsgCreateOrder\"]\ndenoms = [\"abc\"]\n"), 0644))
+	require.Nil(t, os.Chtimes(file, modTime, modTime))
+	require.Equal(t, sdk.CodeOK, checkRuleTx(f, newRuleTx(ruleAddr1, send(ruleAddr1, "cet"), "", 1000, 100000)))
+	require.Equal(t, DefaultRuleRejectCode, checkRuleTx(f, newRuleTx(ruleAddr2, order, "", 1000, 100000)))
+
+	// the file is not checked again within RulesCheckInterval
+	modTime = modTime.Add(time.Second)
+	require.Nil(t, ioutil.WriteFile(file, rules, 0644))
+	require.Nil(t, os.Chtimes(file, modTime, modTime))
+	require.Equal(t, sdk.CodeOK, checkRuleTx(f, newRuleTx(ruleAddr1, send(ruleAddr1, "cet"), "", 1000, 100000)))
+}
+
+func TestRuleFilterJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rule_filter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "rules.json")
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"rules":[{"name":"gas","code":3000,"max_gas":10}]}`), 0644))
+	f, err := NewRuleFilter(file)
+	require.Nil(t, err)
+	require.Equal(t, sdk.CodeType(3000), checkRuleTx(f, newRuleTx(ruleAddr2, bankx.MsgSend{}, "", 1, 5)))
+	require.Equal(t, sdk.CodeOK, checkRuleTx(f, newRuleTx(ruleAddr2, bankx.MsgSend{}, "", 1, 50)))
+
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"rules":[{"name":"bad","memo_regex":"("}]}`), 0644))
+	_, err = NewRuleFilter(file)
+	require.NotNil(t, err)
+	_, err = NewRuleFilter("")
+	require.NotNil(t, err)
+}
+
+func TestBuiltinInManifest(t *testing.T) {
+	m := Manifest{Plugins: []ManifestEntry{{Name: "rules", Builtin: RuleFilterName, Config: "rules.toml"}}}
+	require.Nil(t, m.Validate())
+	m.Plugins[0].File = "rules.so"
+	require.NotNil(t, m.Validate())
+	m.Plugins[0] = ManifestEntry{Name: "rules", Builtin: "unknown"}
+	require.NotNil(t, m.Validate())
+}
+
+func fmtRules(rules string, addr string) string {
+	return strings.Replace(rules, "%s", addr, 1)
+}
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/spf13/viper"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// The keys of the plugin sandbox in app.toml, which are top-level keys before any section:
+//
+//	# time budget of a PreCheckTx or observer call, 0 to wait for it without limit
+//	plugin-call-timeout = "50ms"
+//	# a plugin is disabled after this many consecutive timeouts and panics, 0 to never disable it except when
+//	# MaxStuckCalls of its timed-out calls are still running
+//	plugin-max-failures = 3
+//
+// A plugin which times out or panics fails open: the tx is passed to the next plugin and to CheckTx as if
+// the plugin accepted it. So a plugin used as a security filter, such as the rule filter, does not
+// stop the txs while it is failing, or after it is disabled.
+const (
+	FlagCallTimeout = "plugin-call-timeout"
+	FlagMaxFailures = "plugin-max-failures"
+
+	DefaultCallTimeout = 50 * time.Millisecond
+	DefaultMaxFailures = 3
+
+	// MaxStuckCalls is the number of the timed-out calls of a plugin which are still running, at which the
+	// plugin is disabled whatever plugin-max-failures is, so that the stuck goroutines do not pile up
+	MaxStuckCalls = 16
+)
+
+const (
+	ResultAccept  = "accept"
+	ResultReject  = "reject"
+	ResultTimeout = "timeout"
+	ResultPanic   = "panic"
+)
+
+// callStats counts the results of PreCheckTx calls of a plugin
+type callStats struct {
+	accepted            int64
+	rejected            int64
+	timeouts            int64
+	panics              int64
+	consecutiveFailures int64
+	stuckCalls          int64
+}
+
+type callResult struct {
+	err      sdk.Error
+	panicked bool
+	timedOut bool
+}
+
+func (loader *Holder) initSandbox() {
+	loader.callTimeout = DefaultCallTimeout
+	if viper.IsSet(FlagCallTimeout) {
+		loader.callTimeout = viper.GetDuration(FlagCallTimeout)
+	}
+	loader.maxFailures = DefaultMaxFailures
+	if viper.IsSet(FlagMaxFailures) {
+		loader.maxFailures = viper.GetInt64(FlagMaxFailures)
+	}
+	loader.metrics = getMetrics()
+}
+
+// RunPreCheckTx calls PreCheckTx of the enabled plugins in order, until one of them rejects the tx.
+// A plugin which panics or runs out of its time budget is skipped, that is the tx passes it, and it is
+// disabled after too many consecutive failures. A timed-out call can not be stopped, it is left to finish
+// in background, and the plugin is disabled once MaxStuckCalls of them are still running.
+func (loader *Holder) RunPreCheckTx(req abci.RequestCheckTx, txDecoder sdk.TxDecoder) sdk.Error {
+	for _, entry := range loader.getEnabledEntries() {
+		result := loader.callPreCheckTx(entry, req, txDecoder)
+		loader.recordResult(entry, result)
+		if result.err != nil {
+			return result.err
+		}
+	}
+	return nil
+}
+
+func (loader *Holder) callPreCheckTx(entry *pluginEntry, req abci.RequestCheckTx, txDecoder sdk.TxDecoder) callResult {
+	return loader.runSandboxed(entry, func() sdk.Error {
+		return entry.instance.PreCheckTx(req, txDecoder, loader.logger)
+	})
+}
+
+// runSandboxed calls fn of the plugin within the time budget, a panic is recovered and logged
+func (loader *Holder) runSandboxed(entry *pluginEntry, fn func() sdk.Error) callResult {
+	call := func() (res callResult) {
+		defer func() {
+			if r := recover(); r != nil {
+				loader.logger.Error(fmt.Sprintf("plugin %s panics: %v\n%s", entry.name, r, string(debug.Stack())))
+				res = callResult{panicked: true}
+			}
+		}()
+		return callResult{err: fn()}
+	}
+
+	if loader.callTimeout <= 0 {
+		return call()
+	}
+
+	const (
+		running int32 = iota
+		finished
+		abandoned
+	)
+	state := running
+	done := make(chan callResult, 1)
+	go func() {
+		res := call()
+		if !atomic.CompareAndSwapInt32(&state, running, finished) {
+			atomic.AddInt64(&entry.stats.stuckCalls, -1)
+		}
+		done <- res
+	}()
+
+	timer := time.NewTimer(loader.callTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res
+	case <-timer.C:
+		stuck := atomic.AddInt64(&entry.stats.stuckCalls, 1)
+		if !atomic.CompareAndSwapInt32(&state, running, abandoned) {
+			// finished just now
+			atomic.AddInt64(&entry.stats.stuckCalls, -1)
+			return <-done
+		}
+		if stuck >= MaxStuckCalls && entry.isPluginEnabled() {
+			entry.setEnabled(false)
+			loader.logger.Error(fmt.Sprintf("plugin %s is disabled with %d timed-out calls still running", entry.name, stuck))
+		}
+		return callResult{timedOut: true}
+	}
+}
+
+func (loader *Holder) recordResult(entry *pluginEntry, res callResult) {
+	var result string
+	var counter *int64
+	switch {
+	case res.panicked:
+		result, counter = ResultPanic, &entry.stats.panics
+	case res.timedOut:
+		result, counter = ResultTimeout, &entry.stats.timeouts
+	case res.err != nil:
+		result, counter = ResultReject, &entry.stats.rejected
+	default:
+		result, counter = ResultAccept, &entry.stats.accepted
+	}
+	atomic.AddInt64(counter, 1)
+	loader.metrics.PreCheckTxResults.With("plugin", entry.name, "result", result).Add(1)
+
+	if result == ResultAccept || result == ResultReject {
+		atomic.StoreInt64(&entry.stats.consecutiveFailures, 0)
+		return
+	}
+	loader.recordFailure(entry, result)
+}
+
+// recordObserverResult counts the timeouts and panics of an observer call as the failures of the plugin
+func (loader *Holder) recordObserverResult(entry *pluginEntry, res callResult) {
+	switch {
+	case res.panicked:
+		atomic.AddInt64(&entry.stats.panics, 1)
+		loader.recordFailure(entry, ResultPanic)
+	case res.timedOut:
+		atomic.AddInt64(&entry.stats.timeouts, 1)
+		loader.recordFailure(entry, ResultTimeout)
+	default:
+		atomic.StoreInt64(&entry.stats.consecutiveFailures, 0)
+	}
+}
+
+// recordFailure disables the plugin after too many consecutive failures
+func (loader *Holder) recordFailure(entry *pluginEntry, result string) {
+	failures := atomic.AddInt64(&entry.stats.consecutiveFailures, 1)
+	loader.logger.Error(fmt.Sprintf("plugin %s failed with %s, %d consecutive failures", entry.name, result, failures))
+	if loader.maxFailures > 0 && failures >= loader.maxFailures && entry.isPluginEnabled() {
+		entry.setEnabled(false)
+		loader.logger.Error(fmt.Sprintf("plugin %s is disabled after %d consecutive failures", entry.name, failures))
+	}
+}
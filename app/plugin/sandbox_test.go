@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+type funcPlugin func() sdk.Error
+
+func (p funcPlugin) PreCheckTx(abci.RequestCheckTx, sdk.TxDecoder, log.Logger) sdk.Error {
+	return p()
+}
+func (p funcPlugin) Name() string { return "func" }
+
+func newSandboxHolder(plugins ...AppPlugin) *Holder {
+	holder := &Holder{
+		logger:      log.NewNopLogger(),
+		callTimeout: 20 * time.Millisecond,
+		maxFailures: 2,
+		metrics:     NopMetrics(),
+	}
+	for i, p := range plugins {
+		holder.plugins = append(holder.plugins, &pluginEntry{name: string('a' + rune(i)), instance: p, isEnabled: 1})
+	}
+	return holder
+}
+
+func TestRunPreCheckTx(t *testing.T) {
+	errRejected := sdk.ErrUnauthorized("rejected")
+	accept := funcPlugin(func() sdk.Error { return nil })
+	reject := funcPlugin(func() sdk.Error { return errRejected })
+	holder := newSandboxHolder(accept, reject, accept)
+
+	require.Equal(t, errRejected, holder.RunPreCheckTx(abci.RequestCheckTx{}, nil))
+	status := holder.GetPluginsStatus()
+	require.Equal(t, int64(1), status[0].Accepted)
+	require.Equal(t, int64(1), status[1].Rejected)
+	require.Equal(t, int64(0), status[2].Accepted)
+}
+
+func TestRunPreCheckTxFailures(t *testing.T) {
+	accept := funcPlugin(func() sdk.Error { return nil })
+	slow := funcPlugin(func() sdk.Error {
+		time.Sleep(time.Second)
+		return sdk.ErrUnauthorized("too late")
+	})
+	panicking := funcPlugin(func() sdk.Error { panic("plugin panics") })
+	holder := newSandboxHolder(slow, panicking, accept)
+
+	require.Nil(t, holder.RunPreCheckTx(abci.RequestCheckTx{}, nil))
+	status := holder.GetPluginsStatus()
+	require.Equal(t, int64(1), status[0].Timeouts)
+	require.Equal(t, int64(1), status[1].Panics)
+	require.Equal(t, int64(1), status[2].Accepted)
+	require.Equal(t, 3, len(holder.GetPlugins()))
+
+	// disabled after max consecutive failures
+	require.Nil(t, holder.RunPreCheckTx(abci.RequestCheckTx{}, nil))
+	status = holder.GetPluginsStatus()
+	require.False(t, status[0].Enabled)
+	require.False(t, status[1].Enabled)
+	require.True(t, status[2].Enabled)
+	require.Equal(t, int64(2), status[0].ConsecutiveFailures)
+	require.Equal(t, 1, len(holder.GetPlugins()))
+
+	// enabling again resets the failures
+	require.Nil(t, holder.EnablePlugin("b"))
+	require.Equal(t, int64(0), holder.GetPluginsStatus()[1].ConsecutiveFailures)
+}
+
+func TestNotifyObserversTimeout(t *testing.T) {
+	slow := &observerPlugin{}
+	holder := newSandboxHolder(slow)
+	block := make(chan struct{})
+	defer close(block)
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		holder.NotifyObservers(func(o AppObserver) {
+			<-block
+		})
+		require.True(t, time.Since(start) < time.Second)
+	}
+	status := holder.GetPluginsStatus()
+	require.Equal(t, int64(2), status[0].Timeouts)
+	require.False(t, status[0].Enabled)
+}
+
+func TestStuckCalls(t *testing.T) {
+	release := make(chan struct{})
+	stuck := funcPlugin(func() sdk.Error {
+		<-release
+		return nil
+	})
+	holder := newSandboxHolder(stuck)
+	holder.maxFailures = 0
+
+	for i := 0; i < MaxStuckCalls; i++ {
+		require.True(t, holder.GetPluginsStatus()[0].Enabled)
+		require.Nil(t, holder.RunPreCheckTx(abci.RequestCheckTx{}, nil))
+	}
+	status := holder.GetPluginsStatus()
+	require.False(t, status[0].Enabled)
+	require.Equal(t, int64(MaxStuckCalls), status[0].StuckCalls)
+	require.Equal(t, int64(MaxStuckCalls), status[0].Timeouts)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return holder.GetPluginsStatus()[0].StuckCalls == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
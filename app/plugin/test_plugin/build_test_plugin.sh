@@ -6,7 +6,19 @@ RACE=$(ps -f -p $(ps -f -p $PPID | awk '!/PID/{print $3}') | grep ' -race ')
 
 if [[ -z ${RACE} ]]
 then
-    go build --buildmode=plugin -o ./data/plugin.so test_plugin.go
+    BUILD_FLAGS="--buildmode=plugin"
 else
-    go build -race --buildmode=plugin -o ./data/plugin.so test_plugin.go
-fi
\ No newline at end of file
+    BUILD_FLAGS="-race --buildmode=plugin"
+fi
+
+mkdir -p ./data/plugins ./data/_src
+go build ${BUILD_FLAGS} -o ./data/plugins/test_plugin.so test_plugin.go
+
+# another build with different contents, to test upgrading a loaded plugin
+sed 's/"TestPlugin"/"TestPluginV2"/' test_plugin.go > ./data/_src/test_plugin_v2.go
+go build ${BUILD_FLAGS} -o ./data/plugins/test_plugin_v2.so ./data/_src/test_plugin_v2.go
+
+# builds of the package, whose pluginpath is the import path of the package unless it is given
+go build ${BUILD_FLAGS} -o ./data/plugins/pkg_plugin.so .
+go build ${BUILD_FLAGS} -ldflags=-X=github.com/coinexchain/dex/app/plugin/test_plugin.build=V3 -o ./data/plugins/pkg_plugin_v3_same_path.so .
+go build ${BUILD_FLAGS} -gcflags=-p=test_plugin_v3 "-ldflags=-pluginpath=test_plugin_v3 -X=test_plugin_v3.build=V3" -o ./data/plugins/pkg_plugin_v3.so .
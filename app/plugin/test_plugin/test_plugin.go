@@ -6,6 +6,9 @@ import (
 	"github.com/tendermint/tendermint/libs/log"
 )
 
+// build is set by -ldflags=-X=main.build=..., to make builds of the package with different contents
+var build string
+
 type TestMsgFilter struct {
 }
 
@@ -14,7 +17,7 @@ func (f TestMsgFilter) PreCheckTx(req abci.RequestCheckTx, txDecoder sdk.TxDecod
 }
 
 func (f TestMsgFilter) Name() string {
-	return "TestPlugin"
+	return "TestPlugin" + build
 }
 
 // Instance is the exported symbol
@@ -1,9 +1,13 @@
 package app
 
 import (
+	"encoding/json"
+	"fmt"
+
 	abci "github.com/tendermint/tendermint/abci/types"
 
 	"github.com/coinexchain/cet-sdk/msgqueue"
+	"github.com/coinexchain/dex/app/sink"
 )
 
 type PubMsg struct {
@@ -32,3 +36,21 @@ func discardKafkaEvents(events []abci.Event) []abci.Event {
 	}
 	return nonKafkaEvents
 }
+
+// sendPubMsgs numbers the pub messages of the block with the commit marker at last, writes them to the WAL
+// and then sends them. Consumers can tell a partial block by the count in the commit marker.
+func (app *CetChainApp) sendPubMsgs() {
+	msgs := make([]sink.Msg, 0, len(app.pubMsgs)+1)
+	for i, msg := range app.pubMsgs {
+		msgs = append(msgs, sink.NewBlockMsg(app.height, int64(i), msg.Key, msg.Value))
+	}
+	commit, _ := json.Marshal(sink.CommitInfo{Height: app.height, Count: int64(len(msgs))})
+	msgs = append(msgs, sink.NewBlockMsg(app.height, int64(len(msgs)), []byte(sink.CommitKey), commit))
+
+	if app.pubMsgWAL != nil {
+		if err := app.pubMsgWAL.Write(app.height, msgs); err != nil {
+			app.Logger().Error(fmt.Sprintf("write pub msgs of height %d to WAL failed: %s", app.height, err.Error()))
+		}
+	}
+	sink.SendBlockMsgs(app.msgQueProducer, msgs)
+}
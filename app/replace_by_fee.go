@@ -0,0 +1,119 @@
+package app
+
+import (
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+
+	dex "github.com/coinexchain/cet-sdk/types"
+)
+
+func getGasPrice(tx auth.StdTx) sdk.Dec {
+	if tx.Fee.Gas == 0 {
+		return sdk.ZeroDec()
+	}
+	return sdk.NewDecFromInt(tx.Fee.Amount.AmountOf(dex.CET)).QuoInt64(int64(tx.Fee.Gas))
+}
+
+// getSequences returns the sequences the signers must sign a new tx with, which count in the txs in mempool
+func (app *CetChainApp) getSequences(signers []sdk.AccAddress) []uint64 {
+	ctx := app.NewContext(true, abci.Header{})
+	sequences := make([]uint64, len(signers))
+	for i, signer := range signers {
+		if acc := app.accountKeeper.GetAccount(ctx, signer); acc != nil {
+			sequences[i] = acc.GetSequence()
+		}
+	}
+	return sequences
+}
+
+// signedFor returns whether stdTx is signed with the sequences of the tracked txs of its signers, so that
+// it replaces them instead of the other unconfirmed txs of the signers
+func (app *CetChainApp) signedFor(stdTx auth.StdTx, signers []sdk.AccAddress) func(txs []UnconfirmedTx) bool {
+	ctx := app.NewContext(true, app.checkHeader)
+	sigs := stdTx.GetSignatures()
+	return func(txs []UnconfirmedTx) bool {
+		if len(sigs) != len(signers) {
+			return false
+		}
+		for i, signer := range signers {
+			acc := app.accountKeeper.GetAccount(ctx, signer)
+			if acc == nil {
+				return false
+			}
+			pubKey, res := auth.ProcessPubKey(acc, sigs[i], false)
+			if !res.IsOK() {
+				return false
+			}
+			var accNum uint64
+			if ctx.BlockHeight() != 0 {
+				accNum = acc.GetAccountNumber()
+			}
+			signBytes := auth.StdSignBytes(ctx.ChainID(), accNum, txs[i].Sequence, stdTx.Fee, stdTx.Msgs, stdTx.Memo)
+			if !pubKey.VerifyBytes(signBytes, sigs[i].Signature) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// replaceUnconfirmedTx accepts stdTx as the replacement of the tracked txs old, so it must be signed with the
+// same sequences as the old ones. The ante handler is run for stdTx on a branch of the check state, where the
+// sequences of the signers are set back to the ones of the old txs, and the branch is dropped afterwards. The
+// fees of the old txs have been deducted in the check state, so the signers must be able to pay both. The old
+// txs are evicted by the recheck after the next block, and then stdTx is checked again by the same recheck.
+// The old txs stay in the mempool until then, so the next proposer may still include them. Then stdTx fails
+// the recheck with a used sequence, and is evicted and no longer tracked.
+func (app *CetChainApp) replaceUnconfirmedTx(req abci.RequestCheckTx, stdTx auth.StdTx, hashid []byte,
+	signers []sdk.AccAddress, gasPrice sdk.Dec, old []UnconfirmedTx) (ret abci.ResponseCheckTx) {
+
+	msgs := stdTx.GetMsgs()
+	if len(msgs) == 0 {
+		return dex.ResponseFrom(sdk.ErrUnknownRequest("Tx.GetMsgs() must return at least one message in list"))
+	}
+	for _, msg := range msgs {
+		if err := msg.ValidateBasic(); err != nil {
+			return dex.ResponseFrom(err)
+		}
+	}
+
+	ctx := app.NewContext(true, app.checkHeader).WithTxBytes(req.Tx)
+	ctx = ctx.WithMultiStore(ctx.MultiStore().CacheMultiStore())
+	for i, signer := range signers {
+		acc := app.accountKeeper.GetAccount(ctx, signer)
+		if acc == nil {
+			return dex.ResponseFrom(sdk.ErrUnknownAddress(fmt.Sprintf("account %s does not exist", signer)))
+		}
+		if err := acc.SetSequence(old[i].Sequence); err != nil {
+			return dex.ResponseFrom(sdk.ErrInternal(err.Error()))
+		}
+		app.accountKeeper.SetAccount(ctx, acc)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ret = dex.ResponseFrom(sdk.ErrInternal(fmt.Sprintf("recovered: %v", r)))
+		}
+	}()
+	newCtx, result, _ := app.anteHandler(ctx, stdTx, false)
+	if !result.IsOK() {
+		return abci.ResponseCheckTx{
+			Code:      uint32(result.Code),
+			Codespace: string(result.Codespace),
+			Log:       result.Log,
+			GasWanted: int64(stdTx.Fee.Gas),
+			GasUsed:   int64(newCtx.GasMeter().GasConsumed()),
+		}
+	}
+
+	txs := make([]UnconfirmedTx, len(signers))
+	for i := range signers {
+		txs[i] = UnconfirmedTx{HashID: hashid, Timestamp: app.currBlockTime, GasPrice: gasPrice, Sequence: old[i].Sequence}
+	}
+	app.account2UnconfirmedTx.Replace(signers, old[0].HashID, txs)
+	return abci.ResponseCheckTx{GasWanted: int64(stdTx.Fee.Gas), GasUsed: int64(newCtx.GasMeter().GasConsumed())}
+}
@@ -0,0 +1,261 @@
+package app
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/coinexchain/cet-sdk/modules/authx"
+	"github.com/coinexchain/cet-sdk/modules/bancorlite"
+	"github.com/coinexchain/cet-sdk/modules/market"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app/notify"
+)
+
+const (
+	// CancelOrderByShutdown is the del_reason of the orders canceled since the market route is disabled
+	CancelOrderByShutdown = "The market is shut down"
+
+	// cancelOrderInfoKey is the key of the market.CancelOrderInfo messages, market does not export its
+	// CancelOrderInfoKey in the version of cet-sdk this app depends on
+	cancelOrderInfoKey = "del_order_info"
+)
+
+// bancorReportKeyPrefix is followed by the big endian height in the main store, the value is the
+// BancorShutdownReport of the pools canceled at the height
+var bancorReportKeyPrefix = []byte("msgroutes/bancor-report/")
+
+// bancorErrorKeyPrefix is followed by the symbol of a pool kept since its coins can not be unfrozen, the value is
+// the error last reported for it
+var bancorErrorKeyPrefix = []byte("msgroutes/bancor-error/")
+
+// BancorRefund is a pool canceled since the bancorlite route is disabled, with the coins unfrozen to its owner.
+// Error is why the coins are not unfrozen, then the pool is not removed and is canceled again at the next block.
+type BancorRefund struct {
+	Owner       sdk.AccAddress `json:"owner"`
+	Stock       string         `json:"stock"`
+	Money       string         `json:"money"`
+	StockAmount sdk.Int        `json:"stock_amount"`
+	MoneyAmount sdk.Int        `json:"money_amount"`
+	Success     bool           `json:"success"`
+	Removed     bool           `json:"removed"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// BancorShutdownReport is the proof of the refunds of the pools canceled at Height
+type BancorShutdownReport struct {
+	Height  int64          `json:"height"`
+	Refunds []BancorRefund `json:"refunds"`
+}
+
+type BancorShutdownReports []BancorShutdownReport
+
+func (reports BancorShutdownReports) String() string {
+	var sb strings.Builder
+	for _, report := range reports {
+		sb.WriteString(fmt.Sprintf("Height %d:\n", report.Height))
+		for _, r := range report.Refunds {
+			sb.WriteString(fmt.Sprintf("  %s %s/%s: %s%s %s%s", r.Owner, r.Stock, r.Money,
+				r.StockAmount, r.Stock, r.MoneyAmount, r.Money))
+			if r.Success {
+				sb.WriteString(" refunded\n")
+			} else {
+				sb.WriteString(fmt.Sprintf(" failed, the pool is kept: %s\n", r.Error))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// cancelAllBancors unfreezes the coins of the pools to their owners and removes the pools. A pool whose coins can
+// not be unfrozen is kept unchanged, and is canceled again at the next block. Both are recorded in the report of
+// the height, published as bancor_shutdown_report, but a kept pool only when its error changes. No report is
+// written if nothing is recorded.
+func (app *CetChainApp) cancelAllBancors(ctx sdk.Context) {
+	k := app.bancorKeeper
+	bis := k.GetAllBancorInfos(ctx)
+	if len(bis) == 0 {
+		return
+	}
+	report := BancorShutdownReport{Height: ctx.BlockHeight(), Refunds: make([]BancorRefund, 0, len(bis))}
+	removed := 0
+	for _, bi := range bis {
+		refund := BancorRefund{
+			Owner:       bi.Owner,
+			Stock:       bi.Stock,
+			Money:       bi.Money,
+			StockAmount: bi.StockInPool,
+			MoneyAmount: bi.MoneyInPool,
+			Success:     true,
+		}
+		cacheCtx, write := ctx.CacheContext()
+		var errs []string
+		if err := k.UnFreezeCoins(cacheCtx, bi.Owner, sdk.NewCoins(sdk.NewCoin(bi.Stock, bi.StockInPool))); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if err := k.UnFreezeCoins(cacheCtx, bi.Owner, sdk.NewCoins(sdk.NewCoin(bi.Money, bi.MoneyInPool))); err != nil {
+			errs = append(errs, err.Error())
+		}
+		errKey := append(append([]byte{}, bancorErrorKeyPrefix...), bi.GetSymbol()...)
+		if len(errs) == 0 {
+			k.Remove(cacheCtx, bi)
+			write()
+			ctx.KVStore(app.keyMain).Delete(errKey)
+			refund.Removed = true
+			removed++
+		} else {
+			refund.Success = false
+			refund.Error = strings.Join(errs, "; ")
+			if string(ctx.KVStore(app.keyMain).Get(errKey)) == refund.Error {
+				continue
+			}
+			ctx.KVStore(app.keyMain).Set(errKey, []byte(refund.Error))
+			app.Logger().Error(fmt.Sprintf("refund pool %s/%s of %s failed, the pool is kept: %s",
+				bi.Stock, bi.Money, bi.Owner, refund.Error))
+		}
+		report.Refunds = append(report.Refunds, refund)
+	}
+	if len(report.Refunds) == 0 {
+		return
+	}
+	ctx.KVStore(app.keyMain).Set(bancorReportKey(report.Height), app.cdc.MustMarshalBinaryBare(report))
+	if app.msgQueProducer.IsOpenToggle() {
+		app.appendBancorShutdownReport(report)
+	}
+	app.Logger().Info(fmt.Sprintf("%d of %d pools are canceled since bancorlite is shut down", removed, len(bis)))
+}
+
+// GetBancorShutdownReports returns the reports of the heights at which pools are canceled, in the order of height
+func (app *CetChainApp) GetBancorShutdownReports(ctx sdk.Context) BancorShutdownReports {
+	reports := BancorShutdownReports{}
+	iter := sdk.KVStorePrefixIterator(ctx.KVStore(app.keyMain), bancorReportKeyPrefix)
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		var report BancorShutdownReport
+		app.cdc.MustUnmarshalBinaryBare(iter.Value(), &report)
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func (app *CetChainApp) appendBancorShutdownReport(report BancorShutdownReport) {
+	msg := notify.NotificationBancorShutdownReport{
+		Version: notify.SchemaVersion,
+		Height:  report.Height,
+		Refunds: make([]notify.BancorRefund, len(report.Refunds)),
+	}
+	for i, r := range report.Refunds {
+		msg.Refunds[i] = notify.BancorRefund{
+			Owner:       r.Owner.String(),
+			Stock:       r.Stock,
+			Money:       r.Money,
+			StockAmount: r.StockAmount,
+			MoneyAmount: r.MoneyAmount,
+			Success:     r.Success,
+			Removed:     r.Removed,
+			Error:       r.Error,
+		}
+	}
+	app.appendPubMsgKV(notify.KeyBancorShutdownReport, dex.SafeJSONMarshal(msg))
+}
+
+func bancorReportKey(height int64) []byte {
+	bz := make([]byte, 8)
+	binary.BigEndian.PutUint64(bz, uint64(height))
+	return append(append([]byte{}, bancorReportKeyPrefix...), bz...)
+}
+
+// cancelAllOrders cancels the open orders without charging their commissions and feature fees. The frozen stock
+// or money, commission and feature fee of an order are unfrozen to its sender, then the order, with nothing frozen
+// left, is removed from the order keeper by the cancel handler of market, which does not export the order keeper.
+// Their del_order_info messages are published with CancelOrderByShutdown as the reason.
+func (app *CetChainApp) cancelAllOrders(ctx sdk.Context) {
+	orders := app.marketKeeper.GetAllOrders(ctx)
+	if len(orders) == 0 {
+		return
+	}
+	handler := market.NewHandler(app.marketKeeper)
+	canceled := 0
+	for _, order := range orders {
+		info := market.CancelOrderInfo{
+			OrderID:      order.OrderID(),
+			TradingPair:  order.TradingPair,
+			Height:       ctx.BlockHeight(),
+			Side:         order.Side,
+			Price:        order.Price,
+			DelReason:    CancelOrderByShutdown,
+			LeftStock:    order.LeftStock,
+			RemainAmount: order.Freeze,
+			DealStock:    order.DealStock,
+			DealMoney:    order.DealMoney,
+		}
+		cacheCtx, write := ctx.CacheContext()
+		if err := app.removeOrder(cacheCtx, handler, order); err != nil {
+			app.Logger().Error(fmt.Sprintf("cancel order %s failed: %s", info.OrderID, err.Error()))
+			continue
+		}
+		write()
+		canceled++
+		if app.msgQueProducer.IsOpenToggle() {
+			app.appendPubMsgKV(cancelOrderInfoKey, dex.SafeJSONMarshal(info))
+		}
+	}
+	app.Logger().Info(fmt.Sprintf("%d orders are canceled since the market is shut down", canceled))
+}
+
+// removeOrder unfreezes the coins frozen by order and removes it
+func (app *CetChainApp) removeOrder(ctx sdk.Context, handler sdk.Handler, order *market.Order) error {
+	// a bid order of a market against cet freezes its money and fees in cet both
+	frozen := sdk.NewCoins(sdk.NewInt64Coin(order.GetOrderUsedDenom(), order.Freeze)).
+		Add(dex.NewCetCoins(order.FrozenCommission + order.FrozenFeatureFee))
+	if !frozen.IsZero() {
+		if err := app.marketKeeper.UnFreezeCoins(ctx, order.Sender, frozen); err != nil {
+			return err
+		}
+	}
+	order.Freeze, order.FrozenCommission, order.FrozenFeatureFee = 0, 0, 0
+	if err := app.marketKeeper.SetOrder(ctx, order); err != nil {
+		return err
+	}
+	// the events of the handler are dropped, its del_order_info is replaced by the one of cancelAllOrders
+	res := handler(ctx.WithEventManager(sdk.NewEventManager()),
+		market.MsgCancelOrder{Sender: order.Sender, OrderID: order.OrderID()})
+	if !res.IsOK() {
+		return fmt.Errorf("%s", res.Log)
+	}
+	return nil
+}
+
+// shutdownInvariant checks that the disabled market and bancorlite routes leave no order and no pool behind,
+// and no coins stay frozen once both of them, which are the only ones freezing coins, are shut down
+func (app *CetChainApp) shutdownInvariant(ctx sdk.Context) (string, bool) {
+	marketShutdown := app.msgRoutesKeeper.IsShutdown(ctx, market.ModuleName)
+	bancorShutdown := app.msgRoutesKeeper.IsShutdown(ctx, bancorlite.ModuleName)
+
+	var msg string
+	var broken bool
+	if marketShutdown {
+		if n := len(app.marketKeeper.GetAllOrders(ctx)); n != 0 {
+			msg += fmt.Sprintf("\t%d orders are left in the shut down market\n", n)
+			broken = true
+		}
+	}
+	if bancorShutdown {
+		if n := len(app.bancorKeeper.GetAllBancorInfos(ctx)); n != 0 {
+			msg += fmt.Sprintf("\t%d pools are left in the shut down bancorlite\n", n)
+			broken = true
+		}
+	}
+	if marketShutdown && bancorShutdown {
+		app.accountXKeeper.IterateAccounts(ctx, func(ax authx.AccountX) bool {
+			if !ax.FrozenCoins.IsZero() {
+				msg += fmt.Sprintf("\t%s has frozen coins %s\n", ax.Address, ax.FrozenCoins)
+				broken = true
+			}
+			return false
+		})
+	}
+	return sdk.FormatInvariant(MsgRoutesParamspace, "shutdown", msg), broken
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/coinexchain/cet-sdk/modules/asset"
+	"github.com/coinexchain/cet-sdk/modules/bancorlite"
+	"github.com/coinexchain/cet-sdk/modules/market"
+	"github.com/coinexchain/cet-sdk/msgqueue"
+	"github.com/coinexchain/cet-sdk/testutil"
+
+	"github.com/coinexchain/dex/app/notify"
+	"github.com/coinexchain/dex/app/sink"
+)
+
+// setPubMsgConfig opens the msg queue of the topics, the keepers get their producers from the config, so it is
+// set before the app is created
+func setPubMsgConfig(t *testing.T, topics string) (cleanup func()) {
+	dir, err := ioutil.TempDir("", "shutdown")
+	require.Nil(t, err)
+	olds := make(map[string]interface{})
+	for key, value := range map[string]interface{}{
+		msgqueue.FlagBrokers:       []string{"nop"},
+		msgqueue.FlagTopics:        topics,
+		msgqueue.FlagFeatureToggle: true,
+		sink.FlagWALDir:            dir,
+		sink.FlagAsyncSpillDir:     filepath.Join(dir, "spill"),
+	} {
+		olds[key] = viper.Get(key)
+		viper.Set(key, value)
+	}
+	return func() {
+		for key, old := range olds {
+			viper.Set(key, old)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMarketShutdown(t *testing.T) {
+	// the del_order_info messages come from the market keeper
+	defer setPubMsgConfig(t, market.ModuleName)()
+
+	key, acc := testutil.NewBaseAccount(1e16, 0, 0)
+	app := initAppWithAccounts(acc)
+
+	header := abci.Header{Height: 1, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	msgs := []sdk.Msg{
+		asset.NewMsgIssueToken("abc", "abc", sdk.NewInt(1e12), acc.Address,
+			false, false, false, false, "", "", asset.TestIdentityString),
+		market.MsgCreateTradingPair{Stock: "abc", Money: "cet", Creator: acc.Address, PricePrecision: 8},
+		market.MsgCreateOrder{Sender: acc.Address, Identify: 1, TradingPair: "abc/cet", OrderType: market.LimitOrder,
+			PricePrecision: 8, Price: 200, Quantity: 1e8, Side: market.SELL, TimeInForce: market.GTE},
+		market.MsgCreateOrder{Sender: acc.Address, Identify: 2, TradingPair: "abc/cet", OrderType: market.LimitOrder,
+			PricePrecision: 8, Price: 100, Quantity: 1e8, Side: market.BUY, TimeInForce: market.GTE},
+	}
+	tx := newStdTxBuilder().Msgs(msgs...).GasAndFee(9000000, 100).AccNumSeqKey(0, 0, key).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	ctx := app.NewContext(false, header)
+	require.Equal(t, 2, len(app.marketKeeper.GetAllOrders(ctx)))
+	ax, _ := app.accountXKeeper.GetAccountX(ctx, acc.Address)
+	require.False(t, ax.FrozenCoins.IsZero())
+	remains := make(map[string]int64)
+	for _, order := range app.marketKeeper.GetAllOrders(ctx) {
+		remains[order.OrderID()] = order.Freeze
+	}
+	coins := app.accountKeeper.GetAccount(ctx, acc.Address).GetCoins().Add(ax.FrozenCoins)
+	app.msgRoutesKeeper.SetParams(ctx, MsgRoutesParams{DisabledMsgRoutes: []DisabledMsgRoute{
+		{Route: market.ModuleName, Height: 2},
+		{Route: "bancorlite", Height: 2},
+	}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	header = abci.Header{Height: 2, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	ctx = app.NewContext(false, header)
+	require.Empty(t, app.marketKeeper.GetAllOrders(ctx))
+	ax, _ = app.accountXKeeper.GetAccountX(ctx, acc.Address)
+	require.True(t, ax.FrozenCoins.IsZero())
+	// all the frozen coins are refunded, no commission or feature fee is charged
+	require.Equal(t, coins, app.accountKeeper.GetAccount(ctx, acc.Address).GetCoins())
+	values := pubMsgsOf(app, cancelOrderInfoKey)
+	require.Equal(t, 2, len(values))
+	for _, value := range values {
+		var info market.CancelOrderInfo
+		require.Nil(t, json.Unmarshal(value, &info))
+		require.Equal(t, CancelOrderByShutdown, info.DelReason)
+		require.Equal(t, int64(2), info.Height)
+		require.Equal(t, remains[info.OrderID], info.RemainAmount)
+		require.Zero(t, info.UsedCommission)
+		require.Zero(t, info.UsedFeatureFee)
+	}
+	require.True(t, app.msgRoutesKeeper.IsShutdown(ctx, market.ModuleName))
+	_, broken := app.shutdownInvariant(ctx)
+	require.False(t, broken)
+
+	order := &market.Order{Sender: acc.Address, Sequence: 9, TradingPair: "abc/cet", OrderType: market.LimitOrder,
+		Price: sdk.NewDec(1), Quantity: 1, Side: market.SELL, TimeInForce: market.GTE, Height: 2, LeftStock: 1}
+	require.Nil(t, app.marketKeeper.SetOrder(ctx, order))
+	msg, broken := app.shutdownInvariant(ctx)
+	require.True(t, broken)
+	require.Contains(t, msg, "1 orders are left in the shut down market")
+
+	// enabled again
+	app.msgRoutesKeeper.SetParams(ctx, MsgRoutesParams{})
+	app.msgRoutesKeeper.Shutdown(ctx)
+	require.False(t, app.msgRoutesKeeper.IsShutdown(ctx, market.ModuleName))
+	_, broken = app.shutdownInvariant(ctx)
+	require.False(t, broken)
+}
+
+func TestBancorShutdownReport(t *testing.T) {
+	defer setPubMsgConfig(t, bancorlite.ModuleName)()
+
+	key, acc := testutil.NewBaseAccount(1e16, 0, 0)
+	app := initAppWithAccounts(acc)
+
+	header := abci.Header{Height: 1, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	msgs := []sdk.Msg{
+		asset.MsgIssueToken{Owner: acc.Address, Symbol: "foo", Identity: "foo", TotalSupply: sdk.NewInt(10000)},
+		asset.MsgIssueToken{Owner: acc.Address, Symbol: "bar", Identity: "bar", TotalSupply: sdk.NewInt(10000)},
+		bancorlite.MsgBancorInit{Owner: acc.Address, Stock: "foo", Money: "bar", MaxMoney: sdk.NewInt(300), MaxSupply: sdk.NewInt(100), MaxPrice: "10", InitPrice: "1"},
+		bancorlite.MsgBancorInit{Owner: acc.Address, Stock: "bar", Money: "foo", MaxMoney: sdk.NewInt(300), MaxSupply: sdk.NewInt(100), MaxPrice: "10", InitPrice: "1"},
+	}
+	tx := newStdTxBuilder().Msgs(msgs...).GasAndFee(9000000, 100).AccNumSeqKey(0, 0, key).Build()
+	require.Equal(t, sdk.CodeOK, app.Deliver(tx).Code)
+	ctx := app.NewContext(false, header)
+	// the bar of the bar/foo pool can not be unfrozen
+	ax, _ := app.accountXKeeper.GetAccountX(ctx, acc.Address)
+	require.Equal(t, sdk.NewCoins(sdk.NewInt64Coin("bar", 100), sdk.NewInt64Coin("foo", 100)), ax.FrozenCoins)
+	ax.FrozenCoins = sdk.NewCoins(sdk.NewInt64Coin("foo", 100))
+	app.accountXKeeper.SetAccountX(ctx, ax)
+	app.msgRoutesKeeper.SetParams(ctx, MsgRoutesParams{DisabledMsgRoutes: []DisabledMsgRoute{
+		{Route: bancorlite.ModuleName, Height: 2},
+	}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	header = abci.Header{Height: 2, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	ctx = app.NewContext(false, header)
+	// the pool whose coins can not be unfrozen is kept
+	bis := app.bancorKeeper.GetAllBancorInfos(ctx)
+	require.Equal(t, 1, len(bis))
+	require.Equal(t, "bar", bis[0].Stock)
+	reports := app.GetBancorShutdownReports(ctx)
+	require.Equal(t, 1, len(reports))
+	require.Equal(t, int64(2), reports[0].Height)
+	refunds := make(map[string]BancorRefund)
+	for _, r := range reports[0].Refunds {
+		require.Equal(t, acc.Address, r.Owner)
+		refunds[r.Stock+"/"+r.Money] = r
+	}
+	require.Equal(t, 2, len(refunds))
+	require.True(t, refunds["foo/bar"].Success)
+	require.True(t, refunds["foo/bar"].Removed)
+	require.Equal(t, sdk.NewInt(100), refunds["foo/bar"].StockAmount)
+	require.Empty(t, refunds["foo/bar"].Error)
+	require.False(t, refunds["bar/foo"].Success)
+	require.False(t, refunds["bar/foo"].Removed)
+	require.Equal(t, sdk.NewInt(100), refunds["bar/foo"].StockAmount)
+	require.Contains(t, refunds["bar/foo"].Error, "insufficient coins to unfreeze")
+
+	msg, err := notify.DecodeBancorShutdownReport(lastPubMsgOf(t, app, notify.KeyBancorShutdownReport))
+	require.Nil(t, err)
+	require.Equal(t, notify.SchemaVersion, msg.Version)
+	require.Equal(t, int64(2), msg.Height)
+	require.Equal(t, 2, len(msg.Refunds))
+	for _, r := range msg.Refunds {
+		require.Equal(t, r.Success, r.Removed)
+	}
+
+	bz, qerr := app.queryMsgRoutes(ctx, []string{QueryBancorShutdownReports}, abci.RequestQuery{})
+	require.Nil(t, qerr)
+	var queried BancorShutdownReports
+	require.Nil(t, app.cdc.UnmarshalJSON(bz, &queried))
+	require.Equal(t, reports, queried)
+	_, broken := app.shutdownInvariant(ctx)
+	require.True(t, broken)
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+
+	// the kept pool fails again with the same error, which is not reported again
+	header = abci.Header{Height: 3, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	ctx = app.NewContext(false, header)
+	require.Equal(t, 1, len(app.bancorKeeper.GetAllBancorInfos(ctx)))
+	require.Equal(t, 1, len(app.GetBancorShutdownReports(ctx)))
+	require.Empty(t, pubMsgsOf(app, notify.KeyBancorShutdownReport))
+	ax, _ = app.accountXKeeper.GetAccountX(ctx, acc.Address)
+	ax.FrozenCoins = sdk.NewCoins(sdk.NewInt64Coin("bar", 100))
+	app.accountXKeeper.SetAccountX(ctx, ax)
+	app.EndBlock(abci.RequestEndBlock{Height: 3})
+	app.Commit()
+
+	// the kept pool is canceled again at the next block
+	header = abci.Header{Height: 4, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	ctx = app.NewContext(false, header)
+	require.Empty(t, app.bancorKeeper.GetAllBancorInfos(ctx))
+	reports = app.GetBancorShutdownReports(ctx)
+	require.Equal(t, 2, len(reports))
+	require.Equal(t, int64(4), reports[1].Height)
+	require.Equal(t, []BancorRefund{{Owner: acc.Address, Stock: "bar", Money: "foo", StockAmount: sdk.NewInt(100),
+		MoneyAmount: sdk.ZeroInt(), Success: true, Removed: true}}, reports[1].Refunds)
+	require.Nil(t, ctx.KVStore(app.keyMain).Get(append(append([]byte{}, bancorErrorKeyPrefix...), "bar/foo"...)))
+	app.EndBlock(abci.RequestEndBlock{Height: 4})
+	app.Commit()
+
+	// no report is added once the pools are canceled
+	header = abci.Header{Height: 5, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	require.Equal(t, 2, len(app.GetBancorShutdownReports(app.NewContext(false, header))))
+	require.Empty(t, pubMsgsOf(app, notify.KeyBancorShutdownReport))
+}
@@ -0,0 +1,333 @@
+package sink
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/client/flags"
+	"github.com/spf13/viper"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/coinexchain/cet-sdk/msgqueue"
+)
+
+const (
+	// FlagAsyncEnable, FlagAsyncQueueSize, FlagAsyncSpillDir, FlagAsyncSpillMaxBytes and FlagAsyncPolicy are the
+	// keys of the asynchronous sender in app.toml:
+	//
+	//	[pubmsg-async]
+	//	enable = true
+	//	queue-size = 100
+	//	spill-dir = "data/pubmsg-spill"
+	//	spill-max-bytes = 1073741824
+	//	policy = "block"
+	//
+	// The asynchronous sender is enabled by default when pub messages are enabled, set enable to false to send
+	// the blocks before Commit returns. Every block is written and synced to the spill files before Commit returns, until
+	// they reach spill-max-bytes, and up to queue-size of the oldest ones are also kept in memory. The position
+	// after the last block sent is saved in the spill dir, the next run sends the blocks after it. Spilling is
+	// disabled if spill-max-bytes is 0, then the blocks are only kept in memory and the ones not sent yet are
+	// lost when the node stops. When the queue is full, the policy decides what to do with a new block.
+	FlagAsyncEnable        = "pubmsg-async.enable"
+	FlagAsyncQueueSize     = "pubmsg-async.queue-size"
+	FlagAsyncSpillDir      = "pubmsg-async.spill-dir"
+	FlagAsyncSpillMaxBytes = "pubmsg-async.spill-max-bytes"
+	FlagAsyncPolicy        = "pubmsg-async.policy"
+
+	DefaultAsyncQueueSize     = 100
+	DefaultAsyncSpillDir      = "data/pubmsg-spill"
+	DefaultAsyncSpillMaxBytes = 1024 * 1024 * 1024
+	DefaultAsyncCloseTimeout  = 10 * time.Second
+
+	// PolicyBlock waits until the consumers catch up, which stalls the block production as the synchronous sender
+	PolicyBlock = "block"
+	// PolicyDrop drops the new block, the dropped heights can be sent again with the replay-pubmsgs command
+	PolicyDrop = "drop"
+	// PolicyHalt panics to stop the node
+	PolicyHalt = "halt"
+)
+
+// AsyncConfig configures an AsyncSender, SpillDir is an absolute path. Close waits up to CloseTimeout for the
+// block being sent.
+type AsyncConfig struct {
+	QueueSize     int
+	SpillDir      string
+	SpillMaxBytes int64
+	Policy        string
+	CloseTimeout  time.Duration
+}
+
+// AsyncConfigFromConfig returns the config in app.toml, and whether the asynchronous sender is enabled, which
+// is the default
+func AsyncConfigFromConfig() (AsyncConfig, bool) {
+	conf := AsyncConfig{
+		QueueSize:     DefaultAsyncQueueSize,
+		SpillDir:      viper.GetString(FlagAsyncSpillDir),
+		SpillMaxBytes: DefaultAsyncSpillMaxBytes,
+		Policy:        viper.GetString(FlagAsyncPolicy),
+		CloseTimeout:  DefaultAsyncCloseTimeout,
+	}
+	if viper.IsSet(FlagAsyncQueueSize) {
+		conf.QueueSize = viper.GetInt(FlagAsyncQueueSize)
+	}
+	if viper.IsSet(FlagAsyncSpillMaxBytes) {
+		conf.SpillMaxBytes = viper.GetInt64(FlagAsyncSpillMaxBytes)
+	}
+	if len(conf.SpillDir) == 0 {
+		conf.SpillDir = DefaultAsyncSpillDir
+	}
+	if !filepath.IsAbs(conf.SpillDir) {
+		conf.SpillDir = filepath.Join(viper.GetString(flags.FlagHome), conf.SpillDir)
+	}
+	if len(conf.Policy) == 0 {
+		conf.Policy = PolicyBlock
+	}
+	return conf, !viper.IsSet(FlagAsyncEnable) || viper.GetBool(FlagAsyncEnable)
+}
+
+// BlockSender is implemented by the senders which take all the messages of a block at once
+type BlockSender interface {
+	SendBlock(msgs []Msg)
+}
+
+// AsyncSender returns from SendBlock once the block is queued, and sends the queued blocks to the underlying
+// sender in a goroutine, so that a slow consumer does not stall the block production. The blocks are written
+// and synced to the spill files before SendBlock returns, and the memory queue caches the oldest of them. The
+// position after every block sent is saved, so the blocks not sent yet are sent by the next run even if the
+// node is killed. The block being sent then may be sent twice.
+type AsyncSender struct {
+	sender  msgqueue.MsgSender
+	conf    AsyncConfig
+	logger  log.Logger
+	metrics *Metrics
+
+	mtx        sync.Mutex
+	cond       *sync.Cond
+	queue      [][]Msg
+	lineSizes  []int64 // sizes of the lines of the queued blocks in the spill files
+	spill      *spillQueue
+	closed     bool
+	done       chan struct{}
+	lastQueued int64
+	lastSent   int64
+}
+
+var _ msgqueue.MsgSender = &AsyncSender{}
+var _ BlockSender = &AsyncSender{}
+
+// NewAsyncSender starts sending the blocks left in the spill files, and the ones queued later
+func NewAsyncSender(sender msgqueue.MsgSender, conf AsyncConfig, logger log.Logger) (*AsyncSender, error) {
+	return newAsyncSender(sender, conf, logger, getMetrics())
+}
+
+func newAsyncSender(sender msgqueue.MsgSender, conf AsyncConfig, logger log.Logger, metrics *Metrics) (*AsyncSender, error) {
+	switch conf.Policy {
+	case PolicyBlock, PolicyDrop, PolicyHalt:
+	default:
+		return nil, fmt.Errorf("unknown pubmsg-async policy: %s", conf.Policy)
+	}
+	if conf.QueueSize <= 0 {
+		return nil, fmt.Errorf("pubmsg-async queue-size must be positive")
+	}
+	if conf.CloseTimeout <= 0 {
+		conf.CloseTimeout = DefaultAsyncCloseTimeout
+	}
+	spill, err := openSpillQueue(conf.SpillDir, conf.SpillMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	s := &AsyncSender{
+		sender:  sender,
+		conf:    conf,
+		logger:  logger,
+		metrics: metrics,
+		spill:   spill,
+		done:    make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mtx)
+	if spill.blocks != 0 {
+		logger.Info(fmt.Sprintf("%d blocks of pub messages are left in %s", spill.blocks, conf.SpillDir))
+	}
+	s.updateMetrics()
+	go s.run()
+	return s, nil
+}
+
+// SendBlock queues the messages of a block, which is in the spill files once it returns unless spilling is
+// disabled. When the queue is full, the policy applies.
+func (s *AsyncSender) SendBlock(msgs []Msg) {
+	if len(msgs) == 0 {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for !s.enqueue(msgs) {
+		switch s.conf.Policy {
+		case PolicyDrop:
+			s.logger.Error(fmt.Sprintf("pub messages of height %d are dropped since the queue is full", msgs[0].Height))
+			s.metrics.DroppedBlocks.Add(1)
+			return
+		case PolicyHalt:
+			panic(fmt.Sprintf("pub messages of height %d can not be queued since the queue is full", msgs[0].Height))
+		default:
+			s.cond.Wait()
+		}
+	}
+	if msgs[0].Height > s.lastQueued {
+		s.lastQueued = msgs[0].Height
+	}
+	s.updateMetrics()
+	s.cond.Broadcast()
+}
+
+func (s *AsyncSender) enqueue(msgs []Msg) bool {
+	if s.closed {
+		return true
+	}
+	if s.spill.maxBytes <= 0 {
+		if len(s.queue) < s.conf.QueueSize {
+			s.queue = append(s.queue, msgs)
+			return true
+		}
+		return false
+	}
+	// the memory queue holds the oldest blocks of the spill files, a block is cached only if all the
+	// blocks before it are
+	cached := len(s.queue) == s.spill.blocks && len(s.queue) < s.conf.QueueSize
+	size, err := s.spill.push(msgs)
+	if err != nil {
+		if err != errSpillFull {
+			s.logger.Error(fmt.Sprintf("spill pub messages of height %d failed: %s", msgs[0].Height, err.Error()))
+		}
+		return false
+	}
+	if cached {
+		s.queue = append(s.queue, msgs)
+		s.lineSizes = append(s.lineSizes, size)
+	}
+	return true
+}
+
+func (s *AsyncSender) run() {
+	defer close(s.done)
+	for {
+		s.mtx.Lock()
+		for !s.closed && len(s.queue) == 0 && s.spill.blocks == 0 {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mtx.Unlock()
+			return
+		}
+		msgs, pos, spilled := s.dequeue()
+		s.updateMetrics()
+		s.cond.Broadcast()
+		s.mtx.Unlock()
+
+		if len(msgs) == 0 {
+			continue
+		}
+		SendBlockMsgs(s.sender, msgs)
+
+		s.mtx.Lock()
+		if spilled {
+			if err := s.spill.savePos(pos); err != nil {
+				s.logger.Error(fmt.Sprintf("save the spill offset of height %d failed, it may be sent again: %s",
+					msgs[0].Height, err.Error()))
+			}
+		}
+		s.lastSent = msgs[0].Height
+		s.updateMetrics()
+		s.mtx.Unlock()
+	}
+}
+
+// dequeue returns the oldest block, and the position after it in the spill files if it is spilled
+func (s *AsyncSender) dequeue() (msgs []Msg, pos spillPos, spilled bool) {
+	var err error
+	if len(s.queue) != 0 {
+		msgs = s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		if s.spill.maxBytes <= 0 {
+			return msgs, pos, false
+		}
+		size := s.lineSizes[0]
+		s.lineSizes = s.lineSizes[1:]
+		pos, err = s.spill.skip(size)
+	} else {
+		msgs, pos, err = s.spill.pop()
+	}
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("read spilled pub messages failed, %d blocks are dropped: %s",
+			s.spill.blocks, err.Error()))
+		s.dropSpill()
+		return nil, pos, false
+	}
+	return msgs, pos, true
+}
+
+// dropSpill drops the blocks in the spill files and the memory queue, which can not be read in order any more
+func (s *AsyncSender) dropSpill() {
+	s.metrics.DroppedBlocks.Add(float64(s.spill.blocks))
+	for i := range s.queue {
+		s.queue[i] = nil
+	}
+	s.queue = s.queue[:0]
+	s.lineSizes = s.lineSizes[:0]
+	if err := s.spill.reset(); err != nil {
+		s.logger.Error(fmt.Sprintf("remove spill files failed: %s", err.Error()))
+	}
+}
+
+func (s *AsyncSender) updateMetrics() {
+	s.metrics.QueueDepth.With("queue", "memory").Set(float64(len(s.queue)))
+	s.metrics.QueueDepth.With("queue", "spill").Set(float64(s.spill.blocks))
+	s.metrics.SpillBytes.Set(float64(s.spill.bytes))
+	if s.lastSent != 0 {
+		s.metrics.Lag.Set(float64(s.lastQueued - s.lastSent))
+	}
+}
+
+func (s *AsyncSender) SendMsg(key []byte, v []byte) {
+	s.SendBlock([]Msg{NewMsg(key, v)})
+}
+
+func (s *AsyncSender) IsSubscribed(topic string) bool {
+	return s.sender.IsSubscribed(topic)
+}
+
+func (s *AsyncSender) IsOpenToggle() bool {
+	return s.sender.IsOpenToggle()
+}
+
+func (s *AsyncSender) GetMode() []string {
+	return s.sender.GetMode()
+}
+
+// Close waits up to CloseTimeout for the block being sent and closes the underlying sender. The blocks not
+// sent yet are left in the spill files for the next run, they are lost if spilling is disabled. The block
+// still being sent after the timeout is sent again by the next run.
+func (s *AsyncSender) Close() {
+	s.mtx.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mtx.Unlock()
+	select {
+	case <-s.done:
+	case <-time.After(s.conf.CloseTimeout):
+		s.logger.Error(fmt.Sprintf("pub messages are still being sent after %s, close anyway", s.conf.CloseTimeout))
+	}
+
+	s.mtx.Lock()
+	if s.spill.maxBytes <= 0 && len(s.queue) != 0 {
+		s.logger.Error(fmt.Sprintf("%d blocks of pub messages are dropped on close", len(s.queue)))
+	}
+	s.queue = nil
+	s.lineSizes = nil
+	s.spill.close()
+	s.mtx.Unlock()
+	s.sender.Close()
+}
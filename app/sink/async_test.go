@@ -0,0 +1,321 @@
+package sink
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// slowSender blocks in SendBlockMsg until it is released
+type slowSender struct {
+	mtx      sync.Mutex
+	msgs     []Msg
+	started  chan struct{}
+	release  chan struct{}
+	once     sync.Once
+	isClosed bool
+}
+
+func newSlowSender() *slowSender {
+	return &slowSender{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *slowSender) SendBlockMsg(msg Msg) {
+	s.once.Do(func() { close(s.started) })
+	<-s.release
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.msgs = append(s.msgs, msg)
+}
+
+func (s *slowSender) SendMsg(key []byte, v []byte) {
+	s.SendBlockMsg(NewMsg(key, v))
+}
+
+func (s *slowSender) IsSubscribed(topic string) bool { return true }
+func (s *slowSender) IsOpenToggle() bool             { return true }
+func (s *slowSender) GetMode() []string              { return []string{"slow"} }
+func (s *slowSender) Close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.isClosed = true
+}
+
+func (s *slowSender) heights() []int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	heights := make([]int64, 0, len(s.msgs))
+	for _, msg := range s.msgs {
+		if msg.Key == CommitKey {
+			heights = append(heights, msg.Height)
+		}
+	}
+	return heights
+}
+
+func testBlock(height int64) []Msg {
+	return []Msg{
+		NewBlockMsg(height, 0, []byte("height_info"), []byte(`{"height":1}`)),
+		NewBlockMsg(height, 1, []byte(CommitKey), []byte(`{}`)),
+	}
+}
+
+func newTestAsyncSender(t *testing.T, sender *slowSender, conf AsyncConfig) *AsyncSender {
+	s, err := newAsyncSender(sender, conf, log.NewNopLogger(), NopMetrics())
+	require.Nil(t, err)
+	return s
+}
+
+func waitHeights(t *testing.T, sender *slowSender, count int) []int64 {
+	require.Eventually(t, func() bool {
+		return len(sender.heights()) == count
+	}, 5*time.Second, 10*time.Millisecond)
+	return sender.heights()
+}
+
+func TestAsyncSenderSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sender := newSlowSender()
+	s := newTestAsyncSender(t, sender, AsyncConfig{QueueSize: 2, SpillDir: dir, SpillMaxBytes: 1 << 20, Policy: PolicyHalt})
+	SendBlockMsgs(s, testBlock(1))
+	<-sender.started
+	for h := int64(2); h <= 10; h++ {
+		SendBlockMsgs(s, testBlock(h))
+	}
+	s.mtx.Lock()
+	// all the queued blocks are spilled, the memory queue caches the oldest ones
+	require.Equal(t, 2, len(s.queue))
+	require.Equal(t, 9, s.spill.blocks)
+	s.mtx.Unlock()
+
+	close(sender.release)
+	require.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, waitHeights(t, sender, 10))
+	s.Close()
+	require.True(t, sender.isClosed)
+	segments, err := listSpillSegments(dir)
+	require.Nil(t, err)
+	require.Empty(t, segments)
+}
+
+func TestAsyncSenderReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := AsyncConfig{QueueSize: 2, SpillDir: dir, SpillMaxBytes: 1 << 20, Policy: PolicyBlock}
+	sender := newSlowSender()
+	s := newTestAsyncSender(t, sender, conf)
+	SendBlockMsgs(s, testBlock(1))
+	<-sender.started
+	for h := int64(2); h <= 6; h++ {
+		SendBlockMsgs(s, testBlock(h))
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(sender.release)
+	}()
+	s.Close()
+	require.Equal(t, []int64{1}, sender.heights())
+
+	// a partial line left by a crash is dropped
+	segments, err := listSpillSegments(dir)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(segments))
+	file, err := os.OpenFile(segments[0].path, os.O_APPEND|os.O_WRONLY, 0640)
+	require.Nil(t, err)
+	_, err = file.WriteString(`[{"key":"height_info"`)
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+
+	sender = newSlowSender()
+	close(sender.release)
+	s = newTestAsyncSender(t, sender, conf)
+	SendBlockMsgs(s, testBlock(7))
+	require.Equal(t, []int64{2, 3, 4, 5, 6, 7}, waitHeights(t, sender, 6))
+	s.Close()
+}
+
+func TestAsyncSenderKilled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the blocks are spilled before SendBlock returns, the node is killed while block 1 is being sent
+	conf := AsyncConfig{QueueSize: 2, SpillDir: dir, SpillMaxBytes: 1 << 20, Policy: PolicyBlock}
+	killed := newSlowSender()
+	s := newTestAsyncSender(t, killed, conf)
+	SendBlockMsgs(s, testBlock(1))
+	<-killed.started
+	for h := int64(2); h <= 4; h++ {
+		SendBlockMsgs(s, testBlock(h))
+	}
+
+	sender := newSlowSender()
+	close(sender.release)
+	s = newTestAsyncSender(t, sender, conf)
+	require.Equal(t, []int64{2, 3, 4}, waitHeights(t, sender, 3))
+	s.Close()
+	close(killed.release)
+}
+
+func TestAsyncSenderKilledAfterSent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the node is killed while block 2 is being sent, the blocks before it are not sent again
+	conf := AsyncConfig{QueueSize: 2, SpillDir: dir, SpillMaxBytes: 1 << 20, Policy: PolicyBlock}
+	killed := &slowSender{started: make(chan struct{}), release: make(chan struct{}, 2)}
+	killed.release <- struct{}{}
+	killed.release <- struct{}{}
+	s := newTestAsyncSender(t, killed, conf)
+	for h := int64(1); h <= 5; h++ {
+		SendBlockMsgs(s, testBlock(h))
+	}
+	require.Eventually(t, func() bool {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		return s.lastSent == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sender := newSlowSender()
+	close(sender.release)
+	s = newTestAsyncSender(t, sender, conf)
+	require.Equal(t, []int64{2, 3, 4, 5}, waitHeights(t, sender, 4))
+	s.Close()
+	close(killed.release)
+}
+
+func TestAsyncSenderCloseTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := AsyncConfig{QueueSize: 2, SpillDir: dir, SpillMaxBytes: 1 << 20, Policy: PolicyBlock,
+		CloseTimeout: 50 * time.Millisecond}
+	sender := newSlowSender()
+	s := newTestAsyncSender(t, sender, conf)
+	SendBlockMsgs(s, testBlock(1))
+	<-sender.started
+	SendBlockMsgs(s, testBlock(2))
+	start := time.Now()
+	s.Close()
+	require.True(t, time.Since(start) < 5*time.Second)
+	require.True(t, sender.isClosed)
+	close(sender.release)
+
+	sender = newSlowSender()
+	close(sender.release)
+	s = newTestAsyncSender(t, sender, conf)
+	require.Equal(t, []int64{2}, waitHeights(t, sender, 1))
+	s.Close()
+}
+
+func TestSpillQueueSavedPos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	q, err := openSpillQueue(dir, 1<<20)
+	require.Nil(t, err)
+	sizes := make([]int64, 0, 4)
+	for h := int64(1); h <= 4; h++ {
+		size, err := q.push(testBlock(h))
+		require.Nil(t, err)
+		sizes = append(sizes, size)
+	}
+	msgs, _, err := q.pop()
+	require.Nil(t, err)
+	require.Equal(t, testBlock(1), msgs)
+	pos, err := q.skip(sizes[1])
+	require.Nil(t, err)
+	require.Equal(t, spillPos{Seq: 0, Offset: sizes[0] + sizes[1]}, pos)
+	msgs, _, err = q.pop()
+	require.Nil(t, err)
+	require.Equal(t, testBlock(3), msgs)
+	// the node is killed while block 3 is being sent
+	require.Nil(t, q.savePos(pos))
+	q.close()
+
+	// the blocks sent are not read again
+	q, err = openSpillQueue(dir, 1<<20)
+	require.Nil(t, err)
+	require.Equal(t, 2, q.blocks)
+	require.Equal(t, sizes[2]+sizes[3], q.bytes)
+	for h := int64(3); h <= 4; h++ {
+		msgs, pos, err = q.pop()
+		require.Nil(t, err)
+		require.Equal(t, testBlock(h), msgs)
+	}
+	require.Nil(t, q.savePos(pos))
+	segments, err := listSpillSegments(dir)
+	require.Nil(t, err)
+	require.Empty(t, segments)
+
+	// the seqs of the segments removed are not reused
+	q, err = openSpillQueue(dir, 1<<20)
+	require.Nil(t, err)
+	_, err = q.push(testBlock(5))
+	require.Nil(t, err)
+	q.close()
+	q, err = openSpillQueue(dir, 1<<20)
+	require.Nil(t, err)
+	require.Equal(t, 1, q.blocks)
+	require.Equal(t, int64(1), q.segments[0].seq)
+	q.close()
+}
+
+func TestAsyncSenderPolicy(t *testing.T) {
+	conf := AsyncConfig{QueueSize: 1, Policy: PolicyDrop}
+	sender := newSlowSender()
+	s := newTestAsyncSender(t, sender, conf)
+	SendBlockMsgs(s, testBlock(1))
+	<-sender.started
+	SendBlockMsgs(s, testBlock(2))
+	SendBlockMsgs(s, testBlock(3))
+	close(sender.release)
+	require.Equal(t, []int64{1, 2}, waitHeights(t, sender, 2))
+	s.Close()
+
+	conf.Policy = PolicyHalt
+	sender = newSlowSender()
+	s = newTestAsyncSender(t, sender, conf)
+	SendBlockMsgs(s, testBlock(1))
+	<-sender.started
+	SendBlockMsgs(s, testBlock(2))
+	require.Panics(t, func() { SendBlockMsgs(s, testBlock(3)) })
+	close(sender.release)
+	s.Close()
+
+	conf.Policy = PolicyBlock
+	sender = newSlowSender()
+	s = newTestAsyncSender(t, sender, conf)
+	SendBlockMsgs(s, testBlock(1))
+	<-sender.started
+	SendBlockMsgs(s, testBlock(2))
+	queued := make(chan struct{})
+	go func() {
+		SendBlockMsgs(s, testBlock(3))
+		close(queued)
+	}()
+	select {
+	case <-queued:
+		t.Fatal("block 3 is queued before the consumer catches up")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(sender.release)
+	<-queued
+	require.Equal(t, []int64{1, 2, 3}, waitHeights(t, sender, 3))
+	s.Close()
+
+	_, err := newAsyncSender(sender, AsyncConfig{QueueSize: 1, Policy: "wait"}, log.NewNopLogger(), NopMetrics())
+	require.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"fmt"
+	"sync"
+)
+
+const DefaultChanBuffer = 1024
+
+var (
+	chansMtx sync.Mutex
+	chans    = make(map[string]chan Msg)
+)
+
+// OpenChannel returns the channel of the name, which is shared by the channel sink and the in-process
+// consumer, whichever opens it first decides its buffer size
+func OpenChannel(name string, buffer int) chan Msg {
+	chansMtx.Lock()
+	defer chansMtx.Unlock()
+	if ch, ok := chans[name]; ok {
+		return ch
+	}
+	if buffer <= 0 {
+		buffer = DefaultChanBuffer
+	}
+	ch := make(chan Msg, buffer)
+	chans[name] = ch
+	return ch
+}
+
+// ChanSink sends the messages to an in-process consumer. It never blocks, the messages are dropped when the
+// buffer of the channel is full, so the consumer must keep up with the blocks.
+type ChanSink struct {
+	name string
+	ch   chan<- Msg
+}
+
+var _ Sink = ChanSink{}
+
+func NewChanSink(name string, buffer int) ChanSink {
+	return ChanSink{name: name, ch: OpenChannel(name, buffer)}
+}
+
+func (s ChanSink) Send(msg Msg) error {
+	select {
+	case s.ch <- msg:
+		return nil
+	default:
+		return fmt.Errorf("channel %s is full, %s dropped", s.name, msg.Key)
+	}
+}
+
+// Close keeps the channel open, the consumer may still be reading from it and a restarted app may reuse it
+func (s ChanSink) Close() error {
+	return nil
+}
+
+func (s ChanSink) String() string {
+	return TypeChannel + ":" + s.name
+}
@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileSink appends the messages to a file as JSON lines
+type FileSink struct {
+	mtx  sync.Mutex
+	path string
+	file *os.File
+}
+
+var _ Sink = (*FileSink)(nil)
+
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+func (s *FileSink) Send(msg Msg) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileSink) String() string {
+	return TypeFile + ":" + s.path
+}
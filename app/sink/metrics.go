@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"sync"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MetricsSubsystem is a subsystem shared by all metrics exposed by this
+	// package.
+	MetricsSubsystem = "pubmsg"
+
+	MetricsNamespace = "cetd"
+)
+
+// Metrics contains metrics exposed by this package.
+type Metrics struct {
+	// Number of blocks waiting to be sent, labeled by queue (memory or spill).
+	QueueDepth metrics.Gauge
+	// Size of the spill files in bytes.
+	SpillBytes metrics.Gauge
+	// Heights between the last queued block and the last sent one.
+	Lag metrics.Gauge
+	// Number of blocks dropped when the queue is full.
+	DroppedBlocks metrics.Counter
+}
+
+// PrometheusMetrics returns Metrics build using Prometheus client library.
+func PrometheusMetrics(namespace string) *Metrics {
+	return &Metrics{
+		QueueDepth: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "queue_depth",
+			Help:      "Number of blocks waiting to be sent by queue.",
+		}, []string{"queue"}),
+		SpillBytes: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "spill_bytes",
+			Help:      "Size of the spill files in bytes.",
+		}, []string{}),
+		Lag: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "lag",
+			Help:      "Heights between the last queued block and the last sent one.",
+		}, []string{}),
+		DroppedBlocks: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "dropped_blocks",
+			Help:      "Number of blocks dropped when the queue is full.",
+		}, []string{}),
+	}
+}
+
+// NopMetrics returns no-op Metrics.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		QueueDepth:    discard.NewGauge(),
+		SpillBytes:    discard.NewGauge(),
+		Lag:           discard.NewGauge(),
+		DroppedBlocks: discard.NewCounter(),
+	}
+}
+
+var (
+	metricsOnce   sync.Once
+	senderMetrics *Metrics
+)
+
+// getMetrics registers the prometheus metrics only once, since several apps may be created in a process
+func getMetrics() *Metrics {
+	metricsOnce.Do(func() {
+		senderMetrics = PrometheusMetrics(MetricsNamespace)
+	})
+	return senderMetrics
+}
@@ -0,0 +1,165 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultNatsSubject    = "coinex-dex"
+	NatsDialTimeout       = 3 * time.Second
+	NatsWriteTimeout      = time.Second
+	NatsReconnectInterval = time.Second
+)
+
+// NatsSink publishes the messages to a NATS server with its text protocol, the subject of a message is
+// "<subject>.<key>". It connects and reconnects to the server in the background, so Send never waits for
+// a dial. The messages sent while it is disconnected are dropped, and a stalled server holds up Send for
+// at most NatsWriteTimeout, after which the connection is dropped and the sink reconnects.
+type NatsSink struct {
+	address string
+	subject string
+
+	mtx          sync.Mutex
+	conn         net.Conn
+	reconnecting bool
+	closed       bool
+}
+
+var _ Sink = (*NatsSink)(nil)
+
+func NewNatsSink(address, subject string) *NatsSink {
+	if len(subject) == 0 {
+		subject = DefaultNatsSubject
+	}
+	s := &NatsSink{address: address, subject: subject}
+	s.mtx.Lock()
+	s.startReconnect()
+	s.mtx.Unlock()
+	return s
+}
+
+// startReconnect starts connecting in the background if it has not been started, s.mtx must be held
+func (s *NatsSink) startReconnect() {
+	if s.reconnecting || s.closed {
+		return
+	}
+	s.reconnecting = true
+	go s.reconnect()
+}
+
+func (s *NatsSink) reconnect() {
+	for {
+		conn, reader, err := s.dial()
+		s.mtx.Lock()
+		if s.closed {
+			s.reconnecting = false
+			s.mtx.Unlock()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		if err == nil {
+			s.conn = conn
+			s.reconnecting = false
+			s.mtx.Unlock()
+			go s.serve(conn, reader)
+			return
+		}
+		s.mtx.Unlock()
+		time.Sleep(NatsReconnectInterval)
+	}
+}
+
+func (s *NatsSink) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", s.address, NatsDialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(NatsDialTimeout))
+	info, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if !strings.HasPrefix(info, "INFO") {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected greeting from nats server: %s", strings.TrimSpace(info))
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	_ = conn.SetWriteDeadline(time.Now().Add(NatsWriteTimeout))
+	if _, err = conn.Write([]byte(`CONNECT {"verbose":false,"pedantic":false,"name":"cetd"}` + "\r\n")); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, reader, nil
+}
+
+// serve answers the PINGs of the server until the connection is closed, then reconnects if conn is still in use
+func (s *NatsSink) serve(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			s.mtx.Lock()
+			if s.conn == conn {
+				conn.Close()
+				s.conn = nil
+				s.startReconnect()
+			}
+			s.mtx.Unlock()
+			return
+		}
+		if strings.HasPrefix(line, "PING") {
+			s.mtx.Lock()
+			if s.conn == conn {
+				_, _ = conn.Write([]byte("PONG\r\n"))
+			}
+			s.mtx.Unlock()
+		}
+	}
+}
+
+func (s *NatsSink) Send(msg Msg) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.conn == nil {
+		s.startReconnect()
+		return fmt.Errorf("not connected to nats server %s, %s dropped", s.address, msg.Key)
+	}
+	data := fmt.Sprintf("PUB %s.%s %d\r\n%s\r\n", s.subject, msg.Key, len(payload), payload)
+	_ = s.conn.SetWriteDeadline(time.Now().Add(NatsWriteTimeout))
+	if _, err = s.conn.Write([]byte(data)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.startReconnect()
+	}
+	return err
+}
+
+func (s *NatsSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *NatsSink) String() string {
+	return TypeNats + ":" + s.address + "/" + s.subject
+}
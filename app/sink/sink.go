@@ -0,0 +1,269 @@
+package sink
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+
+	"github.com/cosmos/cosmos-sdk/client/flags"
+	"github.com/spf13/viper"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/coinexchain/cet-sdk/msgqueue"
+)
+
+const (
+	// FlagSinks is the key of the sinks in app.toml:
+	//
+	//	[[pubmsg-sink]]
+	//	type = "file"
+	//	path = "data/pubmsgs.jsonl"
+	//	keys = ["notify_tx", "height_info"]
+	//
+	//	[[pubmsg-sink]]
+	//	type = "nats"
+	//	address = "127.0.0.1:4222"
+	//	subject = "coinex-dex"
+	FlagSinks = "pubmsg-sink"
+
+	TypeFile    = "file"
+	TypeUnix    = "unix"
+	TypeNats    = "nats"
+	TypeChannel = "channel"
+
+	// CommitKey marks the end of the messages of a block, it is sent to every sink regardless of its filter
+	CommitKey = "commit"
+)
+
+// Msg is a pub message, which is written as one JSON line by the file, unix-socket and NATS sinks. The msgqueue
+// producer only gets its Key and Value, see ProducerValue.
+// The messages of a block are numbered by Seq from 0, and the commit marker is the last one.
+// Checksum covers Height, Seq, Key and Value, so that consumers can detect corrupted or partial blocks.
+type Msg struct {
+	Key      string          `json:"key"`
+	Value    json.RawMessage `json:"value"`
+	Height   int64           `json:"height"`
+	Seq      int64           `json:"seq"`
+	Checksum uint32          `json:"checksum"`
+}
+
+func NewMsg(key, value []byte) Msg {
+	if !json.Valid(value) {
+		value, _ = json.Marshal(string(value))
+	}
+	return Msg{Key: string(key), Value: value}
+}
+
+// NewBlockMsg returns the msg numbered seq in the block at height, with its checksum
+func NewBlockMsg(height, seq int64, key, value []byte) Msg {
+	msg := NewMsg(key, value)
+	msg.Height = height
+	msg.Seq = seq
+	msg.Checksum = msg.ComputeChecksum()
+	return msg
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func (msg Msg) ComputeChecksum() uint32 {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(msg.Height))
+	binary.BigEndian.PutUint64(buf[8:], uint64(msg.Seq))
+	crc := crc32.Update(0, castagnoli, buf[:])
+	crc = crc32.Update(crc, castagnoli, []byte(msg.Key))
+	return crc32.Update(crc, castagnoli, msg.Value)
+}
+
+// ProducerValue is the value sent to the msgqueue producer, which is the bare value as before the messages
+// were numbered, so that the trade-server and the Kafka consumers keep working. The commit marker is still {}.
+func (msg Msg) ProducerValue() []byte {
+	if msg.Key == CommitKey {
+		return []byte("{}")
+	}
+	return msg.Value
+}
+
+// CommitInfo is the value of the commit marker of a block sent to the sinks, Count is the number of messages
+// before it. The msgqueue producer gets {} as the value of the marker.
+type CommitInfo struct {
+	Height int64 `json:"height"`
+	Count  int64 `json:"count"`
+}
+
+// MsgSender is implemented by the senders which keep the height, seq and checksum of the messages
+type MsgSender interface {
+	SendBlockMsg(msg Msg)
+}
+
+// SendBlockMsgs sends the msgs with their heights, seqs and checksums, or only their keys and producer values
+// if sender only takes keys and values
+func SendBlockMsgs(sender msgqueue.MsgSender, msgs []Msg) {
+	if s, ok := sender.(BlockSender); ok {
+		s.SendBlock(msgs)
+		return
+	}
+	s, ok := sender.(MsgSender)
+	for _, msg := range msgs {
+		if ok {
+			s.SendBlockMsg(msg)
+		} else {
+			sender.SendMsg([]byte(msg.Key), msg.ProducerValue())
+		}
+	}
+}
+
+// Sink receives the pub messages of the app, in the order they are sent
+type Sink interface {
+	Send(msg Msg) error
+	Close() error
+	String() string
+}
+
+// Config selects one sink. Path is used by the file and unix sinks, Address and Subject by the NATS sink,
+// Name and Buffer by the channel sink. Only the messages with the Keys are sent to the sink, or all of them
+// if Keys is empty.
+type Config struct {
+	Type    string   `mapstructure:"type"`
+	Path    string   `mapstructure:"path"`
+	Address string   `mapstructure:"address"`
+	Subject string   `mapstructure:"subject"`
+	Name    string   `mapstructure:"name"`
+	Buffer  int      `mapstructure:"buffer"`
+	Keys    []string `mapstructure:"keys"`
+}
+
+// NewSink opens the sink of conf, relative paths are relative to rootDir
+func NewSink(conf Config, rootDir string) (Sink, error) {
+	switch conf.Type {
+	case TypeFile, TypeUnix:
+		if len(conf.Path) == 0 {
+			return nil, fmt.Errorf("path of %s sink is empty", conf.Type)
+		}
+		path := conf.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(rootDir, path)
+		}
+		if conf.Type == TypeFile {
+			return NewFileSink(path)
+		}
+		return NewUnixSink(path)
+	case TypeNats:
+		if len(conf.Address) == 0 {
+			return nil, fmt.Errorf("address of nats sink is empty")
+		}
+		return NewNatsSink(conf.Address, conf.Subject), nil
+	case TypeChannel:
+		if len(conf.Name) == 0 {
+			return nil, fmt.Errorf("name of channel sink is empty")
+		}
+		return NewChanSink(conf.Name, conf.Buffer), nil
+	}
+	return nil, fmt.Errorf("unknown sink type: %s", conf.Type)
+}
+
+// LoadSinks opens the sinks in app.toml, nothing is opened if any of them is invalid
+func LoadSinks() ([]Sink, error) {
+	var confs []Config
+	if err := viper.UnmarshalKey(FlagSinks, &confs); err != nil {
+		return nil, err
+	}
+
+	rootDir := viper.GetString(flags.FlagHome)
+	sinks := make([]Sink, 0, len(confs))
+	for _, conf := range confs {
+		s, err := NewSink(conf, rootDir)
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, NewFilteredSink(s, conf.Keys))
+	}
+	return sinks, nil
+}
+
+type filteredSink struct {
+	Sink
+	keys map[string]struct{}
+}
+
+// NewFilteredSink only sends the messages with the keys to s, and the commit markers
+func NewFilteredSink(s Sink, keys []string) Sink {
+	if len(keys) == 0 {
+		return s
+	}
+	f := filteredSink{Sink: s, keys: make(map[string]struct{}, len(keys))}
+	for _, key := range keys {
+		f.keys[key] = struct{}{}
+	}
+	return f
+}
+
+func (f filteredSink) Send(msg Msg) error {
+	if _, ok := f.keys[msg.Key]; !ok && msg.Key != CommitKey {
+		return nil
+	}
+	return f.Sink.Send(msg)
+}
+
+// Sender sends the pub messages to the msgqueue producer and the sinks. When there are sinks, the messages
+// of all modules are generated and the sinks pick theirs by keys.
+type Sender struct {
+	producer msgqueue.MsgSender
+	sinks    []Sink
+	logger   log.Logger
+}
+
+var _ msgqueue.MsgSender = Sender{}
+var _ MsgSender = Sender{}
+
+func NewSender(producer msgqueue.MsgSender, sinks []Sink, logger log.Logger) msgqueue.MsgSender {
+	if len(sinks) == 0 {
+		return producer
+	}
+	return Sender{producer: producer, sinks: sinks, logger: logger}
+}
+
+func (s Sender) SendMsg(key []byte, v []byte) {
+	s.SendBlockMsg(NewMsg(key, v))
+}
+
+// SendBlockMsg sends msg to the sinks, and its key and producer value to the msgqueue producer
+func (s Sender) SendBlockMsg(msg Msg) {
+	if s.producer.IsOpenToggle() {
+		s.producer.SendMsg([]byte(msg.Key), msg.ProducerValue())
+	}
+	for _, sink := range s.sinks {
+		if err := sink.Send(msg); err != nil {
+			s.logger.Error(fmt.Sprintf("send %s to %s failed: %s", msg.Key, sink.String(), err.Error()))
+		}
+	}
+}
+
+func (s Sender) IsSubscribed(topic string) bool {
+	return true
+}
+
+func (s Sender) IsOpenToggle() bool {
+	return true
+}
+
+func (s Sender) GetMode() []string {
+	modes := s.producer.GetMode()
+	for _, sink := range s.sinks {
+		modes = append(modes, sink.String())
+	}
+	return modes
+}
+
+func (s Sender) Close() {
+	s.producer.Close()
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			s.logger.Error(fmt.Sprintf("close %s failed: %s", sink.String(), err.Error()))
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/client/flags"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/coinexchain/cet-sdk/msgqueue"
+)
+
+func TestNewMsg(t *testing.T) {
+	msg := NewMsg([]byte("height_info"), []byte(`{"height":1}`))
+	bz, err := json.Marshal(msg)
+	require.Nil(t, err)
+	require.Equal(t, `{"key":"height_info","value":{"height":1},"height":0,"seq":0,"checksum":0}`, string(bz))
+
+	msg = NewMsg([]byte("raw"), []byte("not json"))
+	bz, err = json.Marshal(msg)
+	require.Nil(t, err)
+	require.Equal(t, `{"key":"raw","value":"not json","height":0,"seq":0,"checksum":0}`, string(bz))
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data", "pubmsgs.jsonl")
+	s, err := NewFileSink(path)
+	require.Nil(t, err)
+	require.Nil(t, s.Send(NewMsg([]byte("notify_tx"), []byte(`{"a":1}`))))
+	require.Nil(t, s.Send(NewMsg([]byte(CommitKey), []byte(`{}`))))
+	require.Nil(t, s.Close())
+
+	bz, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "{\"key\":\"notify_tx\",\"value\":{\"a\":1},\"height\":0,\"seq\":0,\"checksum\":0}\n{\"key\":\"commit\",\"value\":{},\"height\":0,\"seq\":0,\"checksum\":0}\n", string(bz))
+}
+
+func TestUnixSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pubmsgs.sock")
+	s, err := NewUnixSink(path)
+	require.Nil(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("unix", path)
+	require.Nil(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		return len(s.clients) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.Nil(t, s.Send(NewMsg([]byte("slash"), []byte(`{"b":2}`))))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.Nil(t, err)
+	require.Equal(t, "{\"key\":\"slash\",\"value\":{\"b\":2},\"height\":0,\"seq\":0,\"checksum\":0}\n", line)
+}
+
+func TestNatsSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("INFO {}\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "PUB") {
+				payload, _ := reader.ReadString('\n')
+				received <- line + payload
+				_, _ = conn.Write([]byte("PING\r\n"))
+			} else {
+				received <- line
+			}
+		}
+	}()
+
+	s := NewNatsSink(listener.Addr().String(), "")
+	defer s.Close()
+	require.True(t, strings.HasPrefix(<-received, "CONNECT"))
+	require.Eventually(t, func() bool {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		return s.conn != nil
+	}, time.Second, 10*time.Millisecond)
+	require.Nil(t, s.Send(NewMsg([]byte("notify_tx"), []byte(`{}`))))
+
+	payload := `{"key":"notify_tx","value":{},"height":0,"seq":0,"checksum":0}`
+	require.Equal(t, "PUB coinex-dex.notify_tx 62\r\n"+payload+"\r\n", <-received)
+	require.Equal(t, "PONG\r\n", <-received)
+}
+
+func TestNatsSinkDisconnected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	s := NewNatsSink(address, "")
+	start := time.Now()
+	require.NotNil(t, s.Send(NewMsg([]byte("notify_tx"), []byte(`{}`))))
+	require.True(t, time.Since(start) < NatsDialTimeout)
+	require.Nil(t, s.Close())
+	require.NotNil(t, s.Send(NewMsg([]byte("notify_tx"), []byte(`{}`))))
+}
+
+func TestChanSink(t *testing.T) {
+	s := NewChanSink("test_chan_sink", 1)
+	require.Nil(t, s.Send(NewMsg([]byte("notify_tx"), []byte(`{}`))))
+	require.NotNil(t, s.Send(NewMsg([]byte("notify_tx"), []byte(`{}`))))
+	require.Equal(t, "notify_tx", (<-OpenChannel("test_chan_sink", 0)).Key)
+	require.Nil(t, s.Send(NewMsg([]byte(CommitKey), []byte(`{}`))))
+}
+
+func TestLoadSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer viper.Reset()
+
+	viper.Set(flags.FlagHome, dir)
+	viper.Set(FlagSinks, []map[string]interface{}{
+		{"type": TypeFile, "path": "data/pubmsgs.jsonl", "keys": []string{"notify_tx"}},
+		{"type": TypeChannel, "name": "test_load_sinks", "buffer": 10},
+	})
+	sinks, err := LoadSinks()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(sinks))
+
+	sender := NewSender(msgqueue.NewProducerFromConfig(nil, "", false, nil), sinks, log.NewNopLogger())
+	require.True(t, sender.IsOpenToggle())
+	require.True(t, sender.IsSubscribed("authx"))
+	require.Equal(t, []string{TypeFile + ":" + filepath.Join(dir, "data/pubmsgs.jsonl"), "channel:test_load_sinks"},
+		sender.GetMode())
+
+	sender.SendMsg([]byte("notify_tx"), []byte(`{"tx":1}`))
+	sender.SendMsg([]byte("height_info"), []byte(`{"height":1}`))
+	sender.SendMsg([]byte(CommitKey), []byte(`{}`))
+	sender.Close()
+
+	bz, err := ioutil.ReadFile(filepath.Join(dir, "data/pubmsgs.jsonl"))
+	require.Nil(t, err)
+	require.Equal(t, "{\"key\":\"notify_tx\",\"value\":{\"tx\":1},\"height\":0,\"seq\":0,\"checksum\":0}\n{\"key\":\"commit\",\"value\":{},\"height\":0,\"seq\":0,\"checksum\":0}\n", string(bz))
+
+	ch := OpenChannel("test_load_sinks", 0)
+	require.Equal(t, 3, len(ch))
+	require.Equal(t, "notify_tx", (<-ch).Key)
+	require.Equal(t, "height_info", (<-ch).Key)
+	require.Equal(t, CommitKey, (<-ch).Key)
+
+	viper.Set(FlagSinks, []map[string]interface{}{
+		{"type": TypeChannel, "name": "test_load_sinks"},
+		{"type": "kafka"},
+	})
+	_, err = LoadSinks()
+	require.NotNil(t, err)
+	viper.Set(FlagSinks, []map[string]interface{}{{"type": TypeNats}})
+	_, err = LoadSinks()
+	require.NotNil(t, err)
+}
+
+func TestNewSenderWithoutSinks(t *testing.T) {
+	producer := msgqueue.NewProducerFromConfig(nil, "", false, nil)
+	require.Equal(t, producer, NewSender(producer, nil, log.NewNopLogger()))
+}
+
+// kvProducer records the keys and values like a msgqueue producer
+type kvProducer struct {
+	keys, values []string
+}
+
+func (p *kvProducer) SendMsg(key []byte, v []byte) {
+	p.keys = append(p.keys, string(key))
+	p.values = append(p.values, string(v))
+}
+func (p *kvProducer) IsSubscribed(topic string) bool { return true }
+func (p *kvProducer) IsOpenToggle() bool             { return true }
+func (p *kvProducer) GetMode() []string              { return []string{"kv"} }
+func (p *kvProducer) Close()                         {}
+
+func TestSendBlockMsgsToProducer(t *testing.T) {
+	commit, _ := json.Marshal(CommitInfo{Height: 7, Count: 1})
+	msgs := []Msg{
+		NewBlockMsg(7, 0, []byte("notify_tx"), []byte(`{"tx":1}`)),
+		NewBlockMsg(7, 1, []byte(CommitKey), commit),
+	}
+	expected := []string{`{"tx":1}`, `{}`}
+
+	producer := &kvProducer{}
+	SendBlockMsgs(NewSender(producer, nil, log.NewNopLogger()), msgs)
+	require.Equal(t, []string{"notify_tx", CommitKey}, producer.keys)
+	require.Equal(t, expected, producer.values)
+
+	producer = &kvProducer{}
+	sender := NewSender(producer, []Sink{NewChanSink("test_send_block_msgs", 10)}, log.NewNopLogger())
+	SendBlockMsgs(sender, msgs)
+	require.Equal(t, []string{"notify_tx", CommitKey}, producer.keys)
+	require.Equal(t, expected, producer.values)
+	require.Equal(t, msgs[0], <-OpenChannel("test_send_block_msgs", 0))
+}
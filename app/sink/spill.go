@@ -0,0 +1,354 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SpillSegmentSize is the size of a spill file, after which the next block starts a new file
+	SpillSegmentSize = 16 * 1024 * 1024
+
+	spillSegmentPrefix = "spill-"
+	spillSegmentSuffix = ".jsonl"
+	spillOffsetFile    = "offset.json"
+)
+
+var errSpillFull = errors.New("pubmsg spill queue is full")
+
+// spillQueue keeps the queued blocks, one JSON line of messages per block, in segment files numbered in the
+// order of their blocks. The blocks are read back in the order they are pushed, and a segment is removed once
+// all its blocks are read. The position after the last block sent is saved in the offset file, so that the
+// next run starts after it.
+type spillQueue struct {
+	dir      string
+	maxBytes int64
+
+	segments   []spillSegment // oldest first, the last one is being written
+	writer     *os.File
+	reader     *bufio.Reader
+	readFile   *os.File
+	readOffset int64 // offset of the oldest block not read yet in the oldest segment
+	nextSeq    int64 // seqs are not reused, so that a saved position never points into a newer segment
+
+	bytes  int64 // size of the blocks not read yet
+	blocks int   // number of the blocks not read yet
+}
+
+// spillPos is the position after a block in the spill files
+type spillPos struct {
+	Seq    int64 `json:"seq"`
+	Offset int64 `json:"offset"`
+}
+
+type spillSegment struct {
+	path string
+	seq  int64
+	size int64
+}
+
+// openSpillQueue loads the blocks left in dir by the last run after the saved position, which are read before
+// the new ones. The line being written when the node crashed is dropped. Spilling is disabled if maxBytes is
+// not positive.
+func openSpillQueue(dir string, maxBytes int64) (*spillQueue, error) {
+	q := &spillQueue{dir: dir, maxBytes: maxBytes}
+	if maxBytes <= 0 {
+		return q, nil
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	pos, err := loadSpillPos(dir)
+	if err != nil {
+		return nil, err
+	}
+	q.nextSeq = pos.Seq + 1
+	segments, err := listSpillSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if segment.seq >= q.nextSeq {
+			q.nextSeq = segment.seq + 1
+		}
+		var from int64
+		if segment.seq == pos.Seq {
+			from = pos.Offset
+		}
+		blocks, size, err := scanSpillSegment(segment.path, from)
+		if err != nil {
+			return nil, err
+		}
+		if segment.seq < pos.Seq || blocks == 0 {
+			// all the blocks in the segment have been sent
+			if err = os.Remove(segment.path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err = os.Truncate(segment.path, size); err != nil {
+			return nil, err
+		}
+		segment.size = size
+		if len(q.segments) == 0 {
+			q.readOffset = from
+		}
+		q.segments = append(q.segments, segment)
+		q.blocks += blocks
+		q.bytes += size - from
+	}
+	return q, nil
+}
+
+// push appends a block to the queue and syncs it to disk, errSpillFull is returned if it would exceed
+// maxBytes. It returns the size of the line of the block.
+func (q *spillQueue) push(msgs []Msg) (int64, error) {
+	line, err := json.Marshal(msgs)
+	if err != nil {
+		return 0, err
+	}
+	line = append(line, '\n')
+	if q.bytes+int64(len(line)) > q.maxBytes {
+		return 0, errSpillFull
+	}
+	if q.writer == nil || q.segments[len(q.segments)-1].size >= SpillSegmentSize {
+		if err = q.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	segment := &q.segments[len(q.segments)-1]
+	_, err = q.writer.Write(line)
+	if err == nil {
+		err = q.writer.Sync()
+	}
+	if err != nil {
+		// drop the torn line, so that the blocks pushed later can be read
+		if terr := q.writer.Truncate(segment.size); terr != nil {
+			q.writer.Close()
+			q.writer = nil
+		}
+		return 0, err
+	}
+	segment.size += int64(len(line))
+	q.bytes += int64(len(line))
+	q.blocks++
+	return int64(len(line)), nil
+}
+
+func (q *spillQueue) rotate() error {
+	if q.writer != nil {
+		if err := q.writer.Close(); err != nil {
+			return err
+		}
+	}
+	segment := spillSegment{path: spillSegmentPath(q.dir, q.nextSeq), seq: q.nextSeq}
+	file, err := os.OpenFile(segment.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	q.nextSeq++
+	q.writer = file
+	q.segments = append(q.segments, segment)
+	return nil
+}
+
+// pop reads the oldest block in the queue, which must not be empty, and returns the position after it
+func (q *spillQueue) pop() ([]Msg, spillPos, error) {
+	line, pos, err := q.next()
+	if err != nil {
+		return nil, pos, err
+	}
+	var msgs []Msg
+	if err = json.Unmarshal(line, &msgs); err != nil {
+		return nil, pos, fmt.Errorf("invalid block in %s: %s", q.dir, err.Error())
+	}
+	return msgs, pos, nil
+}
+
+// skip drops the oldest block in the queue without reading it, size is the size of its line returned by push
+func (q *spillQueue) skip(size int64) (spillPos, error) {
+	q.closeReader()
+	if err := q.skipReadSegments(); err != nil {
+		return spillPos{}, err
+	}
+	q.readOffset += size
+	return q.advance(size)
+}
+
+// next reads the line of the oldest block and removes it from the queue
+func (q *spillQueue) next() ([]byte, spillPos, error) {
+	if err := q.skipReadSegments(); err != nil {
+		return nil, spillPos{}, err
+	}
+	if q.reader == nil {
+		file, err := os.Open(q.segments[0].path)
+		if err != nil {
+			return nil, spillPos{}, err
+		}
+		if _, err = file.Seek(q.readOffset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, spillPos{}, err
+		}
+		q.readFile = file
+		q.reader = bufio.NewReader(file)
+	}
+	line, err := q.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, spillPos{}, err
+	}
+	q.readOffset += int64(len(line))
+	pos, err := q.advance(int64(len(line)))
+	return line, pos, err
+}
+
+// skipReadSegments removes the oldest segments whose blocks are all read
+func (q *spillQueue) skipReadSegments() error {
+	for len(q.segments) > 1 && q.readOffset >= q.segments[0].size {
+		if err := q.removeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance removes a block of size from the queue, and returns the position after it
+func (q *spillQueue) advance(size int64) (spillPos, error) {
+	pos := spillPos{Seq: q.segments[0].seq, Offset: q.readOffset}
+	q.bytes -= size
+	q.blocks--
+	if q.blocks == 0 {
+		return pos, q.reset()
+	}
+	return pos, nil
+}
+
+// savePos saves the position after the last block sent, the blocks before it are not read by the next run
+func (q *spillQueue) savePos(pos spillPos) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.dir, spillOffsetFile)
+	if err = ioutil.WriteFile(path+".tmp", data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func loadSpillPos(dir string) (spillPos, error) {
+	pos := spillPos{Seq: -1}
+	data, err := ioutil.ReadFile(filepath.Join(dir, spillOffsetFile))
+	if os.IsNotExist(err) {
+		return pos, nil
+	} else if err != nil {
+		return pos, err
+	}
+	if err = json.Unmarshal(data, &pos); err != nil {
+		return pos, fmt.Errorf("invalid %s in %s: %s", spillOffsetFile, dir, err.Error())
+	}
+	return pos, nil
+}
+
+func (q *spillQueue) removeOldest() error {
+	q.closeReader()
+	if err := os.Remove(q.segments[0].path); err != nil {
+		return err
+	}
+	q.segments = q.segments[1:]
+	q.readOffset = 0
+	return nil
+}
+
+// reset removes all the segments, it is called when the queue is empty or its blocks can not be read
+func (q *spillQueue) reset() error {
+	q.close()
+	for _, segment := range q.segments {
+		if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	q.segments = nil
+	q.readOffset = 0
+	q.bytes = 0
+	q.blocks = 0
+	return nil
+}
+
+func (q *spillQueue) closeReader() {
+	if q.readFile != nil {
+		q.readFile.Close()
+	}
+	q.readFile, q.reader = nil, nil
+}
+
+func (q *spillQueue) close() {
+	q.closeReader()
+	if q.writer != nil {
+		q.writer.Close()
+	}
+	q.writer = nil
+}
+
+// scanSpillSegment returns the number of the complete blocks in the segment from the offset, and the size of
+// the segment up to the last of them
+func scanSpillSegment(path string, offset int64) (blocks int, size int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return blocks, size, nil
+		} else if err != nil {
+			return 0, 0, err
+		}
+		var msgs []Msg
+		if json.Unmarshal(line, &msgs) != nil {
+			return blocks, size, nil
+		}
+		if size >= offset {
+			blocks++
+		}
+		size += int64(len(line))
+	}
+}
+
+func spillSegmentPath(dir string, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%012d%s", spillSegmentPrefix, seq, spillSegmentSuffix))
+}
+
+func listSpillSegments(dir string) ([]spillSegment, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]spillSegment, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, spillSegmentPrefix) || !strings.HasSuffix(name, spillSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, spillSegmentPrefix), spillSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, spillSegment{path: filepath.Join(dir, name), seq: seq})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].seq < segments[j].seq
+	})
+	return segments, nil
+}
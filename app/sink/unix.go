@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// UnixWriteTimeout is how long a message may take to be written to a client, the slower ones are dropped
+const UnixWriteTimeout = time.Second
+
+// UnixSink listens on a unix socket and writes the messages as JSON lines to every connected client.
+// A client only receives the messages sent after it connects.
+type UnixSink struct {
+	path     string
+	listener net.Listener
+
+	mtx     sync.Mutex
+	clients map[net.Conn]struct{}
+}
+
+var _ Sink = (*UnixSink)(nil)
+
+func NewUnixSink(path string) (*UnixSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &UnixSink{path: path, listener: listener, clients: make(map[net.Conn]struct{})}
+	go s.accept()
+	return s, nil
+}
+
+func (s *UnixSink) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mtx.Lock()
+		s.clients[conn] = struct{}{}
+		s.mtx.Unlock()
+	}
+}
+
+func (s *UnixSink) Send(msg Msg) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for conn := range s.clients {
+		_ = conn.SetWriteDeadline(time.Now().Add(UnixWriteTimeout))
+		if _, err := conn.Write(line); err != nil {
+			conn.Close()
+			delete(s.clients, conn)
+		}
+	}
+	return nil
+}
+
+func (s *UnixSink) Close() error {
+	err := s.listener.Close()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for conn := range s.clients {
+		conn.Close()
+	}
+	s.clients = make(map[net.Conn]struct{})
+	return err
+}
+
+func (s *UnixSink) String() string {
+	return TypeUnix + ":" + s.path
+}
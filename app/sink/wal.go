@@ -0,0 +1,323 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos/cosmos-sdk/client/flags"
+	"github.com/spf13/viper"
+)
+
+const (
+	// FlagWALDir and FlagWALKeepHeights are the keys of the write-ahead log in app.toml:
+	//
+	//	[pubmsg-wal]
+	//	dir = "data/pubmsg-wal"
+	//	keep-heights = 0
+	//
+	// The messages of the heights older than the latest keep-heights ones may be pruned, 0 to keep all.
+	FlagWALDir         = "pubmsg-wal.dir"
+	FlagWALKeepHeights = "pubmsg-wal.keep-heights"
+	DefaultWALDir      = "data/pubmsg-wal"
+
+	// WALSegmentSize is the size of a segment file, after which the next height starts a new segment
+	WALSegmentSize = 64 * 1024 * 1024
+
+	walSegmentPrefix = "wal-"
+	walSegmentSuffix = ".jsonl"
+)
+
+// WALDirFromConfig returns the dir of the log in app.toml, which is relative to the home of the node
+func WALDirFromConfig() string {
+	dir := viper.GetString(FlagWALDir)
+	if len(dir) == 0 {
+		dir = DefaultWALDir
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(viper.GetString(flags.FlagHome), dir)
+	}
+	return dir
+}
+
+// WAL keeps the pub messages of every height before they are sent, in segment files named by the first
+// height in them. The messages of a height are only complete when its commit marker is written.
+type WAL struct {
+	dir         string
+	keepHeights int64
+
+	file       *os.File
+	size       int64
+	lastHeight int64
+	broken     error
+}
+
+// OpenWAL opens the log in dir and drops the incomplete height at its end, which was being written when the
+// node crashed. That height will be written again when the block is executed again.
+func OpenWAL(dir string, keepHeights int64) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	w := &WAL{dir: dir, keepHeights: keepHeights}
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return w, nil
+	}
+
+	last := segments[len(segments)-1]
+	lastHeight, size, err := scanWALSegment(last.path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Truncate(last.path, size); err != nil {
+		return nil, err
+	}
+	if w.file, err = os.OpenFile(last.path, os.O_APPEND|os.O_WRONLY, 0640); err != nil {
+		return nil, err
+	}
+	w.size = size
+	w.lastHeight = lastHeight
+	if lastHeight == 0 && len(segments) > 1 {
+		// the last segment is empty, its previous one has the last height
+		if w.lastHeight, _, err = scanWALSegment(segments[len(segments)-2].path); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// LastHeight returns the last height whose messages are complete in the log
+func (w *WAL) LastHeight() int64 {
+	return w.lastHeight
+}
+
+// Write appends the messages of a height, the last of which must be the commit marker, and syncs them to
+// disk. A height which is already in the log is not written again. If the messages can not be written, the
+// segment is truncated to where they started, so that the torn height does not hide the later ones.
+func (w *WAL) Write(height int64, msgs []Msg) error {
+	if w.broken != nil {
+		return w.broken
+	}
+	if height <= w.lastHeight {
+		return nil
+	}
+	if len(msgs) == 0 || msgs[len(msgs)-1].Key != CommitKey {
+		return fmt.Errorf("messages of height %d do not end with the commit marker", height)
+	}
+	if w.file == nil || w.size >= WALSegmentSize {
+		if err := w.rotate(height); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		line, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	n, err := writeWALFile(w.file, buf.Bytes())
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			if terr := w.file.Truncate(w.size); terr != nil {
+				// the log can not be appended after the torn height, stop writing it
+				w.broken = fmt.Errorf("truncate torn height %d of WAL failed: %s", height, terr.Error())
+				return w.broken
+			}
+		}
+		return err
+	}
+	w.size += int64(n)
+	w.lastHeight = height
+	return nil
+}
+
+// writeWALFile writes the messages of a height to the segment, tests replace it to tear the write
+var writeWALFile = func(file *os.File, bz []byte) (int, error) {
+	return file.Write(bz)
+}
+
+func (w *WAL) rotate(height int64) error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(walSegmentPath(w.dir, height), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.size = 0
+	return w.prune(height)
+}
+
+// prune removes the segments whose heights are all older than the ones to keep
+func (w *WAL) prune(height int64) error {
+	if w.keepHeights <= 0 {
+		return nil
+	}
+	segments, err := listWALSegments(w.dir)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i+1].startHeight > height-w.keepHeights {
+			break
+		}
+		if err = os.Remove(segments[i].path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WAL) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// ReplayWAL calls fn with the messages of the complete heights in [fromHeight, toHeight] in the log of dir,
+// toHeight is not limited if it is not positive. The checksums of the messages are verified.
+func ReplayWAL(dir string, fromHeight, toHeight int64, fn func(msg Msg) error) error {
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		return err
+	}
+	for i, segment := range segments {
+		if toHeight > 0 && segment.startHeight > toHeight {
+			break
+		}
+		if i+1 < len(segments) && segments[i+1].startHeight <= fromHeight {
+			continue
+		}
+		if err = replayWALSegment(segment.path, fromHeight, toHeight, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replayWALSegment(path string, fromHeight, toHeight int64, fn func(msg Msg) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var block []Msg
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var msg Msg
+		if err = json.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("invalid message in %s: %s", path, err.Error())
+		}
+		if msg.Checksum != msg.ComputeChecksum() {
+			return fmt.Errorf("checksum mismatch of message %d at height %d in %s", msg.Seq, msg.Height, path)
+		}
+		if msg.Height < fromHeight || (toHeight > 0 && msg.Height > toHeight) {
+			continue
+		}
+		if len(block) != 0 && block[0].Height != msg.Height {
+			block = block[:0] // drop the incomplete height
+		}
+		block = append(block, msg)
+		if msg.Key != CommitKey {
+			continue
+		}
+		for _, m := range block {
+			if err = fn(m); err != nil {
+				return err
+			}
+		}
+		block = block[:0]
+	}
+}
+
+// scanWALSegment returns the last complete height in the segment, and the size of the segment up to it
+func scanWALSegment(path string) (lastHeight int64, size int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var offset int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return lastHeight, size, nil
+		} else if err != nil {
+			return 0, 0, err
+		}
+		offset += int64(len(line))
+
+		var msg Msg
+		if json.Unmarshal(line, &msg) != nil || msg.Checksum != msg.ComputeChecksum() {
+			return lastHeight, size, nil
+		}
+		if msg.Key == CommitKey {
+			lastHeight = msg.Height
+			size = offset
+		}
+	}
+}
+
+type walSegment struct {
+	path        string
+	startHeight int64
+}
+
+func walSegmentPath(dir string, height int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%012d%s", walSegmentPrefix, height, walSegmentSuffix))
+}
+
+func listWALSegments(dir string) ([]walSegment, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]walSegment, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, walSegmentPrefix) || !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		height, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, walSegmentPrefix), walSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, walSegment{path: filepath.Join(dir, name), startHeight: height})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].startHeight < segments[j].startHeight
+	})
+	return segments, nil
+}
@@ -0,0 +1,173 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func blockMsgs(height int64, keys ...string) []Msg {
+	msgs := make([]Msg, 0, len(keys)+1)
+	for i, key := range keys {
+		msgs = append(msgs, NewBlockMsg(height, int64(i), []byte(key), []byte(`{"height":1}`)))
+	}
+	info, _ := json.Marshal(CommitInfo{Height: height, Count: int64(len(keys))})
+	return append(msgs, NewBlockMsg(height, int64(len(keys)), []byte(CommitKey), info))
+}
+
+func replayAll(t *testing.T, dir string, from, to int64) []Msg {
+	var msgs []Msg
+	err := ReplayWAL(dir, from, to, func(msg Msg) error {
+		msgs = append(msgs, msg)
+		return nil
+	})
+	require.Nil(t, err)
+	return msgs
+}
+
+func TestWALWriteAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenWAL(dir, 0)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), w.LastHeight())
+	require.Nil(t, w.Write(1, blockMsgs(1, "height_info", "notify_tx")))
+	require.Nil(t, w.Write(2, blockMsgs(2, "height_info")))
+	// the heights already in the log are skipped
+	require.Nil(t, w.Write(2, blockMsgs(2, "height_info", "notify_tx")))
+	require.NotNil(t, w.Write(3, blockMsgs(3, "height_info")[:1]))
+	require.Equal(t, int64(2), w.LastHeight())
+	require.Nil(t, w.Close())
+
+	msgs := replayAll(t, dir, 1, 0)
+	require.Equal(t, 5, len(msgs))
+	require.Equal(t, blockMsgs(1, "height_info", "notify_tx"), msgs[:3])
+	require.Equal(t, blockMsgs(2, "height_info"), msgs[3:])
+
+	msgs = replayAll(t, dir, 2, 2)
+	require.Equal(t, blockMsgs(2, "height_info"), msgs)
+	require.Equal(t, 0, len(replayAll(t, dir, 3, 0)))
+
+	w, err = OpenWAL(dir, 0)
+	require.Nil(t, err)
+	require.Equal(t, int64(2), w.LastHeight())
+	require.Nil(t, w.Close())
+}
+
+func TestWALTruncateIncompleteHeight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenWAL(dir, 0)
+	require.Nil(t, err)
+	require.Nil(t, w.Write(1, blockMsgs(1, "height_info")))
+	require.Nil(t, w.Close())
+
+	// a crash in the middle of height 2
+	path := walSegmentPath(dir, 1)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0640)
+	require.Nil(t, err)
+	line, _ := json.Marshal(NewBlockMsg(2, 0, []byte("height_info"), []byte(`{}`)))
+	_, err = file.Write(append(line, []byte("\n{\"key\":\"not")...))
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+	require.Equal(t, blockMsgs(1, "height_info"), replayAll(t, dir, 1, 0))
+
+	w, err = OpenWAL(dir, 0)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), w.LastHeight())
+	require.Nil(t, w.Write(2, blockMsgs(2, "notify_tx")))
+	require.Nil(t, w.Close())
+
+	msgs := replayAll(t, dir, 1, 0)
+	require.Equal(t, append(blockMsgs(1, "height_info"), blockMsgs(2, "notify_tx")...), msgs)
+}
+
+func TestWALTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenWAL(dir, 0)
+	require.Nil(t, err)
+	require.Nil(t, w.Write(1, blockMsgs(1, "height_info")))
+
+	// the disk is full in the middle of height 2
+	writeWALFile = func(file *os.File, bz []byte) (int, error) {
+		n, _ := file.Write(bz[:len(bz)/2])
+		return n, errors.New("no space left on device")
+	}
+	err = w.Write(2, blockMsgs(2, "height_info", "notify_tx"))
+	writeWALFile = func(file *os.File, bz []byte) (int, error) {
+		return file.Write(bz)
+	}
+	require.NotNil(t, err)
+	require.Equal(t, int64(1), w.LastHeight())
+
+	require.Nil(t, w.Write(2, blockMsgs(2, "height_info", "notify_tx")))
+	require.Nil(t, w.Write(3, blockMsgs(3, "height_info")))
+	require.Nil(t, w.Close())
+
+	expected := append(blockMsgs(1, "height_info"), blockMsgs(2, "height_info", "notify_tx")...)
+	expected = append(expected, blockMsgs(3, "height_info")...)
+	require.Equal(t, expected, replayAll(t, dir, 1, 0))
+
+	w, err = OpenWAL(dir, 0)
+	require.Nil(t, err)
+	require.Equal(t, int64(3), w.LastHeight())
+	require.Nil(t, w.Close())
+}
+
+func TestWALChecksumMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	msgs := blockMsgs(1, "height_info")
+	msgs[0].Value = []byte(`{"height":2}`)
+	w, err := OpenWAL(dir, 0)
+	require.Nil(t, err)
+	require.Nil(t, w.Write(1, msgs))
+	require.Nil(t, w.Close())
+
+	err = ReplayWAL(dir, 1, 0, func(msg Msg) error { return nil })
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestWALRotateAndPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenWAL(dir, 2)
+	require.Nil(t, err)
+	for h := int64(1); h <= 5; h++ {
+		// every height starts a new segment
+		w.size = WALSegmentSize
+		require.Nil(t, w.Write(h, blockMsgs(h, "height_info")))
+	}
+	require.Nil(t, w.Close())
+
+	segments, err := listWALSegments(dir)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(segments))
+	require.Equal(t, int64(3), segments[0].startHeight)
+
+	msgs := replayAll(t, dir, 1, 0)
+	require.Equal(t, 6, len(msgs))
+	require.Equal(t, int64(3), msgs[0].Height)
+	require.Equal(t, blockMsgs(4, "height_info"), replayAll(t, dir, 4, 4))
+
+	w, err = OpenWAL(dir, 2)
+	require.Nil(t, err)
+	require.Equal(t, int64(5), w.LastHeight())
+	require.Nil(t, w.Close())
+}
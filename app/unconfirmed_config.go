@@ -0,0 +1,133 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// The keys of the unconfirmed-tx limit in app.toml:
+//
+//	[unconfirmed-tx]
+//	# seconds before an unconfirmed tx is forgotten, 0 to disable the limit
+//	limit-time = 60
+//	# seconds between two sweeps of the expired txs
+//	sweep-period = 900
+//	# how many unconfirmed txs an account can have
+//	quota = 1
+//	# accounts with their own quotas, like "coinex1...:10"
+//	quota-whitelist = []
+//	# accounts which are not limited at all
+//	exempt-addresses = []
+const (
+	FlagUnconfirmedLimitTime       = "unconfirmed-tx.limit-time"
+	FlagUnconfirmedSweepPeriod     = "unconfirmed-tx.sweep-period"
+	FlagUnconfirmedQuota           = "unconfirmed-tx.quota"
+	FlagUnconfirmedQuotaWhitelist  = "unconfirmed-tx.quota-whitelist"
+	FlagUnconfirmedExemptAddresses = "unconfirmed-tx.exempt-addresses"
+
+	// EnvUnconfirmedLimitTime is the deprecated way to set limit-time, it is still read when limit-time is
+	// not in app.toml, and a negative value disables the limit as before
+	EnvUnconfirmedLimitTime = "COINEX_UNCONFIRMED_TX_LIMIT_TIME"
+)
+
+type UnconfirmedTxConfig struct {
+	LimitTime   int64
+	SweepPeriod int64
+	Quota       int
+	QuotaOfAcc  map[string]int
+	Exempted    map[string]struct{}
+}
+
+func DefaultUnconfirmedTxConfig() UnconfirmedTxConfig {
+	return UnconfirmedTxConfig{
+		LimitTime:   DefaultLimitTime,
+		SweepPeriod: SweepPeriod,
+		Quota:       DefaultTxQuota,
+		QuotaOfAcc:  make(map[string]int),
+		Exempted:    make(map[string]struct{}),
+	}
+}
+
+// LoadUnconfirmedTxConfig reads the [unconfirmed-tx] section of app.toml, the unset keys keep their default values
+func LoadUnconfirmedTxConfig() (UnconfirmedTxConfig, error) {
+	conf := DefaultUnconfirmedTxConfig()
+	var err error
+	if env, ok := os.LookupEnv(EnvUnconfirmedLimitTime); ok && !viper.IsSet(FlagUnconfirmedLimitTime) {
+		if conf.LimitTime, err = strconv.ParseInt(strings.TrimSpace(env), 10, 64); err != nil {
+			return conf, fmt.Errorf("invalid %s: %s", EnvUnconfirmedLimitTime, env)
+		}
+		if conf.LimitTime < 0 {
+			conf.LimitTime = 0
+		}
+	} else if conf.LimitTime, err = getInt64Config(FlagUnconfirmedLimitTime, conf.LimitTime); err != nil {
+		return conf, err
+	}
+	if conf.LimitTime < 0 {
+		return conf, fmt.Errorf("%s can not be negative", FlagUnconfirmedLimitTime)
+	}
+	if conf.SweepPeriod, err = getInt64Config(FlagUnconfirmedSweepPeriod, conf.SweepPeriod); err != nil {
+		return conf, err
+	}
+	if conf.SweepPeriod <= 0 {
+		return conf, fmt.Errorf("%s must be positive", FlagUnconfirmedSweepPeriod)
+	}
+	quota, err := getInt64Config(FlagUnconfirmedQuota, int64(conf.Quota))
+	if err != nil {
+		return conf, err
+	}
+	if quota <= 0 {
+		return conf, fmt.Errorf("%s must be positive", FlagUnconfirmedQuota)
+	}
+	conf.Quota = int(quota)
+
+	if conf.QuotaOfAcc, err = parseTxQuotaWhitelist(viper.GetStringSlice(FlagUnconfirmedQuotaWhitelist)); err != nil {
+		return conf, fmt.Errorf("invalid %s: %s", FlagUnconfirmedQuotaWhitelist, err.Error())
+	}
+	for _, s := range viper.GetStringSlice(FlagUnconfirmedExemptAddresses) {
+		addr, err := sdk.AccAddressFromBech32(strings.TrimSpace(s))
+		if err != nil {
+			return conf, fmt.Errorf("invalid %s: %s", FlagUnconfirmedExemptAddresses, err.Error())
+		}
+		conf.Exempted[string(addr)] = struct{}{}
+	}
+	return conf, nil
+}
+
+// getInt64Config does not use viper.GetInt64, which returns 0 for a malformed value
+func getInt64Config(key string, defaultValue int64) (int64, error) {
+	if !viper.IsSet(key) {
+		return defaultValue, nil
+	}
+	s := viper.GetString(key)
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", key, s)
+	}
+	return v, nil
+}
+
+func parseTxQuotaWhitelist(whitelist []string) (map[string]int, error) {
+	quotaOfAcc := make(map[string]int, len(whitelist))
+	for _, item := range whitelist {
+		pair := strings.Split(strings.TrimSpace(item), ":")
+		if len(pair) != 2 {
+			return quotaOfAcc, fmt.Errorf("%s is not in the form of address:quota", item)
+		}
+		addr, err := sdk.AccAddressFromBech32(pair[0])
+		if err != nil {
+			return quotaOfAcc, err
+		}
+		quota, err := strconv.Atoi(pair[1])
+		if err != nil || quota <= 0 {
+			return quotaOfAcc, fmt.Errorf("invalid quota of %s", pair[0])
+		}
+		quotaOfAcc[string(addr)] = quota
+	}
+	return quotaOfAcc, nil
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coinexchain/cet-sdk/testutil"
+)
+
+func TestLoadUnconfirmedTxConfig(t *testing.T) {
+	_, _, addr := testutil.KeyPubAddr()
+	_, _, addr2 := testutil.KeyPubAddr()
+	for _, key := range []string{FlagUnconfirmedLimitTime, FlagUnconfirmedSweepPeriod, FlagUnconfirmedQuota,
+		FlagUnconfirmedQuotaWhitelist, FlagUnconfirmedExemptAddresses} {
+		old := viper.Get(key)
+		defer viper.Set(key, old)
+	}
+
+	conf, err := LoadUnconfirmedTxConfig()
+	require.Nil(t, err)
+	require.Equal(t, DefaultUnconfirmedTxConfig(), conf)
+
+	viper.Set(FlagUnconfirmedLimitTime, 30)
+	viper.Set(FlagUnconfirmedSweepPeriod, "60")
+	viper.Set(FlagUnconfirmedQuota, 2)
+	viper.Set(FlagUnconfirmedQuotaWhitelist, []string{addr.String() + ":5"})
+	viper.Set(FlagUnconfirmedExemptAddresses, []string{addr2.String()})
+	conf, err = LoadUnconfirmedTxConfig()
+	require.Nil(t, err)
+	require.Equal(t, int64(30), conf.LimitTime)
+	require.Equal(t, int64(60), conf.SweepPeriod)
+	require.Equal(t, 2, conf.Quota)
+	require.Equal(t, map[string]int{string(addr): 5}, conf.QuotaOfAcc)
+	require.Equal(t, map[string]struct{}{string(addr2): {}}, conf.Exempted)
+
+	invalids := map[string]interface{}{
+		FlagUnconfirmedLimitTime:       "1m",
+		FlagUnconfirmedSweepPeriod:     0,
+		FlagUnconfirmedQuota:           -1,
+		FlagUnconfirmedQuotaWhitelist:  []string{addr.String()},
+		FlagUnconfirmedExemptAddresses: []string{"coinex1xxx"},
+	}
+	for key, value := range invalids {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		_, err = LoadUnconfirmedTxConfig()
+		require.NotNil(t, err, key)
+		viper.Set(key, old)
+	}
+	viper.Set(FlagUnconfirmedLimitTime, -1)
+	_, err = LoadUnconfirmedTxConfig()
+	require.NotNil(t, err)
+}
+
+func TestUnconfirmedLimitTimeEnv(t *testing.T) {
+	old := viper.Get(FlagUnconfirmedLimitTime)
+	defer viper.Set(FlagUnconfirmedLimitTime, old)
+	defer os.Unsetenv(EnvUnconfirmedLimitTime)
+
+	// the env is the fallback of app.toml
+	viper.Set(FlagUnconfirmedLimitTime, nil)
+	require.Nil(t, os.Setenv(EnvUnconfirmedLimitTime, "120"))
+	conf, err := LoadUnconfirmedTxConfig()
+	require.Nil(t, err)
+	require.Equal(t, int64(120), conf.LimitTime)
+
+	require.Nil(t, os.Setenv(EnvUnconfirmedLimitTime, "-1"))
+	conf, err = LoadUnconfirmedTxConfig()
+	require.Nil(t, err)
+	require.Equal(t, int64(0), conf.LimitTime)
+
+	require.Nil(t, os.Setenv(EnvUnconfirmedLimitTime, "1m"))
+	_, err = LoadUnconfirmedTxConfig()
+	require.NotNil(t, err)
+
+	viper.Set(FlagUnconfirmedLimitTime, 30)
+	conf, err = LoadUnconfirmedTxConfig()
+	require.Nil(t, err)
+	require.Equal(t, int64(30), conf.LimitTime)
+}
+
+func TestParseTxQuotaWhitelist(t *testing.T) {
+	_, _, addr := testutil.KeyPubAddr()
+	quotaOfAcc, err := parseTxQuotaWhitelist([]string{" " + addr.String() + ":5 "})
+	require.Nil(t, err)
+	require.Equal(t, map[string]int{string(addr): 5}, quotaOfAcc)
+
+	_, err = parseTxQuotaWhitelist([]string{addr.String() + ":0"})
+	require.NotNil(t, err)
+	_, err = parseTxQuotaWhitelist([]string{"coinex1xxx:3"})
+	require.NotNil(t, err)
+}
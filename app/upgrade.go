@@ -0,0 +1,221 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/params"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// UpgradeParamspace is the param subspace of the planned upgrades, which are changed by the
+// ParameterChangeProposal of the key PlannedUpgrades:
+//
+//	{"subspace": "upgrade", "key": "PlannedUpgrades", "value": "[{\"name\":\"v2\",\"height\":\"5000000\"}]"}
+const UpgradeParamspace = "upgrade"
+
+var KeyPlannedUpgrades = []byte("PlannedUpgrades")
+
+// upgradeDoneKeyPrefix is followed by the name of an upgrade in the main store, the value is its height
+var upgradeDoneKeyPrefix = []byte("upgrade/done/")
+
+// UpgradeHandler migrates the state in place, instead of exporting and importing the genesis
+type UpgradeHandler func(ctx sdk.Context)
+
+// Upgrade runs Handler once at the beginning of the block at Height, before the BeginBlock of the modules
+type Upgrade struct {
+	Name    string
+	Height  int64
+	Handler UpgradeHandler
+}
+
+// PlannedUpgrade halts the nodes at Height whose binaries have no upgrade of Name at Height
+type PlannedUpgrade struct {
+	Name   string `json:"name"`
+	Height int64  `json:"height"`
+}
+
+// UpgradeParams are the upgrades planned by governance
+type UpgradeParams struct {
+	PlannedUpgrades []PlannedUpgrade `json:"planned_upgrades"`
+}
+
+func (p *UpgradeParams) ParamSetPairs() params.ParamSetPairs {
+	return params.ParamSetPairs{
+		{Key: KeyPlannedUpgrades, Value: &p.PlannedUpgrades},
+	}
+}
+
+func (p UpgradeParams) String() string {
+	var sb strings.Builder
+	sb.WriteString("Planned Upgrades:\n")
+	for _, u := range p.PlannedUpgrades {
+		sb.WriteString(fmt.Sprintf("  %s: %d\n", u.Name, u.Height))
+	}
+	return sb.String()
+}
+
+func UpgradeParamKeyTable() params.KeyTable {
+	return params.NewKeyTable().RegisterParamSet(&UpgradeParams{})
+}
+
+func ErrInvalidUpgrades(msg string) sdk.Error {
+	return sdk.NewError(CodespaceApp, CodeInvalidUpgrades, msg)
+}
+
+// upgrades returns the upgrades of the chain, a new one is added here together with its handler, and is
+// never removed once its height is passed
+func (app *CetChainApp) upgrades() []Upgrade {
+	return nil
+}
+
+func (app *CetChainApp) initUpgrades() {
+	app.upgradeSubspace = app.paramsKeeper.Subspace(UpgradeParamspace).WithKeyTable(UpgradeParamKeyTable())
+	app.upgradeHandlers = make(map[int64]Upgrade)
+	for _, u := range app.upgrades() {
+		app.RegisterUpgrade(u)
+	}
+}
+
+// RegisterUpgrade adds an upgrade, it panics if the name or the height is taken by another upgrade
+func (app *CetChainApp) RegisterUpgrade(u Upgrade) {
+	if len(u.Name) == 0 || u.Height <= 0 || u.Handler == nil {
+		panic(fmt.Sprintf("invalid upgrade %s at height %d", u.Name, u.Height))
+	}
+	if other, ok := app.upgradeHandlers[u.Height]; ok {
+		panic(fmt.Sprintf("upgrade %s and %s are both at height %d", other.Name, u.Name, u.Height))
+	}
+	for _, other := range app.upgradeHandlers {
+		if other.Name == u.Name {
+			panic(fmt.Sprintf("upgrade %s is at both height %d and %d", u.Name, other.Height, u.Height))
+		}
+	}
+	app.upgradeHandlers[u.Height] = u
+}
+
+func (app *CetChainApp) GetUpgradeParams(ctx sdk.Context) (p UpgradeParams) {
+	app.upgradeSubspace.GetIfExists(ctx, KeyPlannedUpgrades, &p.PlannedUpgrades)
+	return
+}
+
+func (app *CetChainApp) SetUpgradeParams(ctx sdk.Context, p UpgradeParams) {
+	app.upgradeSubspace.SetParamSet(ctx, &p)
+}
+
+// validateUpgradeParams checks the planned upgrades at the height of ctx: an upgrade not done yet must be planned
+// after it, and a done one can not be moved to another height
+func (app *CetChainApp) validateUpgradeParams(ctx sdk.Context, p UpgradeParams) error {
+	names := make(map[string]bool, len(p.PlannedUpgrades))
+	heights := make(map[int64]bool, len(p.PlannedUpgrades))
+	for _, u := range p.PlannedUpgrades {
+		if len(u.Name) == 0 || u.Height <= 0 {
+			return fmt.Errorf("invalid planned upgrade %s at height %d", u.Name, u.Height)
+		}
+		if names[u.Name] || heights[u.Height] {
+			return fmt.Errorf("duplicated planned upgrade %s at height %d", u.Name, u.Height)
+		}
+		names[u.Name], heights[u.Height] = true, true
+		height, done := app.getUpgradeDone(ctx, u.Name)
+		if done && height != u.Height {
+			return fmt.Errorf("upgrade %s is done at height %d, it can not be planned at %d", u.Name, height, u.Height)
+		}
+		if !done && u.Height <= ctx.BlockHeight() {
+			return fmt.Errorf("height %d of planned upgrade %s is not after the current height %d",
+				u.Height, u.Name, ctx.BlockHeight())
+		}
+	}
+	return nil
+}
+
+// haltForUpgrade panics at the height of a planned upgrade whose handler is missing in this binary, so that the
+// node stops before the block changes the state, and is restarted with the binary of the upgrade
+func (app *CetChainApp) haltForUpgrade(ctx sdk.Context) {
+	for _, p := range app.GetUpgradeParams(ctx).PlannedUpgrades {
+		if p.Height != ctx.BlockHeight() {
+			continue
+		}
+		if u, ok := app.upgradeHandlers[p.Height]; !ok || u.Name != p.Name {
+			msg := fmt.Sprintf("UPGRADE %s NEEDED at height %d", p.Name, p.Height)
+			app.Logger().Error(msg)
+			panic(msg)
+		}
+	}
+}
+
+// runUpgrade runs the upgrade at the height of ctx if it is not done, and records it as done
+func (app *CetChainApp) runUpgrade(ctx sdk.Context) {
+	u, ok := app.upgradeHandlers[ctx.BlockHeight()]
+	if !ok {
+		return
+	}
+	if _, done := app.getUpgradeDone(ctx, u.Name); done {
+		return
+	}
+	app.Logger().Info(fmt.Sprintf("running upgrade %s at height %d", u.Name, u.Height))
+	u.Handler(ctx)
+	ctx.KVStore(app.keyMain).Set(upgradeDoneKey(u.Name), app.cdc.MustMarshalBinaryBare(u.Height))
+}
+
+func (app *CetChainApp) getUpgradeDone(ctx sdk.Context, name string) (height int64, done bool) {
+	bz := ctx.KVStore(app.keyMain).Get(upgradeDoneKey(name))
+	if bz == nil {
+		return 0, false
+	}
+	app.cdc.MustUnmarshalBinaryBare(bz, &height)
+	return height, true
+}
+
+// checkUpgrades returns an error if the state is not the one this binary would produce: an upgrade done by
+// another binary is unknown to this one, or the height of an upgrade is passed without running it. The upgrades
+// before the genesis block height are skipped, their migrations are in the exported genesis.
+func (app *CetChainApp) checkUpgrades(ctx sdk.Context) error {
+	known := make(map[string]int64, len(app.upgradeHandlers))
+	for _, u := range app.upgradeHandlers {
+		known[u.Name] = u.Height
+	}
+
+	iter := sdk.KVStorePrefixIterator(ctx.KVStore(app.keyMain), upgradeDoneKeyPrefix)
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		name := string(iter.Key()[len(upgradeDoneKeyPrefix):])
+		var height int64
+		app.cdc.MustUnmarshalBinaryBare(iter.Value(), &height)
+		if h, ok := known[name]; !ok || h != height {
+			return fmt.Errorf("upgrade %s is done at height %d, but its handler is missing", name, height)
+		}
+	}
+
+	lastHeight := app.LastBlockHeight()
+	for _, u := range app.upgradeHandlers {
+		if u.Height <= tmtypes.GenesisBlockHeight || u.Height > lastHeight {
+			continue
+		}
+		if _, done := app.getUpgradeDone(ctx, u.Name); !done {
+			return fmt.Errorf("height %d of upgrade %s is passed without running it, the last height is %d",
+				u.Height, u.Name, lastHeight)
+		}
+	}
+	return nil
+}
+
+// LoadLatestVersion loads the latest state, and refuses it if the upgrades in it do not match this binary
+func (app *CetChainApp) LoadLatestVersion(baseKey *sdk.KVStoreKey) error {
+	if err := app.BaseApp.LoadLatestVersion(baseKey); err != nil {
+		return err
+	}
+	return app.checkUpgrades(app.NewContext(true, abci.Header{}))
+}
+
+// LoadVersion loads the state at version, and refuses it if the upgrades in it do not match this binary
+func (app *CetChainApp) LoadVersion(version int64, baseKey *sdk.KVStoreKey) error {
+	if err := app.BaseApp.LoadVersion(version, baseKey); err != nil {
+		return err
+	}
+	return app.checkUpgrades(app.NewContext(true, abci.Header{}))
+}
+
+func upgradeDoneKey(name string) []byte {
+	return append(append([]byte{}, upgradeDoneKeyPrefix...), name...)
+}
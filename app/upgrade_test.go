@@ -0,0 +1,135 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+	dbm "github.com/tendermint/tm-db"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/params"
+
+	"github.com/coinexchain/cet-sdk/testutil"
+)
+
+func newUpgradeTestApp(db dbm.DB, upgrades ...Upgrade) (*CetChainApp, error) {
+	app := NewCetChainApp(log.NewNopLogger(), db, nil, false, 0)
+	for _, u := range upgrades {
+		app.RegisterUpgrade(u)
+	}
+	return app, app.LoadLatestVersion(app.keyMain)
+}
+
+func TestUpgrades(t *testing.T) {
+	_, acc := testutil.NewBaseAccount(1e10, 0, 0)
+	var runs []int64
+	upgrade := Upgrade{Name: "v2", Height: 3, Handler: func(ctx sdk.Context) {
+		runs = append(runs, ctx.BlockHeight())
+	}}
+
+	db := dbm.NewMemDB()
+	app, err := newUpgradeTestApp(db, upgrade)
+	require.Nil(t, err)
+	initChain(app, func(genState *GenesisState) {
+		addGenesisAccounts(genState, acc)
+		genState.AuthData = GetDefaultAuthGenesisState()
+	})
+	for h := int64(1); h <= 4; h++ {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: h, ChainID: testChainID}})
+		app.EndBlock(abci.RequestEndBlock{Height: h})
+		app.Commit()
+		if h == 2 {
+			// the height of a new upgrade is not passed yet
+			_, err = newUpgradeTestApp(db, upgrade)
+			require.Nil(t, err)
+		}
+	}
+	require.Equal(t, []int64{3}, runs)
+	height, done := app.getUpgradeDone(app.NewContext(true, abci.Header{}), "v2")
+	require.True(t, done)
+	require.Equal(t, int64(3), height)
+
+	_, err = newUpgradeTestApp(db, upgrade)
+	require.Nil(t, err)
+	_, err = newUpgradeTestApp(db)
+	require.EqualError(t, err, "upgrade v2 is done at height 3, but its handler is missing")
+	_, err = newUpgradeTestApp(db, Upgrade{Name: "v2", Height: 4, Handler: upgrade.Handler})
+	require.EqualError(t, err, "upgrade v2 is done at height 3, but its handler is missing")
+	_, err = newUpgradeTestApp(db, upgrade, Upgrade{Name: "v3", Height: 4, Handler: upgrade.Handler})
+	require.EqualError(t, err, "height 4 of upgrade v3 is passed without running it, the last height is 4")
+
+	// the upgrades are checked at any height loaded
+	app = NewCetChainApp(log.NewNopLogger(), db, nil, false, 0)
+	require.EqualError(t, app.LoadHeight(4), "upgrade v2 is done at height 3, but its handler is missing")
+	app = NewCetChainApp(log.NewNopLogger(), db, nil, false, 0)
+	app.RegisterUpgrade(upgrade)
+	require.Nil(t, app.LoadHeight(4))
+
+	app = NewCetChainApp(log.NewNopLogger(), dbm.NewMemDB(), nil, false, 0)
+	app.RegisterUpgrade(upgrade)
+	require.Panics(t, func() { app.RegisterUpgrade(Upgrade{Name: "v3", Height: 3, Handler: upgrade.Handler}) })
+	require.Panics(t, func() { app.RegisterUpgrade(Upgrade{Name: "v2", Height: 5, Handler: upgrade.Handler}) })
+	require.Panics(t, func() { app.RegisterUpgrade(Upgrade{Name: "v4", Height: 5}) })
+}
+
+func TestPlannedUpgrades(t *testing.T) {
+	_, acc := testutil.NewBaseAccount(1e10, 0, 0)
+	var runs []int64
+	upgrade := Upgrade{Name: "v2", Height: 3, Handler: func(ctx sdk.Context) {
+		runs = append(runs, ctx.BlockHeight())
+	}}
+
+	db := dbm.NewMemDB()
+	app, err := newUpgradeTestApp(db)
+	require.Nil(t, err)
+	initChain(app, func(genState *GenesisState) {
+		addGenesisAccounts(genState, acc)
+		genState.AuthData = GetDefaultAuthGenesisState()
+	})
+	header := abci.Header{Height: 1, ChainID: testChainID}
+	app.BeginBlock(abci.RequestBeginBlock{Header: header})
+	ctx := app.NewContext(false, header)
+	handler := app.newParamChangeProposalHandler()
+	for _, value := range []string{
+		`[{"name":"v2","height":"1"}]`,
+		`[{"name":"","height":"3"}]`,
+		`[{"name":"v2","height":"3"},{"name":"v2","height":"4"}]`,
+		`[{"name":"v2","height":"3"},{"name":"v3","height":"3"}]`,
+	} {
+		proposal := params.NewParameterChangeProposal("upgrade", "upgrade", []params.ParamChange{
+			params.NewParamChange(UpgradeParamspace, string(KeyPlannedUpgrades), value),
+		})
+		cacheCtx, _ := ctx.CacheContext()
+		err := handler(cacheCtx, proposal)
+		require.NotNil(t, err, value)
+		require.Equal(t, CodeInvalidUpgrades, err.Code())
+	}
+	proposal := params.NewParameterChangeProposal("upgrade", "upgrade", []params.ParamChange{
+		params.NewParamChange(UpgradeParamspace, string(KeyPlannedUpgrades), `[{"name":"v2","height":"3"}]`),
+	})
+	require.Nil(t, handler(ctx, proposal))
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+	require.Equal(t, []PlannedUpgrade{{Name: "v2", Height: 3}},
+		app.GetUpgradeParams(app.NewContext(true, abci.Header{})).PlannedUpgrades)
+
+	// this binary has no handler of v2, it halts at height 3 before changing the state
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 2, ChainID: testChainID}})
+	app.EndBlock(abci.RequestEndBlock{Height: 2})
+	app.Commit()
+	require.PanicsWithValue(t, "UPGRADE v2 NEEDED at height 3", func() {
+		app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 3, ChainID: testChainID}})
+	})
+
+	// the binary of the upgrade runs it at height 3
+	app, err = newUpgradeTestApp(db, upgrade)
+	require.Nil(t, err)
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{Height: 3, ChainID: testChainID}})
+	app.EndBlock(abci.RequestEndBlock{Height: 3})
+	app.Commit()
+	require.Equal(t, []int64{3}, runs)
+	_, err = newUpgradeTestApp(db)
+	require.EqualError(t, err, "upgrade v2 is done at height 3, but its handler is missing")
+}
@@ -62,6 +62,7 @@ func CreateContextAndRegisterRoutes(router *mux.Router) {
 	client.RegisterRoutes(ctx, router)
 	authrest.RegisterTxRoutes(ctx, router)
 	ModuleBasics.RegisterRESTRoutes(ctx, router)
+	RegisterMsgRoutesRESTRoutes(ctx, router)
 }
 
 // see cosmos-sdk/client/context/context.go#NewCLIContextWithFrom()
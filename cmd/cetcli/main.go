@@ -137,6 +137,10 @@ func queryCmd(cdc *codec.Codec) *cobra.Command {
 		rpc.BlockCommand(),
 		authcmd.QueryTxsByEventsCmd(cdc),
 		authcmd.QueryTxCmd(cdc),
+		unconfirmedTxStatsCmd(cdc),
+		disabledMsgRoutesCmd(cdc),
+		bancorShutdownReportsCmd(cdc),
+		anteRulesCmd(cdc),
 		client.LineBreak,
 	)
 
@@ -188,6 +192,7 @@ func registerRoutes(rs *lcd.RestServer) {
 	client.RegisterRoutes(rs.CliCtx, rs.Mux)
 	authrest.RegisterTxRoutes(rs.CliCtx, rs.Mux)
 	app.ModuleBasics.RegisterRESTRoutes(rs.CliCtx, rs.Mux)
+	app.RegisterMsgRoutesRESTRoutes(rs.CliCtx, rs.Mux)
 }
 
 func fixDescriptions(cmd *cobra.Command) {
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/client/context"
+	"github.com/cosmos/cosmos-sdk/codec"
+
+	"github.com/coinexchain/dex/app"
+)
+
+func disabledMsgRoutesCmd(cdc *codec.Codec) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disabled-msg-routes",
+		Short: "Query the disabled msg routes",
+		Long: `Query the msg routes disabled by governance and the heights they are disabled from.
+The txs with the msgs of a route are rejected from its height on.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cliCtx := context.NewCLIContext().WithCodec(cdc)
+			route := fmt.Sprintf("custom/%s/%s", app.MsgRoutesQuerierRoute, app.QueryDisabledMsgRoutes)
+			res, _, err := cliCtx.QueryWithData(route, nil)
+			if err != nil {
+				return err
+			}
+
+			var params app.MsgRoutesParams
+			if err = cdc.UnmarshalJSON(res, &params); err != nil {
+				return err
+			}
+			return cliCtx.PrintOutput(params)
+		},
+	}
+	return client.GetCommands(cmd)[0]
+}
+
+func bancorShutdownReportsCmd(cdc *codec.Codec) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bancor-shutdown-reports",
+		Short: "Query the refunds of the bancor pools canceled since bancorlite is disabled",
+		Long: `Query the reports of the heights at which the bancor pools are canceled since the bancorlite
+route is disabled, with the owner, the stock and money in each pool, and whether they are refunded.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cliCtx := context.NewCLIContext().WithCodec(cdc)
+			route := fmt.Sprintf("custom/%s/%s", app.MsgRoutesQuerierRoute, app.QueryBancorShutdownReports)
+			res, _, err := cliCtx.QueryWithData(route, nil)
+			if err != nil {
+				return err
+			}
+
+			var reports app.BancorShutdownReports
+			if err = cdc.UnmarshalJSON(res, &reports); err != nil {
+				return err
+			}
+			return cliCtx.PrintOutput(reports)
+		},
+	}
+	return client.GetCommands(cmd)[0]
+}
+
+func anteRulesCmd(cdc *codec.Codec) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ante-rules",
+		Short: "Query the rules checking the msgs in the txs",
+		Long: `Query the rules which the ante handler checks the msgs in the txs with, by msg type.
+The rules of "*" check every msg, before the ones of its type.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cliCtx := context.NewCLIContext().WithCodec(cdc)
+			route := fmt.Sprintf("custom/%s/%s", app.MsgRoutesQuerierRoute, app.QueryAnteRules)
+			res, _, err := cliCtx.QueryWithData(route, nil)
+			if err != nil {
+				return err
+			}
+
+			var sets app.AnteRuleSets
+			if err = cdc.UnmarshalJSON(res, &sets); err != nil {
+				return err
+			}
+			return cliCtx.PrintOutput(sets)
+		},
+	}
+	return client.GetCommands(cmd)[0]
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/client/context"
+	"github.com/cosmos/cosmos-sdk/codec"
+
+	"github.com/coinexchain/dex/app"
+)
+
+func unconfirmedTxStatsCmd(cdc *codec.Codec) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unconfirmed-tx-stats",
+		Short: "Query the unconfirmed-tx limit stats of the node",
+		Long: `Query the number of tracked accounts and txs, the rejections in the last minute
+and the last sweep time of the unconfirmed-tx limit of the node.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cliCtx := context.NewCLIContext().WithCodec(cdc)
+			route := fmt.Sprintf("custom/%s/%s", app.UnconfirmedTxQuerierRoute, app.QueryUnconfirmedTxStats)
+			res, _, err := cliCtx.QueryWithData(route, nil)
+			if err != nil {
+				return err
+			}
+
+			var stats app.UnconfirmedTxStats
+			if err = cdc.UnmarshalJSON(res, &stats); err != nil {
+				return err
+			}
+			return cliCtx.PrintOutput(stats)
+		},
+	}
+	return client.GetCommands(cmd)[0]
+}
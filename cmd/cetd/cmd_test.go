@@ -11,6 +11,7 @@ import (
 	"github.com/tendermint/tendermint/libs/log"
 	dbm "github.com/tendermint/tm-db"
 
+	"github.com/cosmos/cosmos-sdk/client/flags"
 	"github.com/cosmos/cosmos-sdk/server"
 
 	dex "github.com/coinexchain/cet-sdk/types"
@@ -23,10 +24,15 @@ func init() {
 
 func TestCreateRootCmd(t *testing.T) {
 	rootCmd := createCetdCmd()
-	require.Equal(t, 16, len(rootCmd.Commands()))
+	require.Equal(t, 19, len(rootCmd.Commands()))
 }
 
 func TestNewApp(t *testing.T) {
+	testHome := "./testhome"
+	defer os.RemoveAll(testHome)
+	viper.Set(flags.FlagHome, testHome)
+	defer viper.Set(flags.FlagHome, "")
+
 	db := dbm.NewMemDB()
 	logger := log.NewTMLogger(log.NewSyncWriter(os.Stdout))
 	viper.Set(server.FlagMinGasPrices, "20.0cet")
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"syscall"
 	"time"
@@ -39,7 +40,6 @@ const flagInvCheckPeriod = "inv-check-period"
 var invCheckPeriod uint
 
 func main() {
-	plugin.SetReloadPluginSignal(syscall.SIGUSR1)
 	msgqueue.SetMkFifoFunc(syscall.Mkfifo)
 
 	dex.InitSdkConfig()
@@ -71,6 +71,10 @@ func createCetdCmd() *cobra.Command {
 
 	rootCmd.PersistentFlags().UintVar(&invCheckPeriod, flagInvCheckPeriod,
 		0, "Assert registered invariants every N blocks")
+	rootCmd.PersistentFlags().Duration(plugin.FlagCallTimeout, plugin.DefaultCallTimeout,
+		"Time budget of a plugin PreCheckTx call, 0 to wait without limit. A failing plugin passes the tx")
+	rootCmd.PersistentFlags().Int64(plugin.FlagMaxFailures, plugin.DefaultMaxFailures,
+		"Disable a plugin after this many consecutive timeouts and panics, 0 to never disable it")
 
 	return rootCmd
 }
@@ -91,6 +95,9 @@ func addInitCommands(ctx *server.Context, cdc *codec.Codec, rootCmd *cobra.Comma
 	rootCmd.AddCommand(assetcli.AddGenesisTokenCmd(ctx, cdc, app.DefaultNodeHome, app.DefaultCLIHome))
 	rootCmd.AddCommand(testnetCmd(ctx, cdc, app.ModuleBasics, genaccounts.AppModuleBasic{}))
 	rootCmd.AddCommand(migrateCmd(cdc))
+	rootCmd.AddCommand(pluginCmd())
+	rootCmd.AddCommand(replayPubMsgsCmd(ctx))
+	rootCmd.AddCommand(rebuildPubMsgsCmd(ctx))
 }
 
 func adjustBlockCommitSpeed(config *tmconfig.Config) {
@@ -108,6 +115,9 @@ func newApp(logger log.Logger, db dbm.DB, traceStore io.Writer) abci.Application
 		baseapp.SetCheckTxWithMsgHandle(viper.GetBool(server.FlagCheckTxWithMsgHandle)),
 	)
 	checkMinGasPrice(cetChainApp, logger)
+	if err := cetChainApp.StartAdminServer(plugin.DefaultAdminSocket()); err != nil {
+		logger.Error(fmt.Sprintf("start plugin admin server failed, %s", err.Error()))
+	}
 	return cetChainApp
 }
 
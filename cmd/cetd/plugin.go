@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/coinexchain/dex/app/plugin"
+)
+
+const flagAdminSocket = "socket"
+
+func pluginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Manage the CheckTx plugins of a running node",
+	}
+
+	cmd.AddCommand(
+		pluginAdminCmd(plugin.AdminCmdStatus, "Show name, path, load time and state of the loaded plugins",
+			cobra.NoArgs),
+		pluginAdminCmd(plugin.AdminCmdLoad+" [name] [file]",
+			"Load a plugin to the end of the chain in disabled state, file defaults to the one in manifest",
+			cobra.RangeArgs(1, 2)),
+		pluginAdminCmd(plugin.AdminCmdUnload+" [name]", "Remove a plugin from the chain", cobra.ExactArgs(1)),
+		pluginAdminCmd(plugin.AdminCmdEnable+" [name]", "Enable a loaded plugin", cobra.ExactArgs(1)),
+		pluginAdminCmd(plugin.AdminCmdDisable+" [name]", "Disable a loaded plugin", cobra.ExactArgs(1)),
+		pluginAdminCmd(plugin.AdminCmdReload, "Rebuild the plugin chain from the manifest, upgrading the changed plugins",
+			cobra.NoArgs),
+		pluginAdminCmd(plugin.AdminCmdUpgrade+" [name] [file]",
+			"Swap in a new build of a loaded plugin, file defaults to its current source. A build of a package "+
+				"must have a unique pluginpath, see -gcflags=-p and -ldflags=-pluginpath", cobra.RangeArgs(1, 2)),
+		pluginAdminCmd(plugin.AdminCmdRollback+" [name]", "Swap the previous version of a plugin back in",
+			cobra.ExactArgs(1)),
+	)
+	cmd.PersistentFlags().String(flagAdminSocket, "",
+		"Unix socket of the plugin admin endpoint, defaults to $home/data/plugins/admin.sock")
+	return cmd
+}
+
+func pluginAdminCmd(use, short string, args cobra.PositionalArgs) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  args,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var name, file string
+			if len(args) > 0 {
+				name = args[0]
+			}
+			if len(args) > 1 {
+				file = args[1]
+			}
+
+			socket := viper.GetString(flagAdminSocket)
+			if len(socket) == 0 {
+				socket = plugin.DefaultAdminSocket()
+			}
+			res, err := plugin.NewAdminClient(socket).Send(cmd.Name(), name, file)
+			if res.Plugins != nil {
+				out, errJSON := json.MarshalIndent(res.Plugins, "", "  ")
+				if errJSON != nil {
+					return errJSON
+				}
+				fmt.Println(string(out))
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/proxy"
+	sm "github.com/tendermint/tendermint/state"
+	tmstore "github.com/tendermint/tendermint/store"
+	tmtypes "github.com/tendermint/tendermint/types"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/cosmos/cosmos-sdk/server"
+
+	"github.com/coinexchain/cet-sdk/msgqueue"
+	"github.com/coinexchain/dex/app"
+	"github.com/coinexchain/dex/app/sink"
+)
+
+const (
+	flagStateDir = "state-dir"
+	flagKeys     = "keys"
+)
+
+func rebuildPubMsgsCmd(ctx *server.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rebuild-pubmsgs",
+		Short: "Rebuild the pub messages of past heights by executing the stored blocks again",
+		Long: `Execute the blocks in the block store of the node again on a state snapshot, and write the pub
+messages the node emitted for them to a file sink, one JSON line per message.
+
+--state-dir is a directory holding a copy of application.db at the height before the first one to rebuild,
+or an empty one to start from genesis. The snapshot is advanced by the command, so it must not be the data
+directory of the node. The node must be stopped, because the block store and the state DB are opened here.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := ctx.Config
+			stateDir := viper.GetString(flagStateDir)
+			if abs, err := filepath.Abs(stateDir); err != nil {
+				return err
+			} else if abs == filepath.Clean(config.DBDir()) {
+				return fmt.Errorf("%s is the data directory of the node, use a copy of application.db", stateDir)
+			}
+			output := viper.GetString(flagOutput)
+			if len(output) == 0 {
+				output = filepath.Join(config.DBDir(), "pubmsgs-rebuild.jsonl")
+			}
+
+			genDoc, err := tmtypes.GenesisDocFromFile(config.GenesisFile())
+			if err != nil {
+				return err
+			}
+			tmtypes.GenesisBlockHeight = genDoc.GenesisBlockHeight
+
+			// the messages only go to the file sink synchronously, the brokers, the trade-server and the WAL of
+			// the node are left alone, and the tracker of unconfirmed txs is not needed without CheckTx
+			viper.Set(msgqueue.FlagBrokers, []string{})
+			viper.Set(sink.FlagSinks, []map[string]interface{}{{
+				"type": sink.TypeFile,
+				"path": output,
+				"keys": viper.GetStringSlice(flagKeys),
+			}})
+			viper.Set(sink.FlagWALDir, filepath.Join(stateDir, "pubmsg-wal"))
+			viper.Set(sink.FlagAsyncEnable, false)
+			viper.Set(app.FlagUnconfirmedLimitTime, "0")
+
+			backend := dbm.DBBackendType(config.DBBackend)
+			blockStoreDB := dbm.NewDB("blockstore", backend, config.DBDir())
+			defer blockStoreDB.Close()
+			stateDB := dbm.NewDB("state", backend, config.DBDir())
+			defer stateDB.Close()
+			appDB := dbm.NewDB("application", backend, stateDir)
+			defer appDB.Close()
+
+			cetChainApp := app.NewCetChainApp(ctx.Logger, appDB, nil, true, invCheckPeriod)
+			proxyApp := proxy.NewAppConns(proxy.NewLocalClientCreator(cetChainApp))
+			proxyApp.SetLogger(ctx.Logger.With("module", "proxy"))
+			if err = proxyApp.Start(); err != nil {
+				return err
+			}
+			defer proxyApp.Stop()
+
+			blockStore := tmstore.NewBlockStore(blockStoreDB)
+			fromHeight := cetChainApp.LastBlockHeight() + 1
+			toHeight := viper.GetInt64(flagToHeight)
+			if toHeight <= 0 || toHeight > blockStore.Height() {
+				toHeight = blockStore.Height()
+			}
+			if cetChainApp.LastBlockHeight() == 0 {
+				if err = initChain(proxyApp.Consensus(), genDoc); err != nil {
+					return err
+				}
+				fromHeight = genDoc.GenesisBlockHeight + 1
+			}
+			if fromHeight > toHeight {
+				return fmt.Errorf("the snapshot is at height %d, no block to execute up to height %d",
+					fromHeight-1, toHeight)
+			}
+
+			if err = replayBlocks(proxyApp.Consensus(), blockStore, stateDB, fromHeight, toHeight, ctx); err != nil {
+				return err
+			}
+			fmt.Printf("pub messages of heights [%d, %d] are written to %s\n", fromHeight, toHeight, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().String(flagStateDir, "", "Directory of the application.db snapshot to start from")
+	cmd.Flags().Int64(flagToHeight, 0, "Last height to rebuild, defaults to the last one in the block store")
+	cmd.Flags().String(flagOutput, "", "File of the messages, defaults to $home/data/pubmsgs-rebuild.jsonl")
+	cmd.Flags().StringSlice(flagKeys, nil, "Only write the messages with these keys, all of them if empty")
+	_ = cmd.MarkFlagRequired(flagStateDir)
+	return cmd
+}
+
+// initChain sends InitChain to the app like the handshake of tendermint does at genesis
+func initChain(conn proxy.AppConnConsensus, genDoc *tmtypes.GenesisDoc) error {
+	validators := make([]*tmtypes.Validator, len(genDoc.Validators))
+	for i, val := range genDoc.Validators {
+		validators[i] = tmtypes.NewValidator(val.PubKey, val.Power)
+	}
+	_, err := conn.InitChainSync(abci.RequestInitChain{
+		Time:            genDoc.GenesisTime,
+		ChainId:         genDoc.ChainID,
+		ConsensusParams: tmtypes.TM2PB.ConsensusParams(genDoc.ConsensusParams),
+		Validators:      tmtypes.TM2PB.ValidatorUpdates(tmtypes.NewValidatorSet(validators)),
+		AppStateBytes:   genDoc.AppState,
+	})
+	return err
+}
+
+// replayBlocks executes and commits the blocks in [fromHeight, toHeight], the app hash after every block
+// is checked against the one in the header of the next block, so that a wrong snapshot is found early
+func replayBlocks(conn proxy.AppConnConsensus, blockStore *tmstore.BlockStore, stateDB dbm.DB,
+	fromHeight, toHeight int64, ctx *server.Context) error {
+
+	for height := fromHeight; height <= toHeight; height++ {
+		block := blockStore.LoadBlock(height)
+		if block == nil {
+			return fmt.Errorf("block %d is not in the block store", height)
+		}
+		appHash, err := sm.ExecCommitBlock(conn, block, ctx.Logger, stateDB)
+		if err != nil {
+			return err
+		}
+		if next := blockStore.LoadBlockMeta(height + 1); next != nil && !bytes.Equal(next.Header.AppHash, appHash) {
+			return fmt.Errorf("app hash mismatch after height %d, expected %X, got %X",
+				height, next.Header.AppHash, appHash)
+		}
+		if height%1000 == 0 {
+			ctx.Logger.Info("rebuilding pub messages", "height", height, "to", toHeight)
+		}
+	}
+	return nil
+}
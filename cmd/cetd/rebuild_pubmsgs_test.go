@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	cfg "github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/proxy"
+	sm "github.com/tendermint/tendermint/state"
+	tmstore "github.com/tendermint/tendermint/store"
+	tmtypes "github.com/tendermint/tendermint/types"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/cosmos/cosmos-sdk/client/flags"
+	"github.com/cosmos/cosmos-sdk/server"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/cosmos/cosmos-sdk/x/genaccounts"
+
+	"github.com/coinexchain/cet-sdk/modules/asset"
+	"github.com/coinexchain/cet-sdk/modules/bankx"
+	"github.com/coinexchain/cet-sdk/msgqueue"
+	"github.com/coinexchain/cet-sdk/testutil"
+	dex "github.com/coinexchain/cet-sdk/types"
+	"github.com/coinexchain/dex/app"
+	"github.com/coinexchain/dex/app/sink"
+)
+
+const rebuildChainID = "rebuild-test"
+
+// setViper sets the keys and returns a func restoring them, the rebuild command also sets some of them
+func setViper(values map[string]interface{}) (restore func()) {
+	keys := []string{flags.FlagHome, flagStateDir, flagOutput, flagToHeight, flagKeys, msgqueue.FlagBrokers,
+		sink.FlagSinks, sink.FlagWALDir, sink.FlagAsyncEnable, app.FlagUnconfirmedLimitTime}
+	olds := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		olds[key] = viper.Get(key)
+	}
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	return func() {
+		for key, old := range olds {
+			viper.Set(key, old)
+		}
+	}
+}
+
+func rebuildGenesisState(accs ...auth.BaseAccount) json.RawMessage {
+	genState := app.NewDefaultGenesisState()
+	genState.AuthData = app.GetDefaultAuthGenesisState()
+	genState.AuthXData.Params.MinGasPriceLimit = sdk.MustNewDecFromStr("0.00000001")
+	genState.StakingData.Params.BondDenom = dex.DefaultBondDenom
+	genState.StakingXData.Params.MinSelfDelegation = 1e8
+	genState.AssetData.Tokens = append(genState.AssetData.Tokens, &asset.BaseToken{
+		Name:        "CoinEx Chain Native Token",
+		Symbol:      dex.CET,
+		TotalSupply: sdk.NewInt(1e18),
+		SendLock:    sdk.ZeroInt(),
+		Owner:       accs[0].Address,
+		Burnable:    true,
+		TotalBurn:   sdk.ZeroInt(),
+		TotalMint:   sdk.ZeroInt(),
+		Identity:    asset.TestIdentityString,
+	})
+	for i := range accs {
+		genState.Accounts = append(genState.Accounts, genaccounts.NewGenesisAccount(&accs[i]))
+	}
+	return app.MakeCodec().MustMarshalJSON(genState)
+}
+
+// buildChain executes blocks 1 to height with a node app, which creates a validator in block 1 and sends coins in
+// the following blocks, and stores them in the block store and the state DB under home. The validator is in
+// the validator set of tendermint from genesis, so that the last commits have its votes.
+func buildChain(t *testing.T, home string, height int64) {
+	key, acc := testutil.NewBaseAccount(1e18, 0, 0)
+	genDoc := &tmtypes.GenesisDoc{
+		ChainID:     rebuildChainID,
+		GenesisTime: time.Unix(1600000000, 0).UTC(),
+		AppState:    rebuildGenesisState(acc),
+	}
+	require.Nil(t, genDoc.ValidateAndComplete())
+	require.Nil(t, os.MkdirAll(filepath.Join(home, "config"), 0750))
+	require.Nil(t, genDoc.SaveAs(filepath.Join(home, "config", "genesis.json")))
+
+	dataDir := filepath.Join(home, "data")
+	blockStoreDB := dbm.NewDB("blockstore", dbm.GoLevelDBBackend, dataDir)
+	defer blockStoreDB.Close()
+	stateDB := dbm.NewDB("state", dbm.GoLevelDBBackend, dataDir)
+	defer stateDB.Close()
+	appDB := dbm.NewDB("application", dbm.GoLevelDBBackend, dataDir)
+	defer appDB.Close()
+
+	consPubKey := ed25519.GenPrivKey().PubKey()
+	valSet := tmtypes.NewValidatorSet([]*tmtypes.Validator{tmtypes.NewValidator(consPubKey, 10)})
+	for h := int64(0); h < height; h++ {
+		sm.SaveState(stateDB, sm.State{
+			ChainID:                     rebuildChainID,
+			LastBlockHeight:             h,
+			Validators:                  valSet,
+			NextValidators:              valSet,
+			LastHeightValidatorsChanged: 1,
+			ConsensusParams:             *tmtypes.DefaultConsensusParams(),
+		})
+	}
+
+	cetChainApp := app.NewCetChainApp(log.NewNopLogger(), appDB, nil, true, invCheckPeriod)
+	proxyApp := proxy.NewAppConns(proxy.NewLocalClientCreator(cetChainApp))
+	require.Nil(t, proxyApp.Start())
+	defer proxyApp.Stop()
+	require.Nil(t, initChain(proxyApp.Consensus(), genDoc))
+
+	blockStore := tmstore.NewBlockStore(blockStoreDB)
+	encoder := auth.DefaultTxEncoder(app.MakeCodec())
+	_, _, toAddr := testutil.KeyPubAddr()
+	var appHash []byte
+	for h := int64(1); h <= height; h++ {
+		var msg sdk.Msg = bankx.NewMsgSend(acc.Address, toAddr, dex.NewCetCoins(h*1e8), 0)
+		lastCommit := &tmtypes.Commit{Precommits: []*tmtypes.CommitSig{{}}}
+		if h == 1 {
+			msg = testutil.NewMsgCreateValidatorBuilder(sdk.ValAddress(acc.Address), consPubKey).
+				MinSelfDelegation(1e8).SelfDelegation(1e9).Commission("0.1", "0.1", "0.01").Build()
+			lastCommit = &tmtypes.Commit{}
+		}
+		tx := testutil.NewStdTxBuilder(rebuildChainID).Msgs(msg).GasAndFee(1000000, 100).
+			AccNumSeqKey(0, uint64(h-1), key).Build()
+		txBytes, err := encoder(tx)
+		require.Nil(t, err)
+
+		block := tmtypes.MakeBlock(h, []tmtypes.Tx{txBytes}, lastCommit, nil)
+		block.ChainID = rebuildChainID
+		block.Time = genDoc.GenesisTime.Add(time.Duration(h) * 5 * time.Second)
+		block.ProposerAddress = consPubKey.Address()
+		block.AppHash = appHash
+		blockStore.SaveBlock(block, block.MakePartSet(tmtypes.BlockPartSizeBytes), &tmtypes.Commit{})
+		appHash, err = sm.ExecCommitBlock(proxyApp.Consensus(), block, log.NewNopLogger(), stateDB)
+		require.Nil(t, err)
+	}
+}
+
+// readPubMsgs returns the lines of the file sink by height
+func readPubMsgs(t *testing.T, path string) map[int64][]string {
+	f, err := os.Open(path)
+	require.Nil(t, err)
+	defer f.Close()
+	lines := make(map[int64][]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var msg sink.Msg
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &msg))
+		require.Equal(t, msg.ComputeChecksum(), msg.Checksum)
+		lines[msg.Height] = append(lines[msg.Height], scanner.Text())
+	}
+	require.Nil(t, scanner.Err())
+	return lines
+}
+
+func TestRebuildPubMsgs(t *testing.T) {
+	home, err := ioutil.TempDir("", "rebuild")
+	require.Nil(t, err)
+	defer os.RemoveAll(home)
+	config := cfg.DefaultConfig()
+	config.SetRoot(home)
+	ctx := server.NewContext(config, log.NewNopLogger())
+
+	// the node publishes its messages to a file sink
+	livePath := filepath.Join(home, "live.jsonl")
+	restore := setViper(map[string]interface{}{
+		flags.FlagHome:               home,
+		msgqueue.FlagBrokers:         []string{},
+		sink.FlagSinks:               []map[string]interface{}{{"type": sink.TypeFile, "path": livePath}},
+		sink.FlagWALDir:              filepath.Join(home, "live-wal"),
+		sink.FlagAsyncEnable:         false,
+		app.FlagUnconfirmedLimitTime: "0",
+	})
+	defer restore()
+	buildChain(t, home, 6)
+	live := readPubMsgs(t, livePath)
+	require.Equal(t, 6, len(live))
+
+	rebuild := func(stateDir, output string, toHeight int64) error {
+		viper.Set(flagStateDir, stateDir)
+		viper.Set(flagOutput, output)
+		viper.Set(flagToHeight, toHeight)
+		viper.Set(flagKeys, []string{})
+		cmd := rebuildPubMsgsCmd(ctx)
+		return cmd.RunE(cmd, nil)
+	}
+
+	// heights [1,3] from genesis, which leaves the snapshot at height 3
+	stateDir := filepath.Join(home, "snapshot")
+	require.Nil(t, rebuild(stateDir, filepath.Join(home, "rebuild1.jsonl"), 3))
+	rebuilt := readPubMsgs(t, filepath.Join(home, "rebuild1.jsonl"))
+	require.Equal(t, 3, len(rebuilt))
+	for h := int64(1); h <= 3; h++ {
+		require.Equal(t, live[h], rebuilt[h], "height %d", h)
+	}
+
+	// heights [4,5] from the snapshot
+	require.Nil(t, rebuild(stateDir, filepath.Join(home, "rebuild2.jsonl"), 5))
+	rebuilt = readPubMsgs(t, filepath.Join(home, "rebuild2.jsonl"))
+	require.Equal(t, 2, len(rebuilt))
+	for h := int64(4); h <= 5; h++ {
+		require.NotEqual(t, 0, len(live[h]))
+		require.Equal(t, live[h], rebuilt[h], "height %d", h)
+	}
+
+	// the snapshot is at height 5, and a snapshot of another chain is found at its first block
+	require.NotNil(t, rebuild(stateDir, filepath.Join(home, "rebuild3.jsonl"), 5))
+	require.NotNil(t, rebuild(config.DBDir(), filepath.Join(home, "rebuild3.jsonl"), 6))
+	_, otherAcc := testutil.NewBaseAccount(1e18, 0, 0)
+	genDoc, err := tmtypes.GenesisDocFromFile(config.GenesisFile())
+	require.Nil(t, err)
+	var genState map[string]json.RawMessage
+	require.Nil(t, json.Unmarshal(genDoc.AppState, &genState))
+	var accounts genaccounts.GenesisState
+	require.Nil(t, app.MakeCodec().UnmarshalJSON(genState[genaccounts.ModuleName], &accounts))
+	otherAcc.Address = sdk.AccAddress(crypto.AddressHash([]byte("other")))
+	accounts = append(accounts, genaccounts.NewGenesisAccount(&otherAcc))
+	genState[genaccounts.ModuleName] = app.MakeCodec().MustMarshalJSON(accounts)
+	genDoc.AppState, err = json.Marshal(genState)
+	require.Nil(t, err)
+	require.Nil(t, genDoc.SaveAs(config.GenesisFile()))
+	err = rebuild(filepath.Join(home, "other"), filepath.Join(home, "rebuild3.jsonl"), 3)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "app hash mismatch after height 1")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/cosmos/cosmos-sdk/server"
+
+	"github.com/coinexchain/cet-sdk/msgqueue"
+	"github.com/coinexchain/dex/app/sink"
+)
+
+const (
+	flagFromHeight = "from-height"
+	flagToHeight   = "to-height"
+)
+
+func replayPubMsgsCmd(ctx *server.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay-pubmsgs",
+		Short: "Re-emit the pub messages of a height range from the local WAL",
+		Long: `Re-emit the pub messages of the heights in [from-height, to-height] from the local WAL to the
+msgqueue brokers and the sinks in app.toml, with their original seqs and checksums. The heights
+which are not complete in the WAL are skipped.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fromHeight := viper.GetInt64(flagFromHeight)
+			toHeight := viper.GetInt64(flagToHeight)
+			if fromHeight <= 0 || (toHeight > 0 && toHeight < fromHeight) {
+				return fmt.Errorf("invalid height range [%d, %d]", fromHeight, toHeight)
+			}
+
+			sinks, err := sink.LoadSinks()
+			if err != nil {
+				return err
+			}
+			sender := sink.NewSender(msgqueue.NewProducer(ctx.Logger), sinks, ctx.Logger)
+			defer sender.Close()
+			if !sender.IsOpenToggle() {
+				return fmt.Errorf("neither msgqueue brokers nor sinks are enabled in app.toml")
+			}
+
+			var count, heights int64
+			err = sink.ReplayWAL(sink.WALDirFromConfig(), fromHeight, toHeight, func(msg sink.Msg) error {
+				sink.SendBlockMsgs(sender, []sink.Msg{msg})
+				count++
+				if msg.Key == sink.CommitKey {
+					heights++
+				}
+				return nil
+			})
+			fmt.Printf("%d messages of %d heights are replayed\n", count, heights)
+			return err
+		},
+	}
+
+	cmd.Flags().Int64(flagFromHeight, 0, "First height to replay")
+	cmd.Flags().Int64(flagToHeight, 0, "Last height to replay, defaults to the last one in the WAL")
+	_ = cmd.MarkFlagRequired(flagFromHeight)
+	return cmd
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coinexchain/dex/app/notify"
+)
+
+func NotifySchemasCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notify-schemas [dir]",
+		Short: "Generate the JSON Schemas of the notification messages, one <key>.json file per message",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := args[0]
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			for _, key := range notify.Keys() {
+				schema, err := notify.Schema(key)
+				if err != nil {
+					return err
+				}
+				path := filepath.Join(dir, key+".json")
+				if err = ioutil.WriteFile(path, append(schema, '\n'), 0644); err != nil {
+					return err
+				}
+				fmt.Println(path)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
@@ -46,6 +46,7 @@ func createRootCmd(cdc *codec.Codec) *cobra.Command {
 		DefaultParamsCmd(),
 		CosmosHubParamsCmd(cdc),
 		RestEndpointsCmd(registerRoutes),
+		NotifySchemasCmd(),
 		//ShowCommandTreeCmd(),
 	)
 
@@ -8,10 +8,12 @@ require (
 	github.com/coinexchain/randsrc v0.0.0-20191012073615-acfab7318ec6
 	github.com/coinexchain/trade-server v0.2.8-0.20200423021423-12d59229ce5a
 	github.com/cosmos/cosmos-sdk v0.37.4
+	github.com/go-kit/kit v0.9.0
 	github.com/gorilla/mux v1.7.3
 	github.com/mattn/go-runewidth v0.0.8 // indirect
 	github.com/olekukonko/tablewriter v0.0.1
 	github.com/pelletier/go-toml v1.4.0
+	github.com/prometheus/client_golang v0.9.3
 	github.com/rakyll/statik v0.1.6
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.6.1